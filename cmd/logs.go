@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+)
+
+const logsUsage = `usage: %s logs <command> [arguments]
+
+commands:
+  export [-dir logs] [-user <id>]  write conversations as <threadID>.json log files
+  import [-dir logs]               load <threadID>.json log files into the database
+`
+
+// runLogs runs the logs subcommand and returns the exit code
+func runLogs(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, logsUsage, os.Args[0])
+		return 2
+	}
+
+	fs := flag.NewFlagSet("logs "+args[0], flag.ContinueOnError)
+	dir := fs.String("dir", cfg.LogsDir, "directory of <threadID>.json log files")
+	var userID *string
+	switch args[0] {
+	case "export":
+		userID = fs.String("user", "", "only export this user's conversations")
+	case "import":
+	default:
+		fmt.Fprintf(os.Stderr, logsUsage, os.Args[0])
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 {
+		return 2
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+	defer closeDatabase()
+
+	if args[0] == "export" {
+		stats, err := a.ExportLogs(*dir, *userID)
+		if err != nil {
+			log.Printf("Export failed: %v", err)
+			return 1
+		}
+		log.Printf("Exported %d conversations to %s (%d failed)", stats.Exported, *dir, stats.Failed)
+		if stats.Failed > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	stats, err := a.ImportLogs(*dir)
+	if err != nil {
+		log.Printf("Import failed: %v", err)
+		return 1
+	}
+	log.Printf("Imported %d of %d log files (%d already present, %d failed)",
+		stats.Imported, stats.Files, stats.Skipped, stats.Failed)
+	if stats.Failed > 0 {
+		return 1
+	}
+	return 0
+}
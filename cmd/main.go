@@ -1,13 +1,17 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
 
 	_ "github.com/EyeQuila/eyeQcheck/docs"
+	"github.com/EyeQuila/eyeQcheck/internal/app"
 	"github.com/EyeQuila/eyeQcheck/internal/config"
-	"github.com/EyeQuila/eyeQcheck/internal/middleware"
-	"github.com/EyeQuila/eyeQcheck/internal/router"
-	"github.com/gin-gonic/gin"
+	"github.com/EyeQuila/eyeQcheck/internal/database"
+	"github.com/EyeQuila/eyeQcheck/internal/logging"
 	"github.com/joho/godotenv"
 )
 
@@ -24,29 +28,86 @@ import (
 
 // @host      localhost:8080
 // @BasePath  /api
+
+const usage = `usage: %s [flags] [command] [arguments]
+
+commands:
+  serve       run the API server (default)
+  migrate     apply or revert database migrations
+  seed        create the default plans, demo users and fixture conversations
+  user        create users, disable them or change their role
+  token mint  sign a development JWT with the configured JWT_SECRET
+  logs        export conversations to, or import them from, log files
+
+Settings come from the YAML or TOML file named by -config or CONFIG_FILE,
+then environment variables, then flags. Run "%s -h" to list them, and
+"%s <command> -h" for the arguments of a command.
+`
+
 func main() {
 	// Load environment variables from .env.local file if it exists
-	if err := godotenv.Load(".env.local"); err != nil {
-		log.Println("No .env.local file found, using environment variables")
-	}
+	envErr := godotenv.Load(".env.local")
 
-	// Load configuration
-	// This will read from environment variables or use defaults
-	cfg := config.Load()
+	// Load configuration once
+	// This reads the config file, environment variables and the flags
+	// before the command, and is shared by every subcommand
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stdout, usage, os.Args[0], os.Args[0], os.Args[0])
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
 
-	// Set Gin mode based on configuration
-	gin.SetMode(cfg.GinMode)
-	r := gin.Default()
+	// Every command logs through the configured slog logger
+	if _, err := logging.Setup(cfg, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if envErr != nil {
+		slog.Debug("No .env.local file found, using environment variables")
+	}
 
-	// Initialize middleware first
-	r.Use(middleware.CORSMiddleware())
-	r.Use(gin.Recovery())
-	r.Use(gin.Logger())
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
 
-	// Set up the API routes
-	router.RegisterRoutes(r)
+	switch command {
+	case "serve":
+		os.Exit(runServe(cfg, args))
+	case "migrate":
+		os.Exit(runMigrate(cfg, args))
+	case "seed":
+		os.Exit(runSeed(cfg, args))
+	case "user":
+		os.Exit(runUser(cfg, args))
+	case "token":
+		os.Exit(runToken(cfg, args))
+	case "logs":
+		os.Exit(runLogs(cfg, args))
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintf(os.Stdout, usage, os.Args[0], os.Args[0], os.Args[0])
+	default:
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0], os.Args[0])
+		os.Exit(2)
+	}
+}
 
-	log.Printf("Starting server on port: %s...", cfg.Port)
-	log.Printf("Swagger docs available at: http://localhost:%s/swagger/index.html", cfg.Port)
-	r.Run(":" + cfg.Port)
-}
\ No newline at end of file
+// openApp connects to the database, makes sure its schema is current and
+// builds the application on top of it. Every command except migrate and
+// token needs it.
+func openApp(cfg *config.Config) (*app.App, error) {
+	if err := database.Init(cfg); err != nil {
+		return nil, err
+	}
+	if err := database.CheckSchema(); err != nil {
+		if errors.Is(err, database.ErrSchemaOutdated) {
+			return nil, fmt.Errorf("refusing to start: %w. Run \"%s migrate up\" first", err, os.Args[0])
+		}
+		return nil, fmt.Errorf("failed to check database schema: %w", err)
+	}
+	return app.New(cfg, database.DB)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/middleware"
+)
+
+// redirect points *file at a temporary file until the test ends and returns
+// a function reading what was written to it
+func redirect(t *testing.T, file **os.File) func() string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = out
+	t.Cleanup(func() {
+		*file = saved
+		out.Close()
+	})
+	return func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+}
+
+func TestCommandUsageErrors(t *testing.T) {
+	redirect(t, &os.Stderr)
+	cfg := config.Default()
+
+	// None of these reach the database
+	for _, tc := range []struct {
+		name string
+		run  func(*config.Config, []string) int
+		args []string
+	}{
+		{"logs without command", runLogs, nil},
+		{"logs unknown command", runLogs, []string{"purge"}},
+		{"logs import with arguments", runLogs, []string{"import", "extra"}},
+		{"logs import with export flag", runLogs, []string{"import", "-user", "user-1"}},
+		{"user without command", runUser, nil},
+		{"user unknown command", runUser, []string{"delete"}},
+		{"token without command", runToken, nil},
+		{"token without user", runToken, []string{"mint"}},
+		{"token bad role", runToken, []string{"mint", "-user", "user-1", "-role", "root"}},
+		{"token bad ttl", runToken, []string{"mint", "-user", "user-1", "-ttl", "-1h"}},
+		{"migrate without command", runMigrate, nil},
+		{"seed with arguments", runSeed, []string{"now"}},
+		{"serve unknown flag", runServe, []string{"-dir", "logs"}},
+	} {
+		if code := tc.run(cfg, tc.args); code != 2 {
+			t.Errorf("%s: exit code %d, want 2", tc.name, code)
+		}
+	}
+}
+
+func TestTokenMint(t *testing.T) {
+	cfg := config.Default()
+	cfg.JWTIssuer = "eyeqcheck-dev"
+	stdout := redirect(t, &os.Stdout)
+
+	if code := runToken(cfg, []string{"mint", "-user", "user-1", "-email", "one@example.com", "-role", "admin"}); code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+
+	verifier, err := middleware.NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(context.Background(), strings.TrimSpace(stdout()))
+	if err != nil {
+		t.Fatalf("minted token does not verify: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Email != "one@example.com" || claims.Role != "admin" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// Only the identity provider can sign tokens for a JWKS
+	cfg.JWTMode = config.JWTModeJWKS
+	if code := runToken(cfg, []string{"mint", "-user", "user-1"}); code != 1 {
+		t.Errorf("jwks mode: exit code %d, want 1", code)
+	}
+}
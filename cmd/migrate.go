@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/database"
+)
+
+const migrateUsage = `usage: %s migrate <command>
+
+commands:
+  up      apply all pending migrations
+  down    revert the newest applied migration
+  status  list migrations and whether they are applied
+  redo    revert the newest applied migration and apply it again
+`
+
+// runMigrate runs the migrate subcommand and returns the exit code
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+		return 2
+	}
+
+	if err := database.Init(cfg); err != nil {
+		slog.Error("Failed to open database", "err", err)
+		return 1
+	}
+	migrator, err := database.NewMigrator(database.DB)
+	if err != nil {
+		slog.Error("Failed to load migrations", "err", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			slog.Error("Migration failed", "err", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			slog.Info("Database schema is up to date")
+		}
+	case "down":
+		m, err := migrator.Down()
+		if errors.Is(err, database.ErrNoMigrationApplied) {
+			slog.Info("No migration to revert")
+			return 0
+		}
+		if err != nil {
+			slog.Error("Rollback failed", "err", err)
+			return 1
+		}
+		slog.Info("Reverted migration", "version", m.Version, "name", m.Name)
+	case "redo":
+		m, err := migrator.Redo()
+		if err != nil {
+			slog.Error("Redo failed", "err", err)
+			return 1
+		}
+		slog.Info("Redid migration", "version", m.Version, "name", m.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			slog.Error("Failed to read migration status", "err", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+)
+
+// runSeed runs the seed subcommand and returns the exit code
+func runSeed(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s seed\n\nCreates the default plans, demo users and fixture conversations. Safe to re-run.\n", os.Args[0])
+	}
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return 2
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+	defer closeDatabase()
+
+	if _, err := a.SeedDemoData(); err != nil {
+		log.Printf("Seed failed: %v", err)
+		return 1
+	}
+	fmt.Println("Mint a token for a demo user with:")
+	for _, id := range services.DemoUserIDs() {
+		fmt.Printf("  %s token mint -user %s\n", os.Args[0], id)
+	}
+	return 0
+}
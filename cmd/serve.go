@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/database"
+	"github.com/EyeQuila/eyeQcheck/internal/metrics"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/EyeQuila/eyeQcheck/internal/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// runServe runs the API server until SIGINT or SIGTERM and returns the
+// exit code
+func runServe(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.String("port", cfg.Port, "port to listen on")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// Export spans before anything creates them
+	shutdownTracing, err := tracing.Init(context.Background(), cfg)
+	if err != nil {
+		slog.Error("Failed to start tracing", "err", err)
+		return 1
+	}
+	defer flushTraces(shutdownTracing, cfg)
+
+	// Connect to the database, make sure its schema is current and wire
+	// the services on top of it
+	a, err := openApp(cfg)
+	if err != nil {
+		slog.Error("Failed to open database", "err", err)
+		return 1
+	}
+	defer closeDatabase()
+	if sqlDB, err := a.DB.DB(); err == nil {
+		if err := metrics.RegisterDBStats(sqlDB); err != nil {
+			slog.Warn("Failed to export database pool metrics", "err", err)
+		}
+	}
+
+	// Create the default plans on first start
+	if err := a.Plans.SeedPlans(); err != nil {
+		slog.Error("Failed to seed plans", "err", err)
+		return 1
+	}
+
+	// The readiness check requires a writable logs directory, so a fresh
+	// container must not wait for something else to create it
+	if err := os.MkdirAll(cfg.LogsDir, 0o755); err != nil {
+		slog.Error("Failed to create logs directory", "dir", cfg.LogsDir, "err", err)
+		return 1
+	}
+
+	// Set Gin mode based on configuration
+	gin.SetMode(cfg.GinMode)
+	r := a.Router()
+
+	srv := &http.Server{
+		Addr:              ":" + *port,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.HTTPReadTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("Starting server", "port", *port)
+		slog.Info("Swagger docs available", "url", "http://localhost:"+*port+"/swagger/index.html")
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	// Metrics stay off the public listener
+	if cfg.MetricsAddr != "" {
+		metricsSrv := &http.Server{
+			Addr:              cfg.MetricsAddr,
+			Handler:           metrics.Handler(),
+			ReadHeaderTimeout: cfg.HTTPReadTimeout,
+		}
+		defer metricsSrv.Close()
+		go func() {
+			slog.Info("Serving metrics", "addr", cfg.MetricsAddr)
+			serveErr <- fmt.Errorf("metrics: %w", metricsSrv.ListenAndServe())
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		slog.Error("Server stopped", "err", err)
+		return 1
+	case <-ctx.Done():
+	}
+	// A second signal kills the process right away
+	stop()
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", cfg.ShutdownTimeout)
+	if err := shutdown(srv, cfg); err != nil {
+		slog.Error("Shutdown incomplete", "err", err)
+		return 1
+	}
+	slog.Info("Server stopped")
+	return 0
+}
+
+// shutdown stops accepting connections, drains in-flight requests and then
+// waits for background writes, giving each step cfg.ShutdownTimeout.
+// Requests still running at the deadline are cut off.
+func shutdown(srv *http.Server, cfg *config.Config) error {
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(drainCtx); err != nil {
+		errs = append(errs, err)
+		if err := srv.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := services.Flush(flushCtx); err != nil {
+		errs = append(errs, fmt.Errorf("background writes did not finish: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// flushTraces exports the spans still buffered when the server stops
+func flushTraces(shutdownTracing func(context.Context) error, cfg *config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "err", err)
+	}
+}
+
+// closeDatabase closes the connection pool once no more queries will run
+func closeDatabase() {
+	if err := database.Close(); err != nil {
+		slog.Error("Failed to close database", "err", err)
+	}
+}
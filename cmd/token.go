@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/middleware"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// runToken runs the token subcommand and returns the exit code. Only
+// "token mint" exists: it prints a JWT signed with cfg.JWTSecret, which
+// stands in for the client system's tokens in development. It needs
+// jwt_mode=hmac, since in jwks mode only the identity provider holds the
+// signing keys.
+func runToken(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "mint" {
+		fmt.Fprintf(os.Stderr, "usage: %s token mint -user <id> [-email <email>] [-name <name>] [-role user|admin] [-ttl 24h]\n", os.Args[0])
+		return 2
+	}
+
+	fs := flag.NewFlagSet("token mint", flag.ContinueOnError)
+	userID := fs.String("user", "", "user ID (required)")
+	email := fs.String("email", "", "email address")
+	name := fs.String("name", "", "display name")
+	googleID := fs.String("google-id", "", "Google account ID")
+	role := fs.String("role", services.RoleUser, "role: user or admin; registered users keep their stored role")
+	ttl := fs.Duration("ttl", 24*time.Hour, "how long the token is valid")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *userID == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if !services.ValidRole(*role) {
+		log.Printf("Role must be %s or %s", services.RoleUser, services.RoleAdmin)
+		return 2
+	}
+	if *ttl <= 0 {
+		log.Println("-ttl must be positive")
+		return 2
+	}
+	if cfg.JWTMode != config.JWTModeHMAC {
+		log.Printf("Tokens can only be minted with jwt_mode=%s; jwt_mode is %q", config.JWTModeHMAC, cfg.JWTMode)
+		return 1
+	}
+
+	claims := middleware.UserClaims{
+		UserID:      *userID,
+		Email:       *email,
+		DisplayName: *name,
+		GoogleID:    *googleID,
+		Role:        *role,
+	}
+	claims.Issuer = cfg.JWTIssuer
+	if cfg.JWTAudience != "" {
+		claims.Audience = jwt.ClaimStrings{cfg.JWTAudience}
+	}
+
+	token, err := middleware.MintToken(claims, cfg.JWTSecret, *ttl)
+	if err != nil {
+		log.Printf("Failed to sign token: %v", err)
+		return 1
+	}
+	fmt.Println(token)
+	return 0
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/google/uuid"
+)
+
+const userUsage = `usage: %s user <command> [arguments]
+
+commands:
+  create -email <email> [-id <id>] [-name <name>] [-role user|admin]
+                            register a user, or update the one with that ID
+  disable <id|email>        refuse the user's requests
+  enable <id|email>         allow a disabled user again
+  set-role <id|email> <role>
+                            change a user's role to user or admin
+`
+
+// runUser runs the user subcommand and returns the exit code
+func runUser(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, userUsage, os.Args[0])
+		return 2
+	}
+
+	var run func(*services.UserService, []string) int
+	switch args[0] {
+	case "create":
+		run = runUserCreate
+	case "disable":
+		run = func(users *services.UserService, args []string) int {
+			return runUserSetActive(users, args, false)
+		}
+	case "enable":
+		run = func(users *services.UserService, args []string) int {
+			return runUserSetActive(users, args, true)
+		}
+	case "set-role":
+		run = runUserSetRole
+	default:
+		fmt.Fprintf(os.Stderr, userUsage, os.Args[0])
+		return 2
+	}
+
+	a, err := openApp(cfg)
+	if err != nil {
+		log.Printf("%v", err)
+		return 1
+	}
+	defer closeDatabase()
+	return run(a.Users, args[1:])
+}
+
+func runUserCreate(users *services.UserService, args []string) int {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	id := fs.String("id", "", "user ID; a random UUID when empty")
+	email := fs.String("email", "", "email address (required)")
+	name := fs.String("name", "", "display name")
+	role := fs.String("role", services.RoleUser, "role: user or admin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *email == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if *id == "" {
+		*id = uuid.NewString()
+	}
+
+	user, created, err := users.RegisterOrUpdateUser(*id, *email, *name, "", "", *role)
+	if err != nil {
+		log.Printf("Failed to create user: %v", err)
+		return 1
+	}
+	if created {
+		fmt.Printf("Created user %s (%s)\n", user.ID, user.Email)
+	} else {
+		fmt.Printf("Updated user %s (%s)\n", user.ID, user.Email)
+	}
+	return 0
+}
+
+func runUserSetActive(users *services.UserService, args []string, active bool) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, userUsage, os.Args[0])
+		return 2
+	}
+
+	user, err := users.FindUser(args[0])
+	if err == nil {
+		err = users.SetActive(user.ID, active)
+	}
+	if err != nil {
+		log.Printf("Failed to update user %s: %v", args[0], err)
+		return 1
+	}
+	if active {
+		fmt.Printf("Enabled user %s\n", user.ID)
+	} else {
+		fmt.Printf("Disabled user %s\n", user.ID)
+	}
+	return 0
+}
+
+func runUserSetRole(users *services.UserService, args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, userUsage, os.Args[0])
+		return 2
+	}
+
+	user, err := users.FindUser(args[0])
+	if err == nil {
+		err = users.SetRole(user.ID, args[1])
+	}
+	if errors.Is(err, services.ErrInvalidRole) {
+		log.Printf("Role must be %s or %s", services.RoleUser, services.RoleAdmin)
+		return 2
+	}
+	if err != nil {
+		log.Printf("Failed to update user %s: %v", args[0], err)
+		return 1
+	}
+	fmt.Printf("User %s is now %s\n", user.ID, args[1])
+	return 0
+}
@@ -0,0 +1,155 @@
+// Package app is the application container. It wires the configuration,
+// the database, the repositories, the upstream clients and the services
+// together once, in main, and hands them to the HTTP handlers and the CLI
+// commands.
+package app
+
+import (
+	"context"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/controller"
+	"github.com/EyeQuila/eyeQcheck/internal/database"
+	"github.com/EyeQuila/eyeQcheck/internal/middleware"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"github.com/EyeQuila/eyeQcheck/internal/router"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// App holds the long-lived parts of the application. Services that keep
+// per-request state, like ChatService and STTService, are built per request
+// with NewChatService and NewSTTService.
+type App struct {
+	Config *config.Config
+	DB     *gorm.DB
+
+	Upstream *services.UpstreamClients
+	Backends *services.ChatBackends
+	// Payments is nil when payments are disabled
+	Payments services.PaymentProvider
+	// Cache is nil when response caching is disabled
+	Cache *services.ResponseCache
+
+	Users         *services.UserService
+	Preferences   *services.PreferenceService
+	Plans         *services.PlanService
+	Usage         *services.UsageService
+	Conversations *services.ConversationService
+	Subscriptions *services.SubscriptionService
+	Health        *services.HealthService
+
+	// Verifier checks the client system's tokens
+	Verifier *middleware.JWTVerifier
+	// RateLimiter enforces the plans' rate limits and quotas
+	RateLimiter *middleware.RateLimiter
+
+	conversations *repository.ConversationRepository
+}
+
+// New builds the application for cfg on top of db
+func New(cfg *config.Config, db *gorm.DB) (*App, error) {
+	payments, err := services.NewPaymentProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := middleware.NewJWTVerifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	users := repository.NewUserRepository(db)
+	conversations := repository.NewConversationRepository(db)
+	plans := services.NewPlanService(repository.NewPlanRepository(db))
+	upstream := services.NewUpstreamClients(cfg)
+
+	return &App{
+		Config: cfg,
+		DB:     db,
+
+		Upstream: upstream,
+		Backends: services.NewChatBackends(cfg, upstream),
+		Payments: payments,
+		Cache:    services.NewResponseCache(cfg, repository.NewCacheRepository(db)),
+
+		Users:         services.NewUserService(users),
+		Preferences:   services.NewPreferenceService(users),
+		Plans:         plans,
+		Usage:         services.NewUsageService(repository.NewUsageRepository(db), plans),
+		Conversations: services.NewConversationService(conversations),
+		Subscriptions: services.NewSubscriptionService(repository.NewSubscriptionRepository(db), plans, payments),
+		Health: services.NewHealthService(cfg, func(ctx context.Context) error {
+			return database.Ping(ctx, db)
+		}),
+
+		Verifier:    verifier,
+		RateLimiter: middleware.NewRateLimiter(middleware.NewLimiterStore(cfg), plans),
+
+		conversations: conversations,
+	}, nil
+}
+
+// NewChatService returns a chat service for one request
+func (a *App) NewChatService() *services.ChatService {
+	return services.NewChatService(a.Config, a.conversations, a.Backends, a.Cache, a.Usage)
+}
+
+// NewSTTService returns a speech-to-text service for one request
+func (a *App) NewSTTService() *services.STTService {
+	return services.NewSTTService(a.Config.SttURL, a.Upstream.STT, a.Usage)
+}
+
+// Handlers returns the HTTP handlers backed by the application's services
+func (a *App) Handlers() *controller.Handlers {
+	// A nil *ResponseCache or provider must reach the handlers as a nil
+	// interface, which is how they tell the feature is off
+	var cache controller.ResponseCache
+	if a.Cache != nil {
+		cache = a.Cache
+	}
+	var checkout controller.CheckoutSimulator
+	if fake, ok := a.Payments.(*services.FakePaymentProvider); ok && a.Config.GinMode != config.ModeRelease {
+		checkout = fake
+	}
+
+	return &controller.Handlers{
+		Chat: controller.NewChatHandler(func() controller.ChatService {
+			return a.NewChatService()
+		}, a.Preferences),
+		STT: controller.NewSTTHandler(func() controller.STTService {
+			return a.NewSTTService()
+		}, a.Preferences),
+		Conversations: controller.NewConversationHandler(a.Conversations),
+		Users:         controller.NewUserHandler(a.Users),
+		Preferences:   controller.NewPreferenceHandler(a.Preferences),
+		Usage:         controller.NewUsageHandler(a.Usage),
+		Plans:         controller.NewPlanHandler(a.Plans),
+		Cache:         controller.NewCacheHandler(cache),
+		Upgrade:       controller.NewUpgradeHandler(a.Subscriptions, checkout),
+		Health:        controller.NewHealthHandler(a.Health),
+	}
+}
+
+// Router returns the HTTP engine serving every route
+func (a *App) Router() *gin.Engine {
+	return router.New(a.Config, a.Handlers(), middleware.AuthMiddleware(a.Verifier, a.Users), a.RateLimiter, a.Preferences)
+}
+
+// SeedDemoData creates the default plans, the demo users and their fixture
+// conversations; see services.SeedDemoData
+func (a *App) SeedDemoData() (*services.SeedStats, error) {
+	return services.SeedDemoData(a.Users, a.Plans, a.conversations)
+}
+
+// ExportLogs writes conversations to dir as log files; see
+// services.ExportLogs
+func (a *App) ExportLogs(dir, userID string) (*services.LogExportStats, error) {
+	return services.ExportLogs(a.conversations, dir, userID)
+}
+
+// ImportLogs loads the log files in dir into the database; see
+// services.ImportLogs
+func (a *App) ImportLogs(dir string) (*services.LogImportStats, error) {
+	return services.ImportLogs(a.conversations, dir)
+}
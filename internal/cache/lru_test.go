@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for expiry tests
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestLRUEviction(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		maxEntries int
+		ops        []string // "set k", "get k" or "del k"
+		want       []string // keys still present
+		gone       []string // keys evicted
+	}{
+		{"within bound", 3, []string{"set a", "set b", "set c"}, []string{"a", "b", "c"}, nil},
+		{"oldest evicted", 2, []string{"set a", "set b", "set c"}, []string{"b", "c"}, []string{"a"}},
+		{"get refreshes recency", 2, []string{"set a", "set b", "get a", "set c"}, []string{"a", "c"}, []string{"b"}},
+		{"set refreshes recency", 2, []string{"set a", "set b", "set a", "set c"}, []string{"a", "c"}, []string{"b"}},
+		{"delete frees a slot", 2, []string{"set a", "set b", "del a", "set c"}, []string{"b", "c"}, []string{"a"}},
+		{"no bound", 0, []string{"set a", "set b", "set c", "set d"}, []string{"a", "b", "c", "d"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewLRU[string](tc.maxEntries, 0)
+			for _, op := range tc.ops {
+				verb, key, _ := strings.Cut(op, " ")
+				switch verb {
+				case "set":
+					c.Set(key, "value of "+key)
+				case "get":
+					c.Get(key)
+				case "del":
+					c.Delete(key)
+				}
+			}
+			for _, key := range tc.want {
+				if v, ok := c.Get(key); !ok || v != "value of "+key {
+					t.Errorf("Get(%s) = %q, %v; want it cached", key, v, ok)
+				}
+			}
+			for _, key := range tc.gone {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("Get(%s) hit, want it evicted", key)
+				}
+			}
+			if c.Len() != len(tc.want) {
+				t.Errorf("Len = %d, want %d", c.Len(), len(tc.want))
+			}
+		})
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		refresh bool // set the key again halfway
+		hit     bool
+	}{
+		{"fresh", time.Minute, 30 * time.Second, false, true},
+		{"at the ttl", time.Minute, time.Minute, false, true},
+		{"expired", time.Minute, time.Minute + time.Second, false, false},
+		{"set again restarts the ttl", time.Minute, time.Minute + time.Second, true, true},
+		{"no ttl", 0, 24 * time.Hour, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := &clock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+			c := NewLRU[int](10, tc.ttl)
+			c.now = clk.Now
+
+			c.Set("k", 1)
+			if tc.refresh {
+				clk.Advance(tc.elapsed / 2)
+				c.Set("k", 2)
+				clk.Advance(tc.elapsed - tc.elapsed/2)
+			} else {
+				clk.Advance(tc.elapsed)
+			}
+
+			_, ok := c.Get("k")
+			if ok != tc.hit {
+				t.Errorf("Get after %s = %v, want %v", tc.elapsed, ok, tc.hit)
+			}
+			// Expired entries are dropped on lookup
+			if !tc.hit && c.Len() != 0 {
+				t.Errorf("Len = %d, want the expired entry removed", c.Len())
+			}
+		})
+	}
+}
+
+func TestLRUSetUntil(t *testing.T) {
+	clk := &clock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := NewLRU[int](10, time.Hour)
+	c.now = clk.Now
+
+	// The given expiry wins over the cache's TTL, in both directions
+	c.SetUntil("soon", 1, clk.Now().Add(time.Minute))
+	c.SetUntil("late", 2, clk.Now().Add(2*time.Hour))
+	clk.Advance(time.Minute + time.Second)
+	if _, ok := c.Get("soon"); ok {
+		t.Error("entry outlived its expiry")
+	}
+	clk.Advance(time.Hour)
+	if _, ok := c.Get("late"); !ok {
+		t.Error("entry expired with the cache's TTL instead of its own")
+	}
+}
+
+func TestLRUDeleteFunc(t *testing.T) {
+	c := NewLRU[string](0, 0)
+	c.Set("a", "rag")
+	c.Set("b", "openai")
+	c.Set("c", "rag")
+
+	removed := c.DeleteFunc(func(_ string, backend string) bool { return backend == "rag" })
+	if removed != 2 || c.Len() != 1 {
+		t.Errorf("DeleteFunc removed %d, left %d; want 2 removed and 1 left", removed, c.Len())
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("DeleteFunc removed a non-matching entry")
+	}
+}
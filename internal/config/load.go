@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable pointing at the config file when
+// no -config flag is given
+const FileEnv = "CONFIG_FILE"
+
+// setting is one configurable field of Config
+type setting struct {
+	key    string
+	def    string
+	secret bool
+	field  reflect.Value
+}
+
+func (s setting) env() string  { return strings.ToUpper(s.key) }
+func (s setting) flag() string { return strings.ReplaceAll(s.key, "_", "-") }
+
+// typeName names the kind of value the setting takes, for flag help
+func (s setting) typeName() string {
+	if s.field.Type() == reflect.TypeOf(time.Duration(0)) {
+		return "duration"
+	}
+	return s.field.Type().String()
+}
+
+// set parses value into the setting's field
+func (s setting) set(value string) error {
+	switch s.field.Interface().(type) {
+	case string:
+		s.field.SetString(value)
+	case int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		s.field.SetInt(int64(n))
+	case float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		s.field.SetFloat(f)
+	case bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		s.field.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+		s.field.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported type %s", s.field.Type())
+	}
+	return nil
+}
+
+// settings lists the fields of cfg that carry a config tag
+func settings(cfg *Config) []setting {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	var list []setting
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("config")
+		if key == "" {
+			continue
+		}
+		list = append(list, setting{
+			key:    key,
+			def:    t.Field(i).Tag.Get("default"),
+			secret: t.Field(i).Tag.Get("secret") == "true",
+			field:  v.Field(i),
+		})
+	}
+	return list
+}
+
+// Load reads the configuration once at startup: the defaults, then the
+// file named by -config or CONFIG_FILE, then the environment, then the
+// flags at the start of args. It returns the arguments left after the
+// flags. The result is validated; all problems are reported together.
+// flag.ErrHelp is returned when args ask for help.
+func Load(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	list := settings(cfg)
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(FileEnv), "YAML or TOML config `file` (env "+FileEnv+")")
+	flags := make(map[string]*string, len(list))
+	for _, s := range list {
+		usage := "`" + s.typeName() + "` setting " + s.key + ", env " + s.env()
+		if s.def != "" && !s.secret {
+			usage += ", default " + strconv.Quote(s.def)
+		}
+		flags[s.key] = fs.String(s.flag(), "", usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var errs []error
+	for _, s := range list {
+		if err := s.set(s.def); err != nil {
+			errs = append(errs, fmt.Errorf("default %s: %w", s.key, err))
+		}
+	}
+
+	if *file != "" {
+		values, err := readFile(*file)
+		if err != nil {
+			return nil, nil, err
+		}
+		known := make(map[string]setting, len(list))
+		for _, s := range list {
+			known[s.key] = s
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s, ok := known[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %q", *file, key))
+				continue
+			}
+			if err := s.set(values[key]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", *file, key, err))
+			}
+		}
+	}
+
+	for _, s := range list {
+		// An empty variable counts as unset, as it always has
+		if value := os.Getenv(s.env()); value != "" {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env(), err))
+			}
+		}
+	}
+
+	for _, s := range list {
+		if given[s.flag()] {
+			if err := s.set(*flags[s.key]); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag(), err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	cfg.fillDerived()
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// readFile reads a YAML or TOML config file, chosen by its extension, into
+// setting values keyed by setting key
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: use a .yaml, .yml or .toml extension", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten(values, "", raw); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flatten turns nested tables into underscore-joined keys
+func flatten(values map[string]string, prefix string, raw map[string]any) error {
+	for key, value := range raw {
+		key = strings.ToLower(key)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			if err := flatten(values, key, v); err != nil {
+				return err
+			}
+		case []any:
+			return fmt.Errorf("%s: lists are not supported, use a comma-separated string", key)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets the variables the tests set, in case the environment
+// running them has them
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{FileEnv, "PORT", "RAG_TIMEOUT", "CACHE_MAX_ENTRIES", "LOG_LEVEL", "GIN_MODE"} {
+		t.Setenv(key, "")
+	}
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+port: "9000"
+rag_timeout: 10s
+cache_max_entries: 50
+log_level: warn
+`)
+
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want func(*Config) bool
+	}{
+		{"default", nil, nil, func(c *Config) bool {
+			return c.Port == "8080" && c.RagTimeout == time.Minute && c.CacheMaxEntries == 1000
+		}},
+		{"file over default", nil, []string{"-config", file}, func(c *Config) bool {
+			return c.Port == "9000" && c.RagTimeout == 10*time.Second && c.CacheMaxEntries == 50
+		}},
+		{"file named by the environment", map[string]string{FileEnv: file}, nil, func(c *Config) bool {
+			return c.Port == "9000"
+		}},
+		{"env over file", map[string]string{"PORT": "9100", "RAG_TIMEOUT": "20s"}, []string{"-config", file}, func(c *Config) bool {
+			return c.Port == "9100" && c.RagTimeout == 20*time.Second && c.CacheMaxEntries == 50
+		}},
+		{"empty env counts as unset", map[string]string{"PORT": ""}, []string{"-config", file}, func(c *Config) bool {
+			return c.Port == "9000"
+		}},
+		{"flag over env", map[string]string{"PORT": "9100"}, []string{"-config", file, "-port", "9200", "-log-level", "debug"}, func(c *Config) bool {
+			return c.Port == "9200" && c.LogLevel == "debug" && c.RagTimeout == 10*time.Second
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			cfg, _, err := Load(tc.args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tc.want(cfg) {
+				t.Errorf("port=%s rag_timeout=%s cache_max_entries=%d log_level=%s",
+					cfg.Port, cfg.RagTimeout, cfg.CacheMaxEntries, cfg.LogLevel)
+			}
+		})
+	}
+}
+
+func TestLoadReturnsTheCommand(t *testing.T) {
+	clearEnv(t)
+	_, args, err := Load([]string{"-port", "9000", "migrate", "up"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args = %q, want [migrate up]", args)
+	}
+}
+
+func TestLoadNestedTables(t *testing.T) {
+	for name, data := range map[string]string{
+		"config.yaml": `
+rag:
+  timeout: 15s
+  health:
+    url: http://rag:8000/health
+CACHE:
+  Max_Entries: 7
+`,
+		"config.toml": `
+[rag]
+timeout = "15s"
+[rag.health]
+url = "http://rag:8000/health"
+[CACHE]
+Max_Entries = 7
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			cfg, _, err := Load([]string{"-config", writeFile(t, name, data)})
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.RagTimeout != 15*time.Second || cfg.RagHealthURL != "http://rag:8000/health" || cfg.CacheMaxEntries != 7 {
+				t.Errorf("rag_timeout=%s rag_health_url=%s cache_max_entries=%d", cfg.RagTimeout, cfg.RagHealthURL, cfg.CacheMaxEntries)
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, data string
+		env              map[string]string
+		args             []string
+		want             string
+	}{
+		{name: "unknown file key", file: "config.yaml", data: "rag_timeuot: 5s", want: `unknown setting "rag_timeuot"`},
+		{name: "list in file", file: "config.yaml", data: "allowed_origins: [a, b]", want: "lists are not supported"},
+		{name: "bad file value", file: "config.yaml", data: "rag_timeout: soon", want: "rag_timeout"},
+		{name: "unsupported extension", file: "config.json", data: "{}", want: ".toml extension"},
+		{name: "bad env value", env: map[string]string{"CACHE_MAX_ENTRIES": "many"}, want: "CACHE_MAX_ENTRIES"},
+		{name: "bad flag value", args: []string{"-rag-timeout", "soon"}, want: "-rag-timeout"},
+		{name: "invalid result", args: []string{"-port", "0"}, want: "port"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", writeFile(t, tc.file, tc.data)}, args...)
+			}
+			_, _, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadHelpHidesSecretDefaults(t *testing.T) {
+	clearEnv(t)
+	help := filepath.Join(t.TempDir(), "help")
+	out, err := os.Create(help)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = out
+	_, _, err = Load([]string{"-h"})
+	os.Stderr = stderr
+	out.Close()
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("err = %v, want flag.ErrHelp", err)
+	}
+
+	data, err := os.ReadFile(help)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if !strings.Contains(text, `default "8080"`) {
+		t.Errorf("help lacks the port default:\n%s", text)
+	}
+	defaults := Default()
+	for _, secret := range []string{defaults.JWTSecret, defaults.DatabaseURL, defaults.RedisURL} {
+		if strings.Contains(text, secret) {
+			t.Errorf("help shows the secret default %q", secret)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("defaults do not validate: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"port", func(c *Config) { c.Port = "http" }, "port"},
+		{"metrics addr without a port", func(c *Config) { c.MetricsAddr = "9090" }, "metrics_addr"},
+		{"metrics on the api port", func(c *Config) { c.MetricsAddr = "127.0.0.1:" + c.Port }, "metrics_addr"},
+		{"gin mode", func(c *Config) { c.GinMode = "prod" }, "gin_mode"},
+		{"rag url", func(c *Config) { c.RagURL = "ftp://rag" }, "rag_url"},
+		{"jwt mode", func(c *Config) { c.JWTMode = "rsa" }, "jwt_mode"},
+		{"jwks without a source", func(c *Config) { c.JWTMode = JWTModeJWKS }, "jwt_jwks_url"},
+		{"jwks with two sources", func(c *Config) {
+			c.JWTMode = JWTModeJWKS
+			c.JWTJWKSURL = "https://id.example.com/jwks.json"
+			c.JWTJWKSFile = "jwks.json"
+		}, "jwt_jwks_url"},
+		{"hmac without a secret", func(c *Config) { c.JWTSecret = "" }, "jwt_secret"},
+		{"database url", func(c *Config) { c.DatabaseURL = "" }, "database_url"},
+		{"timeout", func(c *Config) { c.RagTimeout = 0 }, "rag_timeout"},
+		{"logs dir", func(c *Config) { c.LogsDir = "" }, "logs_dir"},
+		{"sample ratio", func(c *Config) { c.TracingSampleRatio = 2 }, "tracing_sample_ratio"},
+		{"openai without a key", func(c *Config) { c.ChatBackend = "openai" }, "openai_api_key"},
+		{"redis url", func(c *Config) {
+			c.RateLimitStore = "redis"
+			c.RedisURL = "http://localhost:6379"
+		}, "redis_url"},
+		{"payment provider", func(c *Config) { c.PaymentProvider = "stripe" }, "payment_provider"},
+		{"webhook secret", func(c *Config) { c.PaymentWebhookSecret = "" }, "payment_webhook_secret"},
+		{"history", func(c *Config) { c.HistoryMaxMessages = -1 }, "history_max_messages"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			tc.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want+":") {
+				t.Errorf("err = %v, want one for %s", err, tc.want)
+			}
+		})
+	}
+
+	// Every problem is reported, not just the first
+	cfg := Default()
+	cfg.Port = "0"
+	cfg.RagTimeout = 0
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "port:") || !strings.Contains(err.Error(), "rag_timeout:") {
+		t.Errorf("err = %v, want both problems", err)
+	}
+
+	// Without payments no webhook secret is needed
+	cfg = Default()
+	cfg.PaymentProvider = "none"
+	cfg.PaymentWebhookSecret = ""
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("payment_provider=none: %v", err)
+	}
+}
+
+// releaseConfig returns a configuration that passes the release checks
+func releaseConfig() *Config {
+	cfg := Default()
+	cfg.GinMode = ModeRelease
+	cfg.JWTSecret = strings.Repeat("j", minSecretLength)
+	cfg.PaymentProvider = "none"
+	cfg.DatabaseURL = "postgres://eyeqcheck:s3cret@db:5432/eyeqcheck"
+	return cfg
+}
+
+func TestValidateRelease(t *testing.T) {
+	if err := releaseConfig().Validate(); err != nil {
+		t.Fatalf("release config does not validate: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"default jwt secret", func(c *Config) { c.JWTSecret = Default().JWTSecret }, "jwt_secret"},
+		{"short jwt secret", func(c *Config) { c.JWTSecret = "short" }, "jwt_secret"},
+		{"jwks without issuer", func(c *Config) {
+			c.JWTMode = JWTModeJWKS
+			c.JWTJWKSURL = "https://id.example.com/jwks.json"
+			c.JWTAudience = "eyeqcheck"
+		}, "jwt_issuer"},
+		{"jwks without audience", func(c *Config) {
+			c.JWTMode = JWTModeJWKS
+			c.JWTJWKSURL = "https://id.example.com/jwks.json"
+			c.JWTIssuer = "https://id.example.com"
+		}, "jwt_audience"},
+		{"fake payments", func(c *Config) {
+			c.PaymentProvider = "fake"
+			c.PaymentWebhookSecret = strings.Repeat("w", minSecretLength)
+		}, "payment_provider"},
+		{"default database url", func(c *Config) { c.DatabaseURL = Default().DatabaseURL }, "database_url"},
+		{"development database password", func(c *Config) {
+			c.DatabaseURL = "postgres://user:password@db:5432/eyeqcheck"
+		}, "database_url"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := releaseConfig()
+			tc.change(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want+":") {
+				t.Errorf("err = %v, want one for %s", err, tc.want)
+			}
+		})
+	}
+
+	// The jwt secret is not used in jwks mode
+	cfg := releaseConfig()
+	cfg.JWTMode = JWTModeJWKS
+	cfg.JWTJWKSURL = "https://id.example.com/jwks.json"
+	cfg.JWTIssuer = "https://id.example.com"
+	cfg.JWTAudience = "eyeqcheck"
+	cfg.JWTSecret = Default().JWTSecret
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("release jwks config: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// CacheHandler serves the response cache routes
+type CacheHandler struct {
+	cache ResponseCache
+}
+
+// NewCacheHandler returns a cache handler for cache, which is nil when
+// response caching is disabled
+func NewCacheHandler(cache ResponseCache) *CacheHandler {
+	return &CacheHandler{cache: cache}
+}
+
+// InvalidateCache clears the chat response cache
+// @Summary      Invalidate response cache
+// @Description  Remove cached chat replies, e.g. after the knowledge base changes. Admins only.
+// @Tags         Admin
+// @Produce      json
+// @Param        backend query string false "Only invalidate replies from this backend (rag, openai, echo)"
+// @Success      200 {object} model.CacheInvalidateResponse "Number of entries removed"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      403 {object} map[string]string "Not an admin"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /admin/cache [delete]
+func (h *CacheHandler) InvalidateCache(c *gin.Context) {
+	if h.cache == nil {
+		c.JSON(http.StatusOK, model.CacheInvalidateResponse{Message: "Response cache is disabled"})
+		return
+	}
+
+	removed, err := h.cache.Invalidate(c.Query("backend"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to invalidate response cache", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate response cache"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Response cache invalidated", "user_id", c.GetString("user_id"), "entries", removed)
+	c.JSON(http.StatusOK, model.CacheInvalidateResponse{
+		Message:     "Response cache invalidated",
+		Invalidated: removed,
+	})
+}
@@ -1,100 +1,319 @@
 package controller
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/EyeQuila/eyeQcheck/internal/metrics"
 	"github.com/EyeQuila/eyeQcheck/internal/model"
 	"github.com/EyeQuila/eyeQcheck/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-// ChatController handles chat requests
+// demoMaxMessages caps the messages a guest may send in one demo request
+const demoMaxMessages = 10
+
+// ChatHandler serves the chat routes
+type ChatHandler struct {
+	newChat   func() ChatService
+	languages LanguageSource
+}
+
+// NewChatHandler returns a chat handler that builds a chat service with
+// newChat for every request and answers in the language languages picks
+func NewChatHandler(newChat func() ChatService, languages LanguageSource) *ChatHandler {
+	return &ChatHandler{newChat: newChat, languages: languages}
+}
+
+// Chat handles chat requests
 // @Summary      Process chat conversation
 // @Description  Send messages to AI assistant and get response for eye examination consultation
 // @Tags         Conversation
 // @Accept       json
 // @Produce      json
-// @Param        request body model.ChatRequest true "Chat request with messages and optional thread_id"
+// @Produce      text/event-stream
+// @Param        request body model.ChatRequest true "Chat request with either the full messages history or a single message, and optional thread_id"
+// @Param        thread_id query string false "Thread ID, used when the body has none"
+// @Param        stream query bool false "Stream the reply as Server-Sent Events (same as Accept: text/event-stream)"
 // @Success      200 {object} model.ChatResponse "Successful response with assistant reply"
 // @Failure      400 {object} map[string]string "Invalid request payload"
+// @Failure      403 {object} map[string]string "Backend or model override by a non-admin"
+// @Failure      404 {object} map[string]string "Thread belongs to another user"
 // @Failure      500 {object} map[string]string "Internal server error"
 // @Router       /conversation/chat [post]
-func ChatController(c *gin.Context) {
+func (h *ChatHandler) Chat(c *gin.Context) {
 	var req model.ChatRequest
 
 	// Parse the incoming JSON request into the ChatRequest struct
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Failed to bind JSON: %v", err)
+		slog.WarnContext(c.Request.Context(), "Invalid chat request", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	threadID := c.Query("thread_id")
-	if threadID == "" {
-		threadID = uuid.New().String()
-	}
-
-	// Validate the messages in the request
-	chatService := services.NewChatService()
-	response, err := chatService.ProcessChat(req.Messages, threadID)
-	if err != nil {
-		log.Printf("Error processing chat: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process chat"})
+	threadID, ok := resolveThreadID(c, &req)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	h.reply(c, &req, threadID)
 }
 
-// DemoChatController handles demo chat requests for anonymous users
+// DemoChat handles demo chat requests for anonymous users
 // @Summary      Demo chat conversation for guests
 // @Description  Limited chat functionality for non-logged-in users (demo/trial)
 // @Tags         Demo
 // @Accept       json
 // @Produce      json
+// @Produce      text/event-stream
 // @Param        request body model.ChatRequest true "Demo chat request with limited messages"
+// @Param        thread_id query string false "Thread ID, used when the body has none"
+// @Param        stream query bool false "Stream the reply as Server-Sent Events (same as Accept: text/event-stream)"
 // @Success      200 {object} model.ChatResponse "Demo response with limited functionality"
 // @Failure      400 {object} map[string]string "Invalid request payload"
+// @Failure      403 {object} map[string]string "Backend or model override by a non-admin"
+// @Failure      404 {object} map[string]string "Thread belongs to another user"
 // @Failure      429 {object} map[string]string "Rate limit exceeded"
 // @Failure      500 {object} map[string]string "Internal server error"
 // @Router       /guest/conversation/demo-chat [post]
-func DemoChatController(c *gin.Context) {
+func (h *ChatHandler) DemoChat(c *gin.Context) {
 	var req model.ChatRequest
 
 	// Parse and validate the incoming JSON request
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Failed to bind JSON: %v", err)
+		slog.WarnContext(c.Request.Context(), "Invalid chat request", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	// Limit message count for demo users
-	if len(req.Messages) > 10 {
+	// Resolve the thread ID, generating a new one if not provided
+	threadID, ok := resolveThreadID(c, &req)
+	if !ok {
+		return
+	}
+
+	// Limit the history demo users may send. History rebuilt from a stored
+	// thread is bounded by history_max_messages instead.
+	if len(req.Messages) > demoMaxMessages {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Demo users are limited to 3 messages per conversation",
+			"error": fmt.Sprintf("Demo users are limited to %d messages per request", demoMaxMessages),
 			"message": "Please sign up for unlimited messaging",
 			"signup_url": "/api/public/register-user",
 		})
 		return
 	}
 
-	// Generate a new thread ID if not provided
-	threadID := c.Query("thread_id")
-	if threadID == "" {
-		threadID = uuid.New().String()
-	}
-
 	// Process chat through service (same as regular chat but with demo context)
+	h.reply(c, &req, threadID)
+}
+
+// reply answers a chat request on threadID, as an SSE stream when the
+// client asked for one and as a single JSON response otherwise
+func (h *ChatHandler) reply(c *gin.Context, req *model.ChatRequest, threadID string) {
 	// Validate the messages in the request
-	chatService := services.NewChatService()
-	response, err := chatService.ProcessChat(req.Messages, threadID)
+	messages, ok := h.resolveMessages(c, req, threadID)
+	if !ok {
+		return
+	}
+
+	chatService, ok := h.newChatService(c, req)
+	if !ok {
+		return
+	}
+
+	if wantsStream(c, req) {
+		streamChat(c, chatService, messages, threadID)
+		return
+	}
+
+	response, err := chatService.ProcessChat(c.Request.Context(), messages, threadID, chatOwner(c))
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
 	if err != nil {
-		log.Printf("Error processing chat: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to process chat", "thread_id", threadID, "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process chat"})
 		return
 	}
 
+	setUsageTokens(c, response.Usage)
 	c.JSON(http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// resolveThreadID picks the thread for a chat request: the body's thread_id
+// first, then the thread_id query parameter, then a freshly generated ID.
+// On failure the error response has already been written and ok is false.
+func resolveThreadID(c *gin.Context, req *model.ChatRequest) (threadID string, ok bool) {
+	bodyID := strings.TrimSpace(req.ThreadID)
+	queryID := strings.TrimSpace(c.Query("thread_id"))
+
+	if bodyID != "" && queryID != "" && bodyID != queryID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "thread_id in body and query do not match"})
+		return "", false
+	}
+
+	threadID = bodyID
+	if threadID == "" {
+		threadID = queryID
+	}
+	if threadID == "" {
+		return uuid.New().String(), true
+	}
+
+	if _, err := uuid.Parse(threadID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "thread_id must be a UUID"})
+		return "", false
+	}
+	return threadID, true
+}
+
+// resolveMessages returns the history to send upstream. Clients either send
+// the full history in messages, or a single new message whose history is
+// rebuilt from the stored thread. On failure the error response has already
+// been written and ok is false.
+func (h *ChatHandler) resolveMessages(c *gin.Context, req *model.ChatRequest, threadID string) (messages []model.GPTMessage, ok bool) {
+	switch {
+	case req.Message != nil && len(req.Messages) > 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send either message or messages, not both"})
+		return nil, false
+	case req.Message == nil && len(req.Messages) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return nil, false
+	case req.Message == nil:
+		return req.Messages, true
+	}
+
+	if req.Message.Role != "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message role must be user"})
+		return nil, false
+	}
+
+	messages, err := h.newChat().BuildHistory(threadID, chatOwner(c), *req.Message)
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load conversation history", "thread_id", threadID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process chat"})
+		return nil, false
+	}
+	return messages, true
+}
+
+// newChatService returns a ChatService on the deployment's backend, switched
+// to the backend and model named in the request when the caller is an admin.
+// On failure the error response has already been written and ok is false.
+func (h *ChatHandler) newChatService(c *gin.Context, req *model.ChatRequest) (chatService ChatService, ok bool) {
+	chatService = h.newChat()
+	chatService.UsePlan(c.GetString("plan_id"))
+	chatService.UseLanguage(requestLanguage(c, h.languages))
+	if req.Backend == "" && req.Model == "" {
+		return chatService, true
+	}
+
+	if c.GetString("user_role") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can choose the chat backend or model"})
+		return nil, false
+	}
+	if err := chatService.UseBackend(req.Backend, req.Model); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to switch chat backend", "backend", req.Backend, "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown chat backend"})
+		return nil, false
+	}
+	return chatService, true
+}
+
+// wantsStream reports whether the client asked for a Server-Sent Events reply,
+// either through the Accept header, the stream query flag or the request body.
+func wantsStream(c *gin.Context, req *model.ChatRequest) bool {
+	if req.Stream || c.Query("stream") == "true" {
+		return true
+	}
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// streamChat relays the assistant reply to the client as SSE "delta" events
+// followed by a final "done" event carrying the thread_id and usage.
+func streamChat(c *gin.Context, chatService ChatService, messages []model.GPTMessage, threadID string) {
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		metrics.ActiveStreams.Inc()
+
+		// The server's WriteTimeout is sized for ordinary replies; a stream
+		// lasts as long as the upstream keeps sending, and the upstream
+		// client ends it once the service stalls
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			slog.WarnContext(c.Request.Context(), "Failed to lift write deadline for chat stream", "thread_id", threadID, "err", err)
+		}
+	}
+
+	defer func() {
+		if started {
+			metrics.ActiveStreams.Dec()
+		}
+	}()
+
+	done, err := chatService.StreamChat(c.Request.Context(), messages, threadID, chatOwner(c), func(delta string) error {
+		start()
+		c.SSEvent("delta", model.ChatStreamDelta{Delta: delta})
+		c.Writer.Flush()
+		return c.Request.Context().Err()
+	})
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			slog.InfoContext(c.Request.Context(), "Client disconnected during chat stream", "thread_id", threadID)
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Failed to stream chat", "thread_id", threadID, "err", err)
+		if !started {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process chat"})
+			return
+		}
+		c.SSEvent("error", gin.H{"error": "Failed to process chat"})
+		c.Writer.Flush()
+		return
+	}
+
+	setUsageTokens(c, done.Usage)
+	start()
+	c.SSEvent("done", done)
+	c.Writer.Flush()
+}
+
+// chatOwner returns who the threads of a chat request belong to: the
+// signed-in user, or for guests their quota subject
+func chatOwner(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return userID
+	}
+	return services.GuestQuotaSubject(c.ClientIP())
+}
+
+// setUsageTokens hands a reply's token usage to the rate limiter, which
+// counts it against the caller's token quotas
+func setUsageTokens(c *gin.Context, usage *model.Usage) {
+	if usage != nil {
+		c.Set("usage_tokens", usage.TotalTokens)
+	}
+}
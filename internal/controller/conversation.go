@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ConversationHandler serves the conversation history routes
+type ConversationHandler struct {
+	conversations ConversationService
+}
+
+func NewConversationHandler(conversations ConversationService) *ConversationHandler {
+	return &ConversationHandler{conversations: conversations}
+}
+
+// ListConversations lists the authenticated user's conversations
+// @Summary      List conversations
+// @Description  List the authenticated user's conversation threads, most recently active first
+// @Tags         Conversation
+// @Produce      json
+// @Param        page query int false "Page number (default 1)"
+// @Param        page_size query int false "Page size (default 20, max 100)"
+// @Success      200 {object} model.ConversationListResponse "A page of conversations"
+// @Failure      400 {object} map[string]string "Invalid pagination parameters"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /user/conversation/threads [get]
+func (h *ConversationHandler) ListConversations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page parameter"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page_size parameter"})
+		return
+	}
+
+	response, err := h.conversations.ListConversations(userID.(string), page, pageSize)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list conversations", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list conversations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetConversation returns one conversation with its messages
+// @Summary      Get conversation
+// @Description  Fetch one of the authenticated user's threads with all of its messages
+// @Tags         Conversation
+// @Produce      json
+// @Param        thread_id path string true "Thread ID"
+// @Success      200 {object} model.ConversationDetailResponse "Conversation and messages"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "Conversation not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /user/conversation/threads/{thread_id} [get]
+func (h *ConversationHandler) GetConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	response, err := h.conversations.GetConversation(userID.(string), c.Param("thread_id"))
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch conversation", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RenameConversation changes the title of a conversation
+// @Summary      Rename conversation
+// @Description  Change the title of one of the authenticated user's threads
+// @Tags         Conversation
+// @Accept       json
+// @Produce      json
+// @Param        thread_id path string true "Thread ID"
+// @Param        request body model.RenameConversationRequest true "New title"
+// @Success      200 {object} model.Conversation "Renamed conversation"
+// @Failure      400 {object} map[string]string "Invalid request payload"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "Conversation not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /user/conversation/threads/{thread_id} [patch]
+func (h *ConversationHandler) RenameConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req model.RenameConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.WarnContext(c.Request.Context(), "Invalid conversation request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	conversation, err := h.conversations.RenameConversation(userID.(string), c.Param("thread_id"), req.Title)
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to rename conversation", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// DeleteConversation deletes a conversation
+// @Summary      Delete conversation
+// @Description  Delete one of the authenticated user's threads
+// @Tags         Conversation
+// @Produce      json
+// @Param        thread_id path string true "Thread ID"
+// @Success      200 {object} map[string]string "Conversation deleted"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "Conversation not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /user/conversation/threads/{thread_id} [delete]
+func (h *ConversationHandler) DeleteConversation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := h.conversations.DeleteConversation(userID.(string), c.Param("thread_id"))
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete conversation", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted successfully"})
+}
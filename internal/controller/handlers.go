@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+)
+
+// The handlers depend on these interfaces rather than on the services
+// directly, so the routes can be exercised with fakes. The services package
+// implements every one of them.
+
+// ChatService answers one chat request; see services.ChatService
+type ChatService interface {
+	UseBackend(name, model string) error
+	UsePlan(planID string)
+	UseLanguage(lang string)
+	BuildHistory(threadID, userID string, message model.GPTMessage) ([]model.GPTMessage, error)
+	ProcessChat(ctx context.Context, messages []model.GPTMessage, threadID, userID string) (*model.ChatResponse, error)
+	StreamChat(ctx context.Context, messages []model.GPTMessage, threadID, userID string, onDelta func(delta string) error) (*model.ChatStreamDone, error)
+}
+
+// STTService transcribes one request's audio; see services.STTService
+type STTService interface {
+	ForUser(userID, planID string)
+	UseLanguage(lang string)
+	ConvertSpeechToText(ctx context.Context, audioData []byte, filename string) (*services.STTResponse, error)
+}
+
+// LanguageSource picks the language to serve a request in
+type LanguageSource interface {
+	LanguageFor(userID, acceptLanguage string) string
+}
+
+// ConversationService manages the caller's stored conversations
+type ConversationService interface {
+	ListConversations(userID string, page, pageSize int) (*model.ConversationListResponse, error)
+	GetConversation(userID, threadID string) (*model.ConversationDetailResponse, error)
+	RenameConversation(userID, threadID, title string) (*model.Conversation, error)
+	DeleteConversation(userID, threadID string) error
+}
+
+// UserService registers users and manages their profiles
+type UserService interface {
+	RegisterOrUpdateUser(userID, email, displayName, googleID, avatarURL, role string) (*model.User, bool, error)
+	GetUserProfile(userID string) (*model.User, error)
+	UpdateUserProfile(user *model.User) error
+}
+
+// PreferenceService reads and updates user preferences
+type PreferenceService interface {
+	LanguageSource
+	GetPreferences(userID string) (*model.UserPreferences, error)
+	UpdatePreferences(userID string, req *model.UpdatePreferencesRequest) (*model.UserPreferences, error)
+}
+
+// UsageService reports recorded usage
+type UsageService interface {
+	Summary(userID, role string, from, to time.Time) (*model.UsageSummaryResponse, error)
+	Aggregate(groupBy string, from, to time.Time) (*model.UsageAggregateResponse, error)
+}
+
+// PlanService lists plans and assigns them to users
+type PlanService interface {
+	ListPlans() ([]model.Plan, error)
+	AssignPlan(userID, planID string) error
+}
+
+// ResponseCache is the chat response cache
+type ResponseCache interface {
+	Invalidate(backend string) (int64, error)
+}
+
+// SubscriptionService runs the upgrade flow
+type SubscriptionService interface {
+	Catalog() ([]model.Plan, error)
+	StartCheckout(ctx context.Context, userID, planID string) (*model.CheckoutSessionResponse, error)
+	Status(userID, role string) (*model.SubscriptionStatusResponse, error)
+	Cancel(ctx context.Context, userID string) (*model.Subscription, error)
+	HandleWebhook(ctx context.Context, payload []byte, header http.Header) error
+}
+
+// CheckoutSimulator completes checkouts without a real payment; see
+// services.FakePaymentProvider
+type CheckoutSimulator interface {
+	CompleteCheckout(ctx context.Context, sessionID, userID string, succeed bool) error
+}
+
+// HealthService runs the readiness checks
+type HealthService interface {
+	Readiness(ctx context.Context) *model.ReadinessResponse
+}
+
+// Handlers holds every route handler. It is built once by the application
+// container and handed to the router.
+type Handlers struct {
+	Chat          *ChatHandler
+	STT           *STTHandler
+	Conversations *ConversationHandler
+	Users         *UserHandler
+	Preferences   *PreferenceHandler
+	Usage         *UsageHandler
+	Plans         *PlanHandler
+	Cache         *CacheHandler
+	Upgrade       *UpgradeHandler
+	Health        *HealthHandler
+}
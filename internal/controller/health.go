@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	health HealthService
+}
+
+func NewHealthHandler(health HealthService) *HealthHandler {
+	return &HealthHandler{health: health}
+}
+
+// Livez reports that the process is up and serving requests. Dependencies
+// are not checked; see Readyz.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, model.LivenessResponse{Status: "alive"})
+}
+
+// Readyz reports each dependency check with its latency, and answers 503
+// when a required one fails. The probes live outside /api, so they are not
+// part of the Swagger docs.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	readiness := h.health.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if readiness.Status != model.ReadinessReady {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// PlanHandler serves the plan administration routes
+type PlanHandler struct {
+	plans PlanService
+}
+
+func NewPlanHandler(plans PlanService) *PlanHandler {
+	return &PlanHandler{plans: plans}
+}
+
+// ListPlans lists the plans and their limits
+// @Summary      List plans
+// @Description  List every plan with its per-route-group rate limits and quotas. Admins only.
+// @Tags         Admin
+// @Produce      json
+// @Success      200 {object} model.PlanListResponse "Plans, least restricted last"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      403 {object} map[string]string "Not an admin"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /admin/plans [get]
+func (h *PlanHandler) ListPlans(c *gin.Context) {
+	plans, err := h.plans.ListPlans()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list plans", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.PlanListResponse{Plans: plans})
+}
+
+// AssignPlan moves a user to another plan
+// @Summary      Assign a plan to a user
+// @Description  Set the plan whose limits apply to a user. Admins only.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        user_id path string true "User ID"
+// @Param        request body model.AssignPlanRequest true "Plan to assign"
+// @Success      200 {object} map[string]string "Plan assigned"
+// @Failure      400 {object} map[string]string "Invalid request payload"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      403 {object} map[string]string "Not an admin"
+// @Failure      404 {object} map[string]string "Plan not found"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /admin/users/{user_id}/plan [put]
+func (h *PlanHandler) AssignPlan(c *gin.Context) {
+	userID := c.Param("user_id")
+
+	var req model.AssignPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.WarnContext(c.Request.Context(), "Invalid plan request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	err := h.plans.AssignPlan(userID, req.PlanID)
+	if errors.Is(err, services.ErrPlanNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to assign plan", "plan_id", req.PlanID, "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign plan"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Plan assigned", "plan_id", req.PlanID, "user_id", userID, "by", c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Plan assigned successfully",
+		"user_id": userID,
+		"plan_id": req.PlanID,
+	})
+}
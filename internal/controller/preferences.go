@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/EyeQuila/eyeQcheck/internal/i18n"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// PreferenceHandler serves the preference routes
+type PreferenceHandler struct {
+	preferences PreferenceService
+}
+
+func NewPreferenceHandler(preferences PreferenceService) *PreferenceHandler {
+	return &PreferenceHandler{preferences: preferences}
+}
+
+// GetPreferences returns the caller's preferences
+// @Summary      Get preferences
+// @Description  Return the caller's language, notification and theme preferences
+// @Tags         Profile
+// @Produce      json
+// @Success      200 {object} model.UserPreferences "Current preferences"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "User not registered"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /profile/preferences [get]
+func (h *PreferenceHandler) GetPreferences(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	preferences, err := h.preferences.GetPreferences(userID)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch preferences", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// UpdatePreferences changes some of the caller's preferences
+// @Summary      Update preferences
+// @Description  Change the caller's language, notification or theme preferences; omitted fields are left as they are. The language is used for speech-to-text, the assistant's replies and error messages.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        request body model.UpdatePreferencesRequest true "Preferences to change"
+// @Success      200 {object} model.UserPreferences "Updated preferences"
+// @Failure      400 {object} map[string]string "Invalid request payload, unsupported language or invalid theme"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "User not registered"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /profile/preferences [patch]
+func (h *PreferenceHandler) UpdatePreferences(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req model.UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.WarnContext(c.Request.Context(), "Invalid preferences request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	preferences, err := h.preferences.UpdatePreferences(userID, &req)
+	switch {
+	case errors.Is(err, services.ErrUnsupportedLanguage):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Unsupported language",
+			"supported": i18n.Languages(),
+		})
+		return
+	case errors.Is(err, services.ErrInvalidTheme):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Theme must be light, dark or system"})
+		return
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to update preferences", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// requestLanguage returns the language to serve the caller in, "" when
+// neither their preferences nor Accept-Language name a supported one
+func requestLanguage(c *gin.Context, languages LanguageSource) string {
+	return languages.LanguageFor(c.GetString("user_id"), c.GetHeader("Accept-Language"))
+}
@@ -1,18 +1,28 @@
 package controller
 
 import (
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 
-	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
 	"github.com/gin-gonic/gin"
 )
 
-// SpeechToTextController transcribes audio to text
-// @Summary      Convert speech to text
-// @Description  Upload audio file and get transcribed text
-// SpeechToTextController transcribes audio to text
+// STTHandler serves the speech-to-text routes
+type STTHandler struct {
+	newSTT    func() STTService
+	languages LanguageSource
+}
+
+// NewSTTHandler returns a speech-to-text handler that builds an STT service
+// with newSTT for every request and hints the language languages picks
+func NewSTTHandler(newSTT func() STTService, languages LanguageSource) *STTHandler {
+	return &STTHandler{newSTT: newSTT, languages: languages}
+}
+
+// SpeechToText transcribes audio to text
 // @Summary      Convert speech to text
 // @Description  Upload audio file and get transcribed text using Whisper API
 // @Tags         Conversation
@@ -22,13 +32,14 @@ import (
 // @Success      200 {object} model.STTResponse "Returns transcribed text and filename"
 // @Failure      400 {object} map[string]string
 // @Failure      500 {object} map[string]string
+// @Failure      503 {object} map[string]string
 // @Router       /conversation/speech-to-text [post]
-func SpeechToTextController(c *gin.Context) {
+func (h *STTHandler) SpeechToText(c *gin.Context) {
 	// Get uploaded file
 	file, header, err := c.Request.FormFile("audio")
 	// println("Received file:", file, "Header:", header.Filename)
 	if err != nil {
-		log.Printf("FormFile error: %v", err)
+		slog.WarnContext(c.Request.Context(), "Missing audio file", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Audio file required"})
 		return
 	}
@@ -36,27 +47,36 @@ func SpeechToTextController(c *gin.Context) {
 
 	audioData, err := io.ReadAll(file)
 	if err != nil {
-		log.Printf("ReadAll error: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to read audio file", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audio file"})
 		return
 	}
 
 	// Process through STT service
-	sttService := services.NewSTTService()
-	whisperRes, err := sttService.ConvertSpeechToText(audioData, header.Filename)
+	sttService := h.newSTT()
+	sttService.ForUser(c.GetString("user_id"), c.GetString("plan_id"))
+	sttService.UseLanguage(requestLanguage(c, h.languages))
+	whisperRes, err := sttService.ConvertSpeechToText(c.Request.Context(), audioData, header.Filename)
+	if errors.Is(err, upstream.ErrCircuitOpen) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Speech-to-text is temporarily unavailable, please try again in a minute"})
+		return
+	}
 	if err != nil {
-		log.Printf("STT service error: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to transcribe audio", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process audio file"})
 		return
 	}
 
+	// Counted against the caller's STT-minute quota by the rate limiter
+	c.Set("audio_seconds", whisperRes.Duration)
+
 	c.JSON(http.StatusOK, gin.H{
-		"text":     whisperRes,
+		"text":     whisperRes.Text,
 		"filename": header.Filename,
 	})
 }
 
-// DemoSpeechToTextController handles demo speech-to-text requests for non-logged-in users
+// DemoSpeechToText handles demo speech-to-text requests for non-logged-in users
 // @Summary      Demo speech-to-text for guests
 // @Description  Limited speech-to-text functionality for non-logged-in users (demo/trial)
 // @Tags         Demo
@@ -66,13 +86,14 @@ func SpeechToTextController(c *gin.Context) {
 // @Success      200 {object} model.STTResponse "Returns transcribed text and filename"
 // @Failure      400 {object} map[string]string
 // @Failure      500 {object} map[string]string
+// @Failure      503 {object} map[string]string
 // @Router       /guest/conversation/speech-to-text [post]
-func DemoSpeechToTextController(c *gin.Context) {
+func (h *STTHandler) DemoSpeechToText(c *gin.Context) {
 	// Get uploaded file
 	file, header, err := c.Request.FormFile("audio")
 	// println("Received file:", file, "Header:", header.Filename)
 	if err != nil {
-		log.Printf("FormFile error: %v", err)
+		slog.WarnContext(c.Request.Context(), "Missing audio file", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Audio file required"})
 		return
 	}
@@ -80,22 +101,31 @@ func DemoSpeechToTextController(c *gin.Context) {
 
 	audioData, err := io.ReadAll(file)
 	if err != nil {
-		log.Printf("ReadAll error: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to read audio file", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audio file"})
 		return
 	}
 
 	// Process through STT service
-	sttService := services.NewSTTService()
-	whisperRes, err := sttService.ConvertSpeechToText(audioData, header.Filename)
+	sttService := h.newSTT()
+	sttService.ForUser(c.GetString("user_id"), c.GetString("plan_id"))
+	sttService.UseLanguage(requestLanguage(c, h.languages))
+	whisperRes, err := sttService.ConvertSpeechToText(c.Request.Context(), audioData, header.Filename)
+	if errors.Is(err, upstream.ErrCircuitOpen) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Speech-to-text is temporarily unavailable, please try again in a minute"})
+		return
+	}
 	if err != nil {
-		log.Printf("STT service error: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to transcribe audio", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process audio file"})
 		return
 	}
 
+	// Counted against the caller's STT-minute quota by the rate limiter
+	c.Set("audio_seconds", whisperRes.Duration)
+
 	c.JSON(http.StatusOK, gin.H{
-		"text":     whisperRes,
+		"text":     whisperRes.Text,
 		"filename": header.Filename,
 	})
 }
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBytes bounds the size of payment webhook payloads
+const maxWebhookBytes = 64 << 10
+
+// UpgradeHandler serves the upgrade flow
+type UpgradeHandler struct {
+	subscriptions SubscriptionService
+	checkout      CheckoutSimulator
+}
+
+// NewUpgradeHandler returns an upgrade handler. checkout is nil unless the
+// fake payment provider is in use outside release mode, which hides the
+// fake checkout page.
+func NewUpgradeHandler(subscriptions SubscriptionService, checkout CheckoutSimulator) *UpgradeHandler {
+	return &UpgradeHandler{subscriptions: subscriptions, checkout: checkout}
+}
+
+// SimulatesCheckout reports whether the fake checkout page is served
+func (h *UpgradeHandler) SimulatesCheckout() bool {
+	return h.checkout != nil
+}
+
+// UpgradeCatalog lists the plans that can be bought
+// @Summary      List purchasable plans
+// @Description  List the paid plans with their prices and limits. This is where rate-limited users are sent to upgrade.
+// @Tags         Upgrade
+// @Produce      json
+// @Success      200 {object} model.UpgradeCatalogResponse "Purchasable plans, cheapest first"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /public/upgrade [get]
+func (h *UpgradeHandler) UpgradeCatalog(c *gin.Context) {
+	plans, err := h.subscriptions.Catalog()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to list upgrade catalog", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list plans"})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.UpgradeCatalogResponse{Plans: plans})
+}
+
+// CreateCheckoutSession starts buying a plan
+// @Summary      Start a checkout
+// @Description  Create a pending subscription and a payment checkout session for a paid plan. Send the user to checkout_url to pay.
+// @Tags         Upgrade
+// @Accept       json
+// @Produce      json
+// @Param        request body model.CheckoutSessionRequest true "Plan to buy"
+// @Success      201 {object} model.CheckoutSessionResponse "Checkout started"
+// @Failure      400 {object} map[string]string "Invalid request payload or plan cannot be bought"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "Plan not found"
+// @Failure      409 {object} map[string]string "Already subscribed to this plan"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Failure      503 {object} map[string]string "Upgrades are not available"
+// @Router       /public/upgrade/checkout-session [post]
+func (h *UpgradeHandler) CreateCheckoutSession(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req model.CheckoutSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.WarnContext(c.Request.Context(), "Invalid checkout request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	session, err := h.subscriptions.StartCheckout(c.Request.Context(), userID, req.PlanID)
+	switch {
+	case errors.Is(err, services.ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return
+	case errors.Is(err, services.ErrPlanNotPurchasable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This plan cannot be purchased"})
+		return
+	case errors.Is(err, services.ErrAlreadySubscribed):
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already subscribed to this plan"})
+		return
+	case errors.Is(err, services.ErrPaymentsDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Upgrades are not available"})
+		return
+	case err != nil:
+		slog.ErrorContext(c.Request.Context(), "Failed to start checkout", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start checkout"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// SubscriptionStatus returns the caller's plan and subscription
+// @Summary      Get subscription status
+// @Description  Return the caller's current plan and their most recent subscription, if any
+// @Tags         Upgrade
+// @Produce      json
+// @Success      200 {object} model.SubscriptionStatusResponse "Current plan and subscription"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /public/upgrade/subscription [get]
+func (h *UpgradeHandler) SubscriptionStatus(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	status, err := h.subscriptions.Status(userID, c.GetString("user_role"))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch subscription status", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscription status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// CancelSubscription cancels the caller's active subscription
+// @Summary      Cancel subscription
+// @Description  Cancel the caller's active subscription. The caller moves back to their default plan immediately.
+// @Tags         Upgrade
+// @Produce      json
+// @Success      200 {object} model.Subscription "Canceled subscription"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "No active subscription"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /public/upgrade/cancel [post]
+func (h *UpgradeHandler) CancelSubscription(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	subscription, err := h.subscriptions.Cancel(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrNoActiveSubscription) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active subscription"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to cancel subscription", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel subscription"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// PaymentWebhook receives signed callbacks from the payment provider
+// @Summary      Payment provider webhook
+// @Description  Receive a signed payment event (checkout completed or failed, subscription canceled) and apply it to the user's plan
+// @Tags         Upgrade
+// @Accept       json
+// @Produce      json
+// @Param        X-Webhook-Signature header string true "t=<unix seconds>,v1=<hex HMAC-SHA256>"
+// @Success      200 {object} map[string]string "Event applied"
+// @Failure      400 {object} map[string]string "Invalid payload"
+// @Failure      401 {object} map[string]string "Invalid signature"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /public/upgrade/webhook [post]
+func (h *UpgradeHandler) PaymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	err = h.subscriptions.HandleWebhook(c.Request.Context(), payload, c.Request.Header)
+	if errors.Is(err, services.ErrPaymentsDisabled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidWebhookSignature) {
+		slog.WarnContext(c.Request.Context(), "Rejected payment webhook", "err", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+	if err != nil {
+		// A 5xx makes the provider retry the delivery later
+		slog.ErrorContext(c.Request.Context(), "Failed to handle payment webhook", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook received"})
+}
+
+// FakeCheckout completes a checkout with the fake payment provider
+// @Summary      Fake checkout page
+// @Description  Development stand-in for a provider's checkout page. Visiting it "pays" for one of the caller's own checkout sessions and sends the signed webhook; pass outcome=fail to simulate a declined payment. Only served with PAYMENT_PROVIDER=fake outside release mode.
+// @Tags         Upgrade
+// @Produce      json
+// @Param        session_id path string true "Checkout session ID"
+// @Param        outcome query string false "success (default) or fail"
+// @Success      200 {object} map[string]string "Payment simulated and webhook delivered"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "Unknown session"
+// @Failure      502 {object} map[string]string "Webhook delivery failed"
+// @Router       /public/upgrade/fake-checkout/{session_id} [get]
+func (h *UpgradeHandler) FakeCheckout(c *gin.Context) {
+	succeed := c.Query("outcome") != "fail"
+	err := h.checkout.CompleteCheckout(c.Request.Context(), c.Param("session_id"), c.GetString("user_id"), succeed)
+	if errors.Is(err, services.ErrCheckoutSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checkout session not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Fake checkout webhook failed", "err", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to deliver payment webhook"})
+		return
+	}
+
+	message := "Payment completed"
+	if !succeed {
+		message = "Payment declined"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
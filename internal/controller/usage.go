@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// UsageHandler serves the usage reports
+type UsageHandler struct {
+	usage UsageService
+}
+
+func NewUsageHandler(usage UsageService) *UsageHandler {
+	return &UsageHandler{usage: usage}
+}
+
+// GetUsage returns the caller's token and audio usage
+// @Summary      Get my usage
+// @Description  Return the caller's token and speech-to-text usage over a time range, per thread and per plan, with the current plan's quotas. The range defaults to the current month.
+// @Tags         Profile
+// @Produce      json
+// @Param        from query string false "Start of the range, RFC 3339 or YYYY-MM-DD (default: start of this month)"
+// @Param        to query string false "End of the range, exclusive, RFC 3339 or YYYY-MM-DD (default: now)"
+// @Success      200 {object} model.UsageSummaryResponse "Usage summary"
+// @Failure      400 {object} map[string]string "Invalid time range"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /profile/usage [get]
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	from, to, ok := usageRange(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.usage.Summary(userID, c.GetString("user_role"), from, to)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch usage", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// AdminUsage aggregates the usage of all users
+// @Summary      Aggregate usage
+// @Description  Return token and speech-to-text usage of all users over a time range, grouped by user, plan, thread, kind, backend, model or day. Admins only.
+// @Tags         Admin
+// @Produce      json
+// @Param        group_by query string false "Dimension to group by" Enums(user, plan, thread, kind, backend, model, day) default(user)
+// @Param        from query string false "Start of the range, RFC 3339 or YYYY-MM-DD (default: start of this month)"
+// @Param        to query string false "End of the range, exclusive, RFC 3339 or YYYY-MM-DD (default: now)"
+// @Success      200 {object} model.UsageAggregateResponse "Usage per group, highest token use first"
+// @Failure      400 {object} map[string]string "Invalid time range or group"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      403 {object} map[string]string "Not an admin"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /admin/usage [get]
+func (h *UsageHandler) AdminUsage(c *gin.Context) {
+	from, to, ok := usageRange(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.usage.Aggregate(c.DefaultQuery("group_by", services.UsageGroupUser), from, to)
+	if errors.Is(err, services.ErrInvalidUsageGroup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be one of user, plan, thread, kind, backend, model or day"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to aggregate usage", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to aggregate usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// usageRange parses the from and to query parameters, defaulting to the
+// start of the current month until now. On failure the error response has
+// already been written and ok is false.
+func usageRange(c *gin.Context) (from, to time.Time, ok bool) {
+	now := time.Now().UTC()
+	from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to = now
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = parseUsageTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, use RFC 3339 or YYYY-MM-DD"})
+			return from, to, false
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = parseUsageTime(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, use RFC 3339 or YYYY-MM-DD"})
+			return from, to, false
+		}
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func parseUsageTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -1,7 +1,8 @@
 package controller
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/EyeQuila/eyeQcheck/internal/model"
@@ -9,9 +10,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// RegisterUserController handles user registration from external OAuth system
+// UserHandler serves the user registration and profile routes
+type UserHandler struct {
+	users UserService
+}
+
+func NewUserHandler(users UserService) *UserHandler {
+	return &UserHandler{users: users}
+}
+
+// RegisterUser handles user registration from external OAuth system. The
+// user is the subject of the caller's token, so callers can only register
+// or update themselves.
 // @Summary      Register user from external OAuth system
-// @Description  Register or update user information from external OAuth system (Google, etc.)
+// @Description  Register or update the signed-in user with information from external OAuth system (Google, etc.)
 // @Tags         User
 // @Accept       json
 // @Produce      json
@@ -19,32 +31,48 @@ import (
 // @Success      200 {object} model.RegisterUserResponse "User registered/updated successfully"
 // @Success      201 {object} model.RegisterUserResponse "New user created successfully"
 // @Failure      400 {object} map[string]string "Invalid request payload"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      403 {object} map[string]string "user_id is not the token's subject"
+// @Failure      409 {object} map[string]string "Email belongs to another user"
 // @Failure      500 {object} map[string]string "Internal server error"
 // @Router       /public/register-user [post]
-func RegisterUserController(c *gin.Context) {
+func (h *UserHandler) RegisterUser(c *gin.Context) {
 	var req model.RegisterUserRequest
 
 	// Parse and validate the incoming JSON request
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Failed to bind JSON: %v", err)
+		slog.WarnContext(c.Request.Context(), "Invalid user request", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	log.Printf("Registering user: %s (%s)", req.DisplayName, req.Email)
+	// The token decides who is registered. A user_id in the body is only
+	// accepted as a cross-check.
+	userID := c.GetString("user_id")
+	if req.UserID != "" && req.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user_id does not match the signed-in user"})
+		return
+	}
+
+	slog.DebugContext(c.Request.Context(), "Registering user", "user_id", userID, "display_name", req.DisplayName, "email", req.Email)
 
-	// Process user registration through service
-	userService := services.NewUserService()
-	user, isNewUser, err := userService.RegisterOrUpdateUser(
-		req.UserID,
+	// Process user registration through service. The route is public, so
+	// it only ever creates plain users; admins are granted with "user
+	// set-role".
+	user, isNewUser, err := h.users.RegisterOrUpdateUser(
+		userID,
 		req.Email,
 		req.DisplayName,
 		req.GoogleID,
 		req.AvatarURL,
-		req.Role,
+		services.RoleUser,
 	)
+	if errors.Is(err, services.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered to another user"})
+		return
+	}
 	if err != nil {
-		log.Printf("Error registering user: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to register user", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 		return
 	}
@@ -60,19 +88,21 @@ func RegisterUserController(c *gin.Context) {
 		IsNewUser: isNewUser,
 	}
 
-	log.Printf("User registration completed: %s (new: %v)", user.ID, isNewUser)
+	slog.InfoContext(c.Request.Context(), "User registration completed", "user_id", user.ID, "new", isNewUser)
 	c.JSON(statusCode, response)
 }
 
-// GetUserProfileController retrieves the authenticated user's profile
+// GetUserProfile retrieves the authenticated user's profile
 // @Summary      Get user profile
 // @Description  Retrieve the profile information of the authenticated user
 // @Tags         User
 // @Produce      json
 // @Success      200 {object} model.User "Returns user profile information"
 // @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "User not registered"
 // @Failure      500 {object} map[string]string "Internal server error"
-func GetUserProfileController(c *gin.Context) {
+// @Router       /profile [get]
+func (h *UserHandler) GetUserProfile(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -80,13 +110,16 @@ func GetUserProfileController(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Fetching profile for user: %s", userID)
+	slog.DebugContext(c.Request.Context(), "Fetching user profile", "user_id", userID)
 
 	// Fetch user profile from service
-	userService := services.NewUserService()
-	user, err := userService.GetUserProfile(userID.(string))
+	user, err := h.users.GetUserProfile(userID.(string))
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
 	if err != nil {
-		log.Printf("Error fetching user profile: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to fetch user profile", "user_id", userID, "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user profile"})
 		return
 	}
@@ -94,7 +127,21 @@ func GetUserProfileController(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-func UpdateUserProfileController(c *gin.Context) {
+// UpdateUserProfile updates the authenticated user's profile
+// @Summary      Update user profile
+// @Description  Update the email, display name, Google ID and avatar of the authenticated user
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        request body model.UpdateUserProfileRequest true "New profile information"
+// @Success      200 {object} map[string]string "Profile updated"
+// @Failure      400 {object} map[string]string "Invalid request payload"
+// @Failure      401 {object} map[string]string "Unauthorized"
+// @Failure      404 {object} map[string]string "User not registered"
+// @Failure      409 {object} map[string]string "Email belongs to another user"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /profile [put]
+func (h *UserHandler) UpdateUserProfile(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -104,15 +151,14 @@ func UpdateUserProfileController(c *gin.Context) {
 
 	var req model.UpdateUserProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.Printf("Failed to bind JSON: %v", err)
+		slog.WarnContext(c.Request.Context(), "Invalid user request", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	log.Printf("Updating profile for user: %s", userID)
+	slog.DebugContext(c.Request.Context(), "Updating user profile", "user_id", userID)
 
 	// Update user profile through service
-	userService := services.NewUserService()
 	user := &model.User{
 		ID:          userID.(string),
 		Email:       req.Email,
@@ -121,9 +167,17 @@ func UpdateUserProfileController(c *gin.Context) {
 		AvatarURL:   req.AvatarURL,
 		Role:        req.Role,
 	}
-	err := userService.UpdateUserProfile(user)
+	err := h.users.UpdateUserProfile(user)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if errors.Is(err, services.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered to another user"})
+		return
+	}
 	if err != nil {
-		log.Printf("Error updating user profile: %v", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to update user profile", "user_id", userID, "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user profile"})
 		return
 	}
@@ -1,35 +1,68 @@
 package database
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 
 	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/tracing"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 // DB is the global database connection
 var DB *gorm.DB
-// Init initializes the database connection
-func Init() {
-	cfg := config.Load()
+
+// Init initializes the database connection. The schema is managed by the
+// versioned migrations in migrations/; see Migrator.
+func Init(cfg *config.Config) error {
 	dsn := cfg.DatabaseURL
 
 	var err error
 	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := DB.Use(tracing.GormPlugin{}); err != nil {
+		return fmt.Errorf("failed to install query tracing: %w", err)
 	}
 
-	log.Println("Database connection established")
+	slog.Info("Database connection established")
+	return nil
+}
 
-	// Migrate the schema
-	err = DB.AutoMigrate(
-		// Add your models here
-	)
+// CheckSchema returns ErrSchemaOutdated when the database is missing
+// migrations this build depends on
+func CheckSchema() error {
+	migrator, err := NewMigrator(DB)
 	if err != nil {
-		log.Fatalf("Failed to migrate database schema: %v", err)
+		return err
 	}
+	return migrator.CheckSchema()
+}
 
-	log.Println("Database schema migrated successfully")
-}
\ No newline at end of file
+// Close closes the connection pool, waiting for queries in progress
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Ping checks that db answers, using a connection from its pool
+func Ping(ctx context.Context, db *gorm.DB) error {
+	if db == nil {
+		return errors.New("database not initialized")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
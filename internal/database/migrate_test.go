@@ -0,0 +1,218 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testMigrations create two tables and add a column to the first, with a
+// gap in the versions
+var testMigrations = fstest.MapFS{
+	"migrations/0001_notes.up.sql":       {Data: []byte("CREATE TABLE notes (id integer PRIMARY KEY)")},
+	"migrations/0001_notes.down.sql":     {Data: []byte("DROP TABLE notes")},
+	"migrations/0002_note_body.up.sql":   {Data: []byte("ALTER TABLE notes ADD COLUMN body text")},
+	"migrations/0002_note_body.down.sql": {Data: []byte("ALTER TABLE notes DROP COLUMN body")},
+	"migrations/0010_tags.up.sql":        {Data: []byte("CREATE TABLE tags (id integer PRIMARY KEY)")},
+	"migrations/0010_tags.down.sql":      {Data: []byte("DROP TABLE tags")},
+	"migrations/README.md":               {Data: []byte("not a migration")},
+}
+
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// SQLite only reads back times from columns declared as datetime, so
+	// the bookkeeping table is created ahead of the migrator
+	if err := db.Exec(`CREATE TABLE schema_migrations (
+    version    bigint PRIMARY KEY,
+    name       varchar(255) NOT NULL,
+    applied_at datetime NOT NULL
+)`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := loadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	return &Migrator{db: db, migrations: migrations}
+}
+
+func versions(migrations []Migration) []int64 {
+	v := make([]int64, len(migrations))
+	for i, m := range migrations {
+		v[i] = m.Version
+	}
+	return v
+}
+
+func equalVersions(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMigratorUpAndDown(t *testing.T) {
+	m := newTestMigrator(t, testMigrations)
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if got := versions(applied); !equalVersions(got, []int64{1, 2, 10}) {
+		t.Errorf("applied %v, want [1 2 10] in order", got)
+	}
+	if err := m.db.Exec("INSERT INTO notes (id, body) VALUES (1, 'hi')").Error; err != nil {
+		t.Errorf("schema after Up: %v", err)
+	}
+	if err := m.CheckSchema(); err != nil {
+		t.Errorf("CheckSchema after Up: %v", err)
+	}
+
+	// Applied migrations are not run again
+	applied, err = m.Up()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second Up = %v, %v; want nothing applied", versions(applied), err)
+	}
+
+	// Down reverts newest first
+	for _, want := range []int64{10, 2, 1} {
+		reverted, err := m.Down()
+		if err != nil {
+			t.Fatalf("Down: %v", err)
+		}
+		if reverted.Version != want {
+			t.Errorf("reverted %d, want %d", reverted.Version, want)
+		}
+	}
+	if _, err := m.Down(); !errors.Is(err, ErrNoMigrationApplied) {
+		t.Errorf("Down on an empty database: err = %v, want ErrNoMigrationApplied", err)
+	}
+	if err := m.CheckSchema(); !errors.Is(err, ErrSchemaOutdated) {
+		t.Errorf("CheckSchema after Down: err = %v, want ErrSchemaOutdated", err)
+	}
+}
+
+func TestMigratorRedo(t *testing.T) {
+	m := newTestMigrator(t, testMigrations)
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	redone, err := m.Redo()
+	if err != nil || redone.Version != 10 {
+		t.Fatalf("Redo = %+v, %v", redone, err)
+	}
+	if version, err := m.Version(); err != nil || version != 10 {
+		t.Errorf("Version after Redo = %d, %v; want 10", version, err)
+	}
+}
+
+func TestMigratorFailedMigrationIsRolledBack(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, file := range testMigrations {
+		fsys[name] = file
+	}
+	// The second statement fails after the first has run
+	fsys["migrations/0002_note_body.up.sql"] = &fstest.MapFile{
+		Data: []byte("ALTER TABLE notes ADD COLUMN body text; ALTER TABLE missing ADD COLUMN x text"),
+	}
+	m := newTestMigrator(t, fsys)
+
+	applied, err := m.Up()
+	if err == nil {
+		t.Fatal("Up succeeded with a broken migration")
+	}
+	if got := versions(applied); !equalVersions(got, []int64{1}) {
+		t.Errorf("applied %v, want [1]: Up must stop at the failure", got)
+	}
+
+	// Nothing of the failed migration is left behind or recorded
+	if version, err := m.Version(); err != nil || version != 1 {
+		t.Errorf("Version = %d, %v; want 1", version, err)
+	}
+	pending, err := m.Pending()
+	if err != nil || !equalVersions(versions(pending), []int64{2, 10}) {
+		t.Errorf("Pending = %v, %v; want [2 10]", versions(pending), err)
+	}
+	if err := m.db.Exec("INSERT INTO notes (id, body) VALUES (1, 'hi')").Error; err == nil {
+		t.Error("column of the failed migration was kept")
+	}
+}
+
+func TestMigratorUnknownAppliedVersion(t *testing.T) {
+	m := newTestMigrator(t, testMigrations)
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	// A newer build applied a migration this one does not have
+	if err := m.db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (11, 'future', CURRENT_TIMESTAMP)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if last := statuses[len(statuses)-1]; last.Version != 11 || last.Name != "future" || last.AppliedAt == nil {
+		t.Errorf("Status lists %+v last, want the unknown migration", last)
+	}
+	if err := m.CheckSchema(); err != nil {
+		t.Errorf("CheckSchema with a newer schema: %v", err)
+	}
+	if _, err := m.Down(); err == nil {
+		t.Error("Down reverted a migration it has no SQL for")
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"missing down": {
+			"migrations/0001_notes.up.sql": {Data: []byte("SELECT 1")},
+		},
+		"no version": {
+			"migrations/notes.up.sql":   {Data: []byte("SELECT 1")},
+			"migrations/notes.down.sql": {Data: []byte("SELECT 1")},
+		},
+		"two names": {
+			"migrations/0001_notes.up.sql":   {Data: []byte("SELECT 1")},
+			"migrations/0001_tags.down.sql":  {Data: []byte("SELECT 1")},
+			"migrations/0001_notes.down.sql": {Data: []byte("SELECT 1")},
+		},
+	} {
+		if _, err := loadMigrations(fsys, "migrations"); err == nil {
+			t.Errorf("%s: loadMigrations succeeded", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s at position %d: versions must be consecutive", m.Version, m.Name, i)
+		}
+	}
+}
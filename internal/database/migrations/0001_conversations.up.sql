@@ -0,0 +1,33 @@
+-- Conversations and their messages. IF NOT EXISTS lets databases created by
+-- the former GORM AutoMigrate adopt this migration unchanged.
+CREATE TABLE IF NOT EXISTS conversations (
+    id             varchar(64) PRIMARY KEY,
+    user_id        varchar(128),
+    title          text,
+    candidate_name text,
+    position       text,
+    interview_date text,
+    status         text,
+    created_at     timestamptz,
+    updated_at     timestamptz,
+    deleted_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations (user_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations (updated_at);
+CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at ON conversations (deleted_at);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id                 bigserial PRIMARY KEY,
+    conversation_id    varchar(64) NOT NULL,
+    role               varchar(16) NOT NULL,
+    content            text,
+    created_at         timestamptz,
+    backend            varchar(32),
+    model              varchar(128),
+    upstream_thread_id varchar(64),
+    prompt_tokens      bigint,
+    completion_tokens  bigint,
+    latency_ms         bigint,
+    cached             boolean
+);
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages (conversation_id);
@@ -0,0 +1,11 @@
+-- Persisted entries of the chat response cache
+CREATE TABLE IF NOT EXISTS cached_responses (
+    cache_key  varchar(64) PRIMARY KEY,
+    backend    varchar(32),
+    model      varchar(128),
+    reply      text,
+    created_at timestamptz,
+    expires_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_cached_responses_backend ON cached_responses (backend);
+CREATE INDEX IF NOT EXISTS idx_cached_responses_expires_at ON cached_responses (expires_at);
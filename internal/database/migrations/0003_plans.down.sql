@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS quota_usages;
+DROP TABLE IF EXISTS user_plans;
+DROP TABLE IF EXISTS plan_limits;
+DROP TABLE IF EXISTS plans;
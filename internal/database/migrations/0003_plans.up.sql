@@ -0,0 +1,45 @@
+-- Plans, their per-route-group limits, plan assignments and quota usage
+CREATE TABLE IF NOT EXISTS plans (
+    id          varchar(32) PRIMARY KEY,
+    name        varchar(100) NOT NULL,
+    description text,
+    rank        bigint,
+    price_cents bigint,
+    currency    varchar(3),
+    created_at  timestamptz,
+    updated_at  timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS plan_limits (
+    id                  bigserial PRIMARY KEY,
+    plan_id             varchar(32) NOT NULL,
+    route_group         varchar(32) NOT NULL,
+    requests_per_minute bigint,
+    burst               bigint,
+    daily_messages      bigint,
+    monthly_messages    bigint,
+    daily_tokens        bigint,
+    monthly_tokens      bigint,
+    daily_stt_minutes   decimal,
+    monthly_stt_minutes decimal,
+    CONSTRAINT fk_plans_limits FOREIGN KEY (plan_id) REFERENCES plans (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plan_limit_group ON plan_limits (plan_id, route_group);
+
+CREATE TABLE IF NOT EXISTS user_plans (
+    user_id    varchar(64) PRIMARY KEY,
+    plan_id    varchar(32) NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_user_plans_plan_id ON user_plans (plan_id);
+
+CREATE TABLE IF NOT EXISTS quota_usages (
+    subject     varchar(128),
+    route_group varchar(32),
+    metric      varchar(32),
+    period      varchar(16),
+    amount      decimal NOT NULL DEFAULT 0,
+    updated_at  timestamptz,
+    PRIMARY KEY (subject, route_group, metric, period)
+);
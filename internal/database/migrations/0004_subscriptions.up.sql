@@ -0,0 +1,18 @@
+-- Paid plan subscriptions created by the upgrade flow
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id                       varchar(64) PRIMARY KEY,
+    user_id                  varchar(64) NOT NULL,
+    plan_id                  varchar(32) NOT NULL,
+    status                   varchar(16) NOT NULL,
+    provider                 varchar(32) NOT NULL,
+    checkout_session_id      varchar(128),
+    provider_subscription_id varchar(128),
+    current_period_end       timestamptz,
+    canceled_at              timestamptz,
+    created_at               timestamptz,
+    updated_at               timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_id ON subscriptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_status ON subscriptions (status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_checkout_session_id ON subscriptions (checkout_session_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_provider_subscription_id ON subscriptions (provider_subscription_id);
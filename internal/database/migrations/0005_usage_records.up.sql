@@ -0,0 +1,21 @@
+-- Token and audio usage per chat reply and transcription
+CREATE TABLE IF NOT EXISTS usage_records (
+    id                bigserial PRIMARY KEY,
+    user_id           varchar(64),
+    thread_id         varchar(64),
+    plan_id           varchar(32),
+    kind              varchar(16) NOT NULL,
+    backend           varchar(32),
+    model             varchar(100),
+    prompt_tokens     bigint,
+    completion_tokens bigint,
+    total_tokens      bigint,
+    audio_seconds     decimal,
+    estimated         boolean,
+    cached            boolean,
+    created_at        timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_usage_user_created ON usage_records (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_records_thread_id ON usage_records (thread_id);
+CREATE INDEX IF NOT EXISTS idx_usage_records_plan_id ON usage_records (plan_id);
+CREATE INDEX IF NOT EXISTS idx_usage_records_created_at ON usage_records (created_at);
@@ -0,0 +1,25 @@
+-- Registered users and their preferences
+CREATE TABLE IF NOT EXISTS users (
+    id            varchar(128) PRIMARY KEY,
+    email         varchar(255) NOT NULL,
+    display_name  varchar(255),
+    google_id     varchar(128),
+    avatar_url    text,
+    role          varchar(32) NOT NULL DEFAULT 'user',
+    is_active     boolean NOT NULL,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    last_login_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_google_id ON users (google_id);
+
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id             varchar(128) PRIMARY KEY,
+    language            varchar(8) NOT NULL,
+    notifications_email boolean,
+    notifications_push  boolean,
+    theme_preference    varchar(16),
+    created_at          timestamptz,
+    updated_at          timestamptz
+);
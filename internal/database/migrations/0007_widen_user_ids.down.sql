@@ -0,0 +1,5 @@
+-- Fails rather than truncates if longer IDs have been stored since
+ALTER TABLE quota_usages ALTER COLUMN subject TYPE varchar(128);
+ALTER TABLE usage_records ALTER COLUMN user_id TYPE varchar(64);
+ALTER TABLE subscriptions ALTER COLUMN user_id TYPE varchar(64);
+ALTER TABLE user_plans ALTER COLUMN user_id TYPE varchar(64);
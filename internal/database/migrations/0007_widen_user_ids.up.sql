@@ -0,0 +1,6 @@
+-- User IDs are up to 128 characters, like users.id, and quota subjects add
+-- a "user:" or "guest:" prefix to them
+ALTER TABLE user_plans ALTER COLUMN user_id TYPE varchar(128);
+ALTER TABLE subscriptions ALTER COLUMN user_id TYPE varchar(128);
+ALTER TABLE usage_records ALTER COLUMN user_id TYPE varchar(128);
+ALTER TABLE quota_usages ALTER COLUMN subject TYPE varchar(255);
@@ -0,0 +1,78 @@
+// Package i18n holds the languages users can choose and the translations of
+// the API's user-facing text
+package i18n
+
+import (
+	"sort"
+	"strings"
+)
+
+// Supported languages
+const (
+	Thai    = "th"
+	English = "en"
+)
+
+// DefaultLanguage is the language of users who have not chosen one
+const DefaultLanguage = Thai
+
+// languageNames are the supported languages with their English names
+var languageNames = map[string]string{
+	Thai:    "Thai",
+	English: "English",
+}
+
+// IsSupported reports whether lang is a supported language code
+func IsSupported(lang string) bool {
+	_, ok := languageNames[lang]
+	return ok
+}
+
+// Languages returns the supported language codes, sorted
+func Languages() []string {
+	langs := make([]string, 0, len(languageNames))
+	for lang := range languageNames {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Name returns the English name of a language, e.g. "Thai"
+func Name(lang string) string {
+	return languageNames[lang]
+}
+
+// Negotiate picks the first supported language from an Accept-Language
+// header, or "" when there is none. Quality values are ignored; clients
+// list their preferred language first.
+func Negotiate(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		base := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if IsSupported(base) {
+			return base
+		}
+	}
+	return ""
+}
+
+// SystemPrompt returns the instruction that makes the assistant answer in
+// lang, or "" for unsupported languages
+func SystemPrompt(lang string) string {
+	return systemPrompts[lang]
+}
+
+var systemPrompts = map[string]string{
+	Thai:    "ตอบเป็นภาษาไทยเสมอ เว้นแต่ผู้ใช้จะขอให้ใช้ภาษาอื่น",
+	English: "Always answer in English unless the user asks for another language.",
+}
+
+// Translate returns the translation of an English API message into lang.
+// Messages without a translation are returned unchanged.
+func Translate(lang, message string) string {
+	if translated, ok := messages[lang][message]; ok {
+		return translated
+	}
+	return message
+}
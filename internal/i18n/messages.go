@@ -0,0 +1,74 @@
+package i18n
+
+// messages translates the API's English error messages. English needs no
+// entry; messages missing from a language are shown in English.
+var messages = map[string]map[string]string{
+	Thai: {
+		// Authentication
+		"Authorization header required": "ต้องระบุ Authorization header",
+		"Invalid token format":          "รูปแบบโทเค็นไม่ถูกต้อง",
+		"Invalid token":                 "โทเค็นไม่ถูกต้อง",
+		"Unauthorized":                  "ไม่ได้รับอนุญาต",
+		"User ID not found":             "ไม่พบรหัสผู้ใช้",
+		"Insufficient permissions":      "สิทธิ์ไม่เพียงพอ",
+		"Account disabled":              "บัญชีนี้ถูกระงับการใช้งาน",
+
+		// Requests
+		"Invalid request payload":                          "ข้อมูลคำขอไม่ถูกต้อง",
+		"Invalid page parameter":                           "พารามิเตอร์ page ไม่ถูกต้อง",
+		"Invalid page_size parameter":                      "พารามิเตอร์ page_size ไม่ถูกต้อง",
+		"Invalid from, use RFC 3339 or YYYY-MM-DD":         "ค่า from ไม่ถูกต้อง ใช้รูปแบบ RFC 3339 หรือ YYYY-MM-DD",
+		"Invalid to, use RFC 3339 or YYYY-MM-DD":           "ค่า to ไม่ถูกต้อง ใช้รูปแบบ RFC 3339 หรือ YYYY-MM-DD",
+		"to must be after from":                            "ค่า to ต้องอยู่หลัง from",
+		"Send either message or messages, not both":        "ส่ง message หรือ messages อย่างใดอย่างหนึ่งเท่านั้น",
+		"message role must be user":                        "role ของข้อความต้องเป็น user",
+		"thread_id must be a UUID":                         "thread_id ต้องเป็น UUID",
+		"thread_id in body and query do not match":         "thread_id ใน body และ query ไม่ตรงกัน",
+		"Unsupported language":                             "ไม่รองรับภาษานี้",
+		"Theme must be light, dark or system":              "ธีมต้องเป็น light, dark หรือ system",
+		"Only admins can choose the chat backend or model": "เฉพาะผู้ดูแลระบบเท่านั้นที่เลือก backend หรือโมเดลได้",
+		"Unknown chat backend":                             "ไม่รู้จัก backend ของแชทนี้",
+
+		// Users
+		"User not found": "ไม่พบผู้ใช้",
+		"Email is already registered to another user": "อีเมลนี้ถูกใช้โดยผู้ใช้อื่นแล้ว",
+		"Failed to register user":                     "ลงทะเบียนผู้ใช้ไม่สำเร็จ",
+		"Failed to fetch user profile":                "ดึงข้อมูลโปรไฟล์ไม่สำเร็จ",
+		"Failed to update user profile":               "อัปเดตโปรไฟล์ไม่สำเร็จ",
+		"Failed to fetch preferences":                 "ดึงการตั้งค่าไม่สำเร็จ",
+		"Failed to update preferences":                "อัปเดตการตั้งค่าไม่สำเร็จ",
+
+		// Conversations
+		"Conversation not found":                                "ไม่พบบทสนทนา",
+		"Failed to process chat":                                "ประมวลผลแชทไม่สำเร็จ",
+		"Failed to list conversations":                          "ดึงรายการบทสนทนาไม่สำเร็จ",
+		"Failed to fetch conversation":                          "ดึงบทสนทนาไม่สำเร็จ",
+		"Failed to rename conversation":                         "เปลี่ยนชื่อบทสนทนาไม่สำเร็จ",
+		"Failed to delete conversation":                         "ลบบทสนทนาไม่สำเร็จ",
+		"Demo users are limited to 3 messages per conversation": "ผู้ใช้ทดลองส่งได้สูงสุด 3 ข้อความต่อบทสนทนา",
+		"Please sign up for unlimited messaging":                "สมัครสมาชิกเพื่อส่งข้อความได้ไม่จำกัด",
+
+		// Speech-to-text
+		"Audio file required":          "ต้องแนบไฟล์เสียง",
+		"Failed to read audio file":    "อ่านไฟล์เสียงไม่สำเร็จ",
+		"Failed to process audio file": "ประมวลผลไฟล์เสียงไม่สำเร็จ",
+		"Speech-to-text is temporarily unavailable, please try again in a minute": "ระบบแปลงเสียงเป็นข้อความไม่พร้อมใช้งานชั่วคราว โปรดลองใหม่อีกครั้งในอีกสักครู่",
+
+		// Plans, usage and subscriptions
+		"Rate limit exceeded":                     "ส่งคำขอถี่เกินไป",
+		"Quota exceeded":                          "ใช้งานเกินโควตาแล้ว",
+		"Failed to load plan":                     "โหลดแพ็กเกจไม่สำเร็จ",
+		"Plan not found":                          "ไม่พบแพ็กเกจ",
+		"Failed to list plans":                    "ดึงรายการแพ็กเกจไม่สำเร็จ",
+		"This plan cannot be purchased":           "ไม่สามารถซื้อแพ็กเกจนี้ได้",
+		"You are already subscribed to this plan": "คุณสมัครแพ็กเกจนี้อยู่แล้ว",
+		"Failed to start checkout":                "เริ่มการชำระเงินไม่สำเร็จ",
+		"Failed to fetch subscription status":     "ดึงสถานะการสมัครสมาชิกไม่สำเร็จ",
+		"No active subscription":                  "ไม่มีการสมัครสมาชิกที่ใช้งานอยู่",
+		"Failed to cancel subscription":           "ยกเลิกการสมัครสมาชิกไม่สำเร็จ",
+		"Checkout session not found":              "ไม่พบรายการชำระเงิน",
+		"Failed to fetch usage":                   "ดึงข้อมูลการใช้งานไม่สำเร็จ",
+
+		"Not found": "ไม่พบข้อมูล",
+	},
+}
@@ -0,0 +1,344 @@
+// Package jwks loads the public keys of a JSON Web Key Set (RFC 7517) from a
+// URL or a file and caches them by key ID. Keys are reloaded when the cache
+// expires and when a token names a key ID the set does not have yet, which
+// is how identity providers roll out a new signing key.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned when the key set has no key with the
+// requested ID, even after reloading it
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// maxKeySetBytes bounds the size of a fetched key set
+const maxKeySetBytes = 1 << 20
+
+// minRSABits is the smallest RSA modulus accepted; shorter keys can be
+// factored
+const minRSABits = 2048
+
+// Options configures a KeySet. Exactly one of URL and File must be set.
+type Options struct {
+	URL  string
+	File string
+	// CacheTTL is how long loaded keys are used before the set is loaded
+	// again. Zero keeps them until an unknown key ID shows up.
+	CacheTTL time.Duration
+	// MinRefreshInterval bounds how often the set is reloaded, for expired
+	// keys or an unknown key ID alike, so neither tokens with made-up key
+	// IDs nor a provider outage make every request fetch the set
+	MinRefreshInterval time.Duration
+	// Client fetches URL; nil uses a client with a 10 second timeout
+	Client *http.Client
+}
+
+// KeySet is a cached JSON Web Key Set. It is safe for concurrent use; keys
+// are loaded outside the lock, and concurrent lookups share one load.
+type KeySet struct {
+	opts Options
+	now  func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+	lastErr     error
+	loading     *load
+}
+
+// load is a load of the key set in progress
+type load struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns a key set loading from opts.URL or opts.File. Nothing is
+// loaded until the first lookup; call Refresh to load eagerly.
+func New(opts Options) (*KeySet, error) {
+	if (opts.URL == "") == (opts.File == "") {
+		return nil, errors.New("jwks: exactly one of URL and File must be set")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &KeySet{opts: opts, now: time.Now}, nil
+}
+
+// Key returns the public key with ID kid. An empty kid matches the only key
+// of a single-key set.
+//
+// Expired keys stay in use while the set reloads in the background. A kid
+// the set does not have waits for a reload, since it may belong to a key
+// the provider just rotated in. Reloads happen at most once every
+// MinRefreshInterval, however often they are asked for.
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, found := s.lookup(kid)
+	now := s.now()
+	if found && (s.opts.CacheTTL <= 0 || now.Sub(s.loadedAt) <= s.opts.CacheTTL) {
+		s.mu.Unlock()
+		return key, nil
+	}
+	l := s.startLoadLocked(ctx, now)
+	s.mu.Unlock()
+
+	if found {
+		return key, nil
+	}
+	if l != nil {
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, found := s.lookup(kid); found {
+		return key, nil
+	}
+	if s.keys == nil && s.lastErr != nil {
+		return nil, s.lastErr
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+}
+
+// Refresh reloads the key set now and waits for the result
+func (s *KeySet) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	l := s.loading
+	if l == nil {
+		l = s.startLoadLocked(ctx, time.Time{})
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startLoadLocked starts loading the set unless a load is already running,
+// which it returns instead, or the last attempt was less than
+// MinRefreshInterval before now, when it returns nil. A zero now skips the
+// interval check.
+func (s *KeySet) startLoadLocked(ctx context.Context, now time.Time) *load {
+	if s.loading != nil {
+		return s.loading
+	}
+	if !now.IsZero() && !s.attemptedAt.IsZero() && now.Sub(s.attemptedAt) < s.opts.MinRefreshInterval {
+		return nil
+	}
+
+	l := &load{done: make(chan struct{})}
+	s.loading = l
+	s.attemptedAt = s.now()
+
+	// The load outlives the request that started it; the HTTP client's
+	// timeout bounds it instead
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		if err == nil {
+			s.keys = keys
+			s.loadedAt = s.now()
+			s.lastErr = nil
+			slog.DebugContext(ctx, "Loaded JWKS", "source", s.source(), "keys", len(keys))
+		} else {
+			err = fmt.Errorf("jwks: failed to load %s: %w", s.source(), err)
+			s.lastErr = err
+			if s.keys != nil {
+				slog.WarnContext(ctx, "Keeping cached JWKS", "err", err)
+			}
+		}
+		s.loading = nil
+		s.mu.Unlock()
+
+		l.err = err
+		close(l.done)
+	}()
+	return l
+}
+
+func (s *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// fetch reads and parses the key set
+func (s *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (s *KeySet) source() string {
+	if s.opts.URL != "" {
+		return s.opts.URL
+	}
+	return s.opts.File
+}
+
+func (s *KeySet) read(ctx context.Context) ([]byte, error) {
+	if s.opts.File != "" {
+		return os.ReadFile(s.opts.File)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.opts.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxKeySetBytes))
+}
+
+// jsonWebKey holds the JWK members we read
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Parse decodes a JSON Web Key Set into its RSA and EC signing keys by key
+// ID. Encryption keys are skipped. Keys of types we cannot verify with and
+// malformed or weak keys are skipped with a warning, so that one bad key
+// does not take down the rest of the set; a set without any usable key is
+// an error.
+func Parse(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = rsaKey(jwk)
+		case "EC":
+			key, err = ecKey(jwk)
+		default:
+			err = fmt.Errorf("unsupported key type %q", jwk.Kty)
+		}
+		if err != nil {
+			slog.Warn("Skipping unusable JWKS key", "kid", jwk.Kid, "err", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable RSA or EC signing keys")
+	}
+	return keys, nil
+}
+
+func rsaKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := decodeInt(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+	if n.BitLen() < minRSABits {
+		return nil, fmt.Errorf("%d bit modulus is shorter than %d bits", n.BitLen(), minRSABits)
+	}
+	e, err := decodeInt(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+	if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func ecKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+	}
+
+	x, err := decodeInt(jwk.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := decodeInt(jwk.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeInt decodes a base64url-encoded big-endian unsigned integer
+func decodeInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
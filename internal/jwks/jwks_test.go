@@ -0,0 +1,361 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(t *testing.T, kid string) map[string]string {
+	t.Helper()
+	return rsaJWKBits(t, kid, 2048)
+}
+
+func rsaJWKBits(t *testing.T, kid string, bits int) map[string]string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(t *testing.T, kid string) map[string]string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(x), "y": b64(y)}
+}
+
+func keySetJSON(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// keyServer serves a key set that tests can replace, fail or stall
+type keyServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu     sync.Mutex
+	body   []byte
+	status int
+	// stall, when set, holds every fetch until it is closed
+	stall chan struct{}
+}
+
+func newKeyServer(t *testing.T, body []byte) *keyServer {
+	t.Helper()
+	s := &keyServer{body: body, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		body, status, stall := s.body, s.status, s.stall
+		s.mu.Unlock()
+		if stall != nil {
+			<-stall
+		}
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *keyServer) set(body []byte, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.status = body, status
+}
+
+func (s *keyServer) setStall(stall chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stall = stall
+}
+
+// clock is a settable time source
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestKeySet(t *testing.T, url string, opts Options) (*KeySet, *clock) {
+	t.Helper()
+	opts.URL = url
+	set, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	set.now = c.Now
+	return set, c
+}
+
+func TestKeyRefreshesOnUnknownKid(t *testing.T) {
+	server := newKeyServer(t, keySetJSON(t, rsaJWK(t, "old")))
+	set, c := newTestKeySet(t, server.URL, Options{MinRefreshInterval: time.Minute})
+	ctx := context.Background()
+
+	if _, err := set.Key(ctx, "old"); err != nil {
+		t.Fatalf("Key(old): %v", err)
+	}
+
+	// A rotated-in key is picked up once the interval allows a reload
+	server.set(keySetJSON(t, rsaJWK(t, "old"), ecJWK(t, "new")), http.StatusOK)
+	if _, err := set.Key(ctx, "new"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key(new) within the interval: err = %v, want ErrKeyNotFound", err)
+	}
+	c.Advance(time.Minute)
+	if _, err := set.Key(ctx, "new"); err != nil {
+		t.Errorf("Key(new) after the interval: %v", err)
+	}
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("fetched %d times, want 2", n)
+	}
+}
+
+func TestKeyKeepsCachedKeysWhenRefreshFails(t *testing.T) {
+	server := newKeyServer(t, keySetJSON(t, rsaJWK(t, "k1")))
+	set, c := newTestKeySet(t, server.URL, Options{CacheTTL: time.Hour, MinRefreshInterval: time.Minute})
+	ctx := context.Background()
+
+	if _, err := set.Key(ctx, "k1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	// The provider goes down after the keys expire
+	server.set([]byte("unavailable"), http.StatusServiceUnavailable)
+	c.Advance(2 * time.Hour)
+	if err := set.Refresh(ctx); err == nil {
+		t.Fatal("Refresh succeeded against a failing server")
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := set.Key(ctx, "k1"); err != nil {
+			t.Fatalf("Key with expired keys and the provider down: %v", err)
+		}
+	}
+	// The failed refresh counts as an attempt, so the expired keys do not
+	// make every lookup retry
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("fetched %d times, want 2", n)
+	}
+
+	c.Advance(time.Minute)
+	set.Key(ctx, "k1")
+	waitForFetches(t, server, 3)
+}
+
+func TestKeyDoesNotBlockOnSlowRefresh(t *testing.T) {
+	server := newKeyServer(t, keySetJSON(t, rsaJWK(t, "k1")))
+	set, c := newTestKeySet(t, server.URL, Options{CacheTTL: time.Hour})
+	ctx := context.Background()
+
+	if _, err := set.Key(ctx, "k1"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	stall := make(chan struct{})
+	defer close(stall)
+	server.setStall(stall)
+	c.Advance(2 * time.Hour)
+
+	// The expired key is served while the reload hangs
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 5; i++ {
+			if _, err := set.Key(ctx, "k1"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Key: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Key blocked behind the reload")
+	}
+	waitForFetches(t, server, 2)
+
+	// Lookups of unknown kids give up when their request does
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := set.Key(ctx, "k2"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Key(k2) during a stalled reload: err = %v", err)
+	}
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("fetched %d times, want the stalled reload to be shared", n)
+	}
+}
+
+func TestKeyConcurrentLookupsShareOneLoad(t *testing.T) {
+	server := newKeyServer(t, keySetJSON(t, rsaJWK(t, "k1")))
+	stall := make(chan struct{})
+	server.setStall(stall)
+	set, _ := newTestKeySet(t, server.URL, Options{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := set.Key(context.Background(), "k1")
+			errs <- err
+		}()
+	}
+	waitForFetches(t, server, 1)
+	close(stall)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Key: %v", err)
+		}
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestKeyReportsLoadError(t *testing.T) {
+	server := newKeyServer(t, []byte("not json"))
+	set, _ := newTestKeySet(t, server.URL, Options{MinRefreshInterval: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		_, err := set.Key(context.Background(), "k1")
+		if err == nil || errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Key with an unloadable set: err = %v, want the load error", err)
+		}
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+// waitForFetches waits until server has been fetched n times
+func waitForFetches(t *testing.T, server *keyServer, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for server.fetches.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("fetched %d times, want %d", server.fetches.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestParse(t *testing.T) {
+	rsaKey, ecKey := rsaJWK(t, "rsa"), ecJWK(t, "ec")
+	encKey := rsaJWK(t, "enc")
+	encKey["use"] = "enc"
+	octKey := map[string]string{"kty": "oct", "kid": "hmac", "k": b64([]byte("secret"))}
+
+	keys, err := Parse(keySetJSON(t, rsaKey, ecKey, encKey, octKey))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, ok := keys["rsa"].(*rsa.PublicKey); !ok {
+		t.Errorf("rsa key = %T, want *rsa.PublicKey", keys["rsa"])
+	}
+	if key, ok := keys["ec"].(*ecdsa.PublicKey); !ok || key.Curve != elliptic.P256() {
+		t.Errorf("ec key = %#v, want a P-256 *ecdsa.PublicKey", keys["ec"])
+	}
+	// Encryption keys and symmetric keys are skipped
+	if len(keys) != 2 {
+		t.Errorf("parsed %d keys, want 2", len(keys))
+	}
+
+	with := func(key map[string]string, field, value string) map[string]string {
+		changed := make(map[string]string, len(key))
+		for k, v := range key {
+			changed[k] = v
+		}
+		changed[field] = value
+		return changed
+	}
+	offCurve := with(ecKey, "y", b64([]byte{1}))
+	weakKey := rsaJWKBits(t, "weak", 1024)
+
+	// Unusable keys are skipped while the others load
+	keys, err = Parse(keySetJSON(t, rsaKey, with(ecKey, "crv", "secp256k1"), weakKey, octKey))
+	if err != nil {
+		t.Fatalf("Parse with unusable keys: %v", err)
+	}
+	if _, ok := keys["rsa"]; !ok || len(keys) != 1 {
+		t.Errorf("parsed %d keys, want only the usable rsa key", len(keys))
+	}
+
+	// Sets without a usable key fail
+	for name, data := range map[string][]byte{
+		"not json":               []byte("{"),
+		"no keys":                keySetJSON(t),
+		"only unsupported kty":   keySetJSON(t, octKey),
+		"only encryption keys":   keySetJSON(t, encKey),
+		"unsupported crv":        keySetJSON(t, with(ecKey, "crv", "secp256k1")),
+		"point not on curve":     keySetJSON(t, offCurve),
+		"rsa without modulus":    keySetJSON(t, with(rsaKey, "n", "")),
+		"rsa key too short":      keySetJSON(t, weakKey),
+		"rsa exponent too big":   keySetJSON(t, with(rsaKey, "e", b64(big.NewInt(1<<40).Bytes()))),
+		"rsa exponent too small": keySetJSON(t, with(rsaKey, "e", b64([]byte{1}))),
+		"bad base64":             keySetJSON(t, with(rsaKey, "n", "not base64!")),
+	} {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("%s: Parse succeeded", name)
+		}
+	}
+}
+
+func TestNewRequiresOneSource(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"neither": {},
+		"both":    {URL: "https://id.example.com/jwks.json", File: "jwks.json"},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("%s: New succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package logging configures the process-wide slog logger: its level and
+// format, the request and trace IDs taken from the context of each record,
+// and the redaction of personal data.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats selectable with LOG_FORMAT
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Setup builds the logger described by cfg, writing to w, and installs it
+// as the slog default. The standard library's log package is routed
+// through it too, so every line is leveled, tagged and redacted.
+func Setup(cfg *config.Config, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := ParseRedactor(cfg.LogRedact)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var next slog.Handler
+	switch cfg.LogFormat {
+	case FormatJSON:
+		next = slog.NewJSONHandler(w, opts)
+	case "", FormatText:
+		next = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use %s or %s", cfg.LogFormat, FormatText, FormatJSON)
+	}
+
+	logger := slog.New(NewHandler(next, redactor))
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, use debug, info, warn or error", level)
+	}
+	return l, nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the request it belongs to
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Handler adds the request ID and trace context of each record's context
+// and redacts the record before passing it on
+type Handler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+// NewHandler wraps next. A nil redactor redacts nothing.
+func NewHandler(next slog.Handler, redactor *Redactor) *Handler {
+	return &Handler{next: next, redactor: redactor}
+}
+
+// Enabled implements slog.Handler
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, h.redactor.String(r.Message), r.PC)
+	if ctx != nil {
+		if requestID := RequestID(ctx); requestID != "" {
+			redacted.AddAttrs(slog.String("request_id", requestID))
+		}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			redacted.AddAttrs(
+				slog.String("trace_id", span.TraceID().String()),
+				slog.String("span_id", span.SpanID().String()),
+			)
+		}
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactor.Attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactor.Attr(a)
+	}
+	return &Handler{next: h.next.WithAttrs(redacted), redactor: h.redactor}
+}
+
+// WithGroup implements slog.Handler
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Kinds of personal data LOG_REDACT can mask
+const (
+	RedactEmail   = "email"
+	RedactPhone   = "phone"
+	RedactName    = "name"
+	RedactContent = "content"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// phonePattern only matches numbers written like phone numbers: with a
+	// country code, a leading 0, an area code in parentheses or separators
+	// between the groups. Bare runs of digits such as timestamps and IDs
+	// are left alone.
+	phonePattern = regexp.MustCompile(`\+\d{1,3}[\s-]?(?:\(\d{1,4}\)|\d{1,4})(?:[\s-]?\d{2,4}){2,3}\b` +
+		`|\(0?\d{1,3}\)\s?\d{3}[\s-]?\d{3,4}\b` +
+		`|\b0\d{1,2}[\s-]?\d{3}[\s-]?\d{3,4}\b` +
+		`|\b\d{2,3}[\s-]\d{3}[\s-]\d{3,4}\b`)
+	// namePattern finds self-introductions such as "my name is Jane" or
+	// "ชื่อสมชาย", the way extractCandidateName does
+	namePattern = regexp.MustCompile(`(?i)(my name is|ชื่อ\s*(?:คือ)?)(\s*[:：]?\s*)([ก-๙a-z]+(?:\s+[ก-๙a-z]+)?)`)
+)
+
+// Attribute keys whose values are masked whole
+var (
+	emailKeys   = keySet("email", "user_email")
+	nameKeys    = keySet("name", "display_name", "user_name", "candidate_name")
+	contentKeys = keySet("content", "message", "messages", "reply", "text", "body", "prompt", "transcript")
+)
+
+func keySet(keys ...string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+// Redactor masks personal data in log messages and attributes. Free text
+// is searched for email addresses, phone numbers and self-introductions;
+// attributes named like emails, names or message content are masked whole.
+type Redactor struct {
+	email, phone, name, content bool
+}
+
+// ParseRedactor parses a comma-separated list of email, phone, name and
+// content. "all" masks everything and "none" or "" nothing.
+func ParseRedactor(spec string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, kind := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(strings.ToLower(kind)) {
+		case "", "none":
+		case "all":
+			r.email, r.phone, r.name, r.content = true, true, true, true
+		case RedactEmail:
+			r.email = true
+		case RedactPhone:
+			r.phone = true
+		case RedactName:
+			r.name = true
+		case RedactContent:
+			r.content = true
+		default:
+			return nil, fmt.Errorf("unknown redaction %q, use %s, %s, %s, %s, all or none",
+				kind, RedactEmail, RedactPhone, RedactName, RedactContent)
+		}
+	}
+	return r, nil
+}
+
+// String masks the personal data found in free text
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	if r.email {
+		s = emailPattern.ReplaceAllString(s, "[EMAIL]")
+	}
+	if r.phone {
+		s = phonePattern.ReplaceAllString(s, "[PHONE]")
+	}
+	if r.name {
+		s = namePattern.ReplaceAllString(s, "${1}${2}[NAME]")
+	}
+	return s
+}
+
+// Attr masks an attribute by its key, or the personal data in its value
+func (r *Redactor) Attr(a slog.Attr) slog.Attr {
+	if r == nil {
+		return a
+	}
+	key := strings.ToLower(a.Key)
+
+	value := a.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = r.Attr(member)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindString, slog.KindAny:
+	default:
+		// Numbers, durations, times and booleans carry nothing to mask
+		return a
+	}
+
+	switch {
+	case r.content && contentKeys[key]:
+		return slog.String(a.Key, fmt.Sprintf("[REDACTED %d chars]", len(valueText(value))))
+	case r.name && nameKeys[key]:
+		return slog.String(a.Key, "[NAME]")
+	case r.email && emailKeys[key]:
+		return slog.String(a.Key, "[EMAIL]")
+	}
+	if value.Kind() == slog.KindString || isError(value) {
+		return slog.String(a.Key, r.String(valueText(value)))
+	}
+	return a
+}
+
+func valueText(v slog.Value) string {
+	if err, ok := v.Any().(error); ok && v.Kind() == slog.KindAny {
+		return err.Error()
+	}
+	return v.String()
+}
+
+func isError(v slog.Value) bool {
+	_, ok := v.Any().(error)
+	return v.Kind() == slog.KindAny && ok
+}
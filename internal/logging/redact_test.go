@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestRedactorString(t *testing.T) {
+	all, err := ParseRedactor("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		// Email addresses
+		{"mail jane.doe+eye@example.co.th now", "mail [EMAIL] now"},
+		{"two a@b.io, c@d.org", "two [EMAIL], [EMAIL]"},
+		// Phone numbers
+		{"call 081-234-5678", "call [PHONE]"},
+		{"call 0812345678", "call [PHONE]"},
+		{"call 02 123 4567", "call [PHONE]"},
+		{"call (02) 123-4567", "call [PHONE]"},
+		{"call +66 81 234 5678", "call [PHONE]"},
+		{"call +66812345678", "call [PHONE]"},
+		{"call 555-123-4567", "call [PHONE]"},
+		// Digits that are not phone numbers
+		{"at 1718000000 unix", "at 1718000000 unix"},
+		{"order 12345678", "order 12345678"},
+		{"id 98765432101", "id 98765432101"},
+		{"on 2025-06-30T10:15:00Z", "on 2025-06-30T10:15:00Z"},
+		{"took 1234567ns", "took 1234567ns"},
+		// Self-introductions
+		{"my name is Jane Doe, hi", "my name is [NAME], hi"},
+		{"My name is: Jane", "My name is: [NAME]"},
+		{"ชื่อสมชาย ใจดี ครับ", "ชื่อ[NAME] ครับ"},
+		{"ชื่อคือ สมหญิง", "ชื่อคือ [NAME]"},
+		{"nothing personal", "nothing personal"},
+	} {
+		if got := all.String(tc.in); got != tc.want {
+			t.Errorf("String(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRedactorModes(t *testing.T) {
+	const text = "jane@example.com 081-234-5678 my name is Jane"
+
+	for _, tc := range []struct {
+		spec, want string
+	}{
+		{"", text},
+		{"none", text},
+		{"email", "[EMAIL] 081-234-5678 my name is Jane"},
+		{"phone", "jane@example.com [PHONE] my name is Jane"},
+		{"name", "jane@example.com 081-234-5678 my name is [NAME]"},
+		{"content", text},
+		{"email, PHONE", "[EMAIL] [PHONE] my name is Jane"},
+		{"all", "[EMAIL] [PHONE] my name is [NAME]"},
+	} {
+		r, err := ParseRedactor(tc.spec)
+		if err != nil {
+			t.Errorf("ParseRedactor(%q): %v", tc.spec, err)
+			continue
+		}
+		if got := r.String(text); got != tc.want {
+			t.Errorf("%q: String = %q, want %q", tc.spec, got, tc.want)
+		}
+	}
+
+	if _, err := ParseRedactor("email,address"); err == nil {
+		t.Error("ParseRedactor accepted an unknown kind")
+	}
+}
+
+func TestRedactorAttr(t *testing.T) {
+	for _, tc := range []struct {
+		spec string
+		attr slog.Attr
+		want string
+	}{
+		// Attributes named for personal data are masked whole
+		{"email", slog.String("user_email", "jane"), "[EMAIL]"},
+		{"name", slog.String("display_name", "Jane Doe"), "[NAME]"},
+		{"content", slog.String("reply", "see you at 10"), "[REDACTED 13 chars]"},
+		{"content", slog.Any("body", errors.New("oops")), "[REDACTED 4 chars]"},
+		// unless that kind is not redacted
+		{"email", slog.String("display_name", "Jane Doe"), "Jane Doe"},
+		{"none", slog.String("reply", "see you"), "see you"},
+		// Other strings and errors are searched
+		{"all", slog.String("note", "mail jane@example.com"), "mail [EMAIL]"},
+		{"all", slog.Any("err", errors.New("no user 081-234-5678")), "no user [PHONE]"},
+		// Values that cannot hold personal data pass through
+		{"all", slog.Int("status", 502), "502"},
+		{"all", slog.Duration("took", time.Second), "1s"},
+	} {
+		r, err := ParseRedactor(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Attr(tc.attr).Value.String(); got != tc.want {
+			t.Errorf("%s: Attr(%s) = %q, want %q", tc.spec, tc.attr, got, tc.want)
+		}
+	}
+
+	// Groups are redacted member by member
+	all, _ := ParseRedactor("all")
+	group := all.Attr(slog.Group("user", slog.String("email", "jane@example.com"), slog.String("id", "user-1")))
+	if got := group.Value.String(); got != "[email=[EMAIL] id=user-1]" {
+		t.Errorf("group = %s", got)
+	}
+
+	// A nil redactor masks nothing
+	var none *Redactor
+	if got := none.String("jane@example.com"); got != "jane@example.com" {
+		t.Errorf("nil redactor: String = %q", got)
+	}
+}
@@ -0,0 +1,150 @@
+// Package metrics defines the Prometheus metrics the service exports on
+// /metrics. Collectors are registered with the default registry, next to
+// the Go runtime and process collectors.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "eyeqcheck"
+
+// Upstream call outcomes
+const (
+	OutcomeSuccess     = "success"
+	OutcomeError       = "error"
+	OutcomeTimeout     = "timeout"
+	OutcomeCanceled    = "canceled"
+	OutcomeCircuitOpen = "circuit_open"
+)
+
+var (
+	// HTTPRequests counts served requests by method, route template and
+	// status code
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests served, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes request latency by method, route template and
+	// status code
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by method, route template and status code.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route", "status"})
+
+	// HTTPInFlight is the number of requests being served
+	HTTPInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	// UpstreamCalls counts calls to the RAG, STT and OpenAI services by
+	// outcome, after retries
+	UpstreamCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "calls_total",
+		Help:      "Upstream service calls, by service and outcome after retries.",
+	}, []string{"service", "outcome"})
+
+	// UpstreamDuration observes upstream call latency including retries
+	UpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "call_duration_seconds",
+		Help:      "Upstream service call latency including retries, by service and outcome. Streamed calls are timed until the response headers.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"service", "outcome"})
+
+	// UpstreamAttemptErrors counts failed attempts, including those that
+	// were retried
+	UpstreamAttemptErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upstream",
+		Name:      "attempt_errors_total",
+		Help:      "Failed upstream attempts, including retried ones, by service and kind (transport or status).",
+	}, []string{"service", "kind"})
+
+	// RateLimitRejections counts 429 answers by plan, route group and the
+	// limit that was hit
+	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "rejections_total",
+		Help:      "Requests rejected with 429, by plan, route group and reason (rate or quota).",
+	}, []string{"plan", "route_group", "reason"})
+
+	// CacheLookups counts response cache lookups by result
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Chat response cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	// ActiveStreams is the number of chat replies being streamed over SSE
+	ActiveStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "chat",
+		Name:      "active_streams",
+		Help:      "Chat replies currently being streamed as Server-Sent Events.",
+	})
+)
+
+// Cache hit and miss totals behind the hit ratio gauge
+var cacheHits, cacheMisses atomic.Uint64
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "hit_ratio",
+		Help:      "Share of chat response cache lookups that hit since the process started.",
+	}, func() float64 {
+		hits, misses := cacheHits.Load(), cacheMisses.Load()
+		if hits+misses == 0 {
+			return 0
+		}
+		return float64(hits) / float64(hits+misses)
+	})
+}
+
+// CacheLookup records a response cache lookup
+func CacheLookup(hit bool) {
+	if hit {
+		cacheHits.Add(1)
+		CacheLookups.WithLabelValues("hit").Inc()
+		return
+	}
+	cacheMisses.Add(1)
+	CacheLookups.WithLabelValues("miss").Inc()
+}
+
+// RegisterDBStats exports the connection pool statistics of db. Call it
+// once, after the database is opened.
+func RegisterDBStats(db *sql.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler serves the metrics on /metrics. It belongs on the internal
+// metrics listener, not the public API.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	return mux
+}
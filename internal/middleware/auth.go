@@ -1,12 +1,17 @@
 package middleware
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/jwks"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -21,8 +26,100 @@ type UserClaims struct {
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware validates JWT token from client system
-func AuthMiddleware() gin.HandlerFunc {
+// AccountSource looks up registered users. It returns nil, nil for users
+// who never registered.
+type AccountSource interface {
+	Account(userID string) (*model.User, error)
+}
+
+// JWTVerifier checks the signature, issuer, audience and time claims of the
+// client system's tokens; tokens must carry an expiry. In jwks mode the
+// token must be signed with RS256 or ES256 by a key in the configured key
+// set; in hmac mode with HS256 and the shared JWT secret.
+type JWTVerifier struct {
+	methods []string
+	options []jwt.ParserOption
+	keyfunc func(ctx context.Context, token *jwt.Token) (any, error)
+}
+
+// NewJWTVerifier returns the verifier for cfg's jwt_* settings
+func NewJWTVerifier(cfg *config.Config) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		options: []jwt.ParserOption{jwt.WithLeeway(cfg.JWTClockSkew), jwt.WithExpirationRequired()},
+	}
+	if cfg.JWTIssuer != "" {
+		v.options = append(v.options, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		v.options = append(v.options, jwt.WithAudience(cfg.JWTAudience))
+	}
+
+	switch cfg.JWTMode {
+	case config.JWTModeHMAC:
+		secret := []byte(cfg.JWTSecret)
+		v.methods = []string{jwt.SigningMethodHS256.Alg()}
+		v.keyfunc = func(context.Context, *jwt.Token) (any, error) {
+			return secret, nil
+		}
+	case config.JWTModeJWKS:
+		keys, err := jwks.New(jwks.Options{
+			URL:                cfg.JWTJWKSURL,
+			File:               cfg.JWTJWKSFile,
+			CacheTTL:           cfg.JWTJWKSRefresh,
+			MinRefreshInterval: jwksMinRefreshInterval,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// A local key set is read now, so a broken file stops startup
+		// rather than failing every request
+		if cfg.JWTJWKSFile != "" {
+			if err := keys.Refresh(context.Background()); err != nil {
+				return nil, err
+			}
+		}
+		v.methods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}
+		v.keyfunc = func(ctx context.Context, token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			return keys.Key(ctx, kid)
+		}
+	default:
+		return nil, fmt.Errorf("unknown JWT mode %q", cfg.JWTMode)
+	}
+	v.options = append(v.options, jwt.WithValidMethods(v.methods))
+	return v, nil
+}
+
+// jwksMinRefreshInterval bounds how often tokens with unknown key IDs make
+// the verifier reload the key set
+var jwksMinRefreshInterval = 30 * time.Second
+
+// Verify parses tokenString and returns its claims if it is valid
+func (v *JWTVerifier) Verify(ctx context.Context, tokenString string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (any, error) {
+		return v.keyfunc(ctx, token)
+	}, v.options...)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+	// Identity providers put the user in the standard subject claim
+	if claims.UserID == "" {
+		claims.UserID = claims.Subject
+	}
+	if claims.UserID == "" {
+		return nil, errors.New("token has no user_id or sub claim")
+	}
+	return claims, nil
+}
+
+// AuthMiddleware validates the JWT token from the client system with
+// verifier and checks the caller's account in accounts
+func AuthMiddleware(verifier *JWTVerifier, accounts AccountSource) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -41,14 +138,29 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Validate token
-		userClaims, err := validateJWTToken(tokenString)
+		userClaims, err := verifier.Verify(c.Request.Context(), tokenString)
 		if err != nil {
-			log.Printf("Token validation error: %v", err)
+			slog.WarnContext(c.Request.Context(), "Token validation failed", "err", err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// Registered users can be disabled, and their stored role takes
+		// precedence over the one in the token. If the lookup fails the
+		// token is trusted as before.
+		account, err := accounts.Account(userClaims.UserID)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to load account", "user_id", userClaims.UserID, "err", err)
+		} else if account != nil {
+			if !account.IsActive {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+				c.Abort()
+				return
+			}
+			userClaims.Role = account.Role
+		}
+
 		// Set user context
 		c.Set("user_id", userClaims.UserID)
 		c.Set("user_email", userClaims.Email)
@@ -60,32 +172,19 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-// validateJWTToken validates the JWT token from client system
-func validateJWTToken(tokenString string) (*UserClaims, error) {
-	// Parse token
-	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		// Return the secret key (should be shared with client system)
-		return []byte(getJWTSecret()), nil
-	})
-
-	if err != nil {
-		return nil, err
+// MintToken signs claims with secret the way the client system does, for
+// development and scripted testing. ttl sets the expiry when claims carry
+// none; tokens without one are refused by JWTVerifier.
+func MintToken(claims UserClaims, secret string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(now)
 	}
-
-	// Extract claims
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims, nil
+	if claims.ExpiresAt == nil && ttl > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
 	}
-
-	return nil, errors.New("invalid token claims")
-}
-
-// getJWTSecret gets the shared secret key from config
-func getJWTSecret() string {
-	cfg := config.Load()
-	return cfg.JWTSecret
+	if claims.Subject == "" {
+		claims.Subject = claims.UserID
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
 }
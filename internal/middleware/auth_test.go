@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKey is a signing key published in a test JWKS
+type testKey struct {
+	kid    string
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodRS256, signer: key}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodES256, signer: key}
+}
+
+func (k testKey) jwk() map[string]string {
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	switch pub := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig",
+			"n": b64(pub.N), "e": b64(big.NewInt(int64(pub.E)))}
+	case *ecdsa.PublicKey:
+		// Coordinates are padded to the curve size
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return map[string]string{"kty": "EC", "kid": k.kid, "use": "sig", "crv": "P-256",
+			"x": base64.RawURLEncoding.EncodeToString(x), "y": base64.RawURLEncoding.EncodeToString(y)}
+	}
+	panic("unsupported key")
+}
+
+func (k testKey) sign(t *testing.T, claims UserClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func jwksJSON(t *testing.T, keys ...testKey) []byte {
+	t.Helper()
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk())
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// jwksServer serves the keys it currently holds and counts the fetches
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []testKey
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...testKey) *jwksServer {
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwksJSON(t, s.keys...))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(keys ...testKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func jwksConfig(url string) *config.Config {
+	cfg := config.Default()
+	cfg.JWTMode = config.JWTModeJWKS
+	cfg.JWTJWKSURL = url
+	cfg.JWTIssuer = "https://id.example.com"
+	cfg.JWTAudience = "eyeqcheck"
+	return cfg
+}
+
+func validClaims(userID string) UserClaims {
+	now := time.Now()
+	return UserClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://id.example.com",
+			Audience:  jwt.ClaimStrings{"eyeqcheck"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+func TestJWTVerifierJWKS(t *testing.T) {
+	rsaKey, ecKey := newRSAKey(t, "rsa-1"), newECKey(t, "ec-1")
+	server := newJWKSServer(t, rsaKey, ecKey)
+
+	verifier, err := NewJWTVerifier(jwksConfig(server.URL))
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	for _, key := range []testKey{rsaKey, ecKey} {
+		claims, err := verifier.Verify(context.Background(), key.sign(t, validClaims("user-"+key.kid)))
+		if err != nil {
+			t.Errorf("%s: Verify: %v", key.method.Alg(), err)
+			continue
+		}
+		if claims.UserID != "user-"+key.kid {
+			t.Errorf("%s: user = %q", key.method.Alg(), claims.UserID)
+		}
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want the cached set to be reused", n)
+	}
+
+	// The subject stands in for a missing user_id
+	claims := validClaims("")
+	claims.Subject = "subject-1"
+	if got, err := verifier.Verify(context.Background(), rsaKey.sign(t, claims)); err != nil || got.UserID != "subject-1" {
+		t.Errorf("sub fallback = %+v, %v", got, err)
+	}
+}
+
+func TestJWTVerifierRejects(t *testing.T) {
+	key := newRSAKey(t, "rsa-1")
+	server := newJWKSServer(t, key)
+	verifier, err := NewJWTVerifier(jwksConfig(server.URL))
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	hmacClaims := validClaims("user-1")
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, hmacClaims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{
+		"wrong issuer": key.sign(t, func() UserClaims {
+			c := validClaims("user-1")
+			c.Issuer = "https://evil.example.com"
+			return c
+		}()),
+		"wrong audience": key.sign(t, func() UserClaims {
+			c := validClaims("user-1")
+			c.Audience = jwt.ClaimStrings{"other-app"}
+			return c
+		}()),
+		"expired beyond skew": key.sign(t, func() UserClaims {
+			c := validClaims("user-1")
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Minute))
+			return c
+		}()),
+		"no expiry": key.sign(t, func() UserClaims {
+			c := validClaims("user-1")
+			c.ExpiresAt = nil
+			return c
+		}()),
+		"no user":     key.sign(t, validClaims("")),
+		"unknown key": newRSAKey(t, "rsa-2").sign(t, validClaims("user-1")),
+		"hmac":        hmacToken,
+	} {
+		if _, err := verifier.Verify(context.Background(), token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	// Expiry within the clock skew is tolerated
+	claims := validClaims("user-1")
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+	if _, err := verifier.Verify(context.Background(), key.sign(t, claims)); err != nil {
+		t.Errorf("token expired within the skew rejected: %v", err)
+	}
+}
+
+func TestJWTVerifierKeyRotation(t *testing.T) {
+	defer func(d time.Duration) { jwksMinRefreshInterval = d }(jwksMinRefreshInterval)
+	jwksMinRefreshInterval = 0
+
+	oldKey, newKey := newRSAKey(t, "2024"), newECKey(t, "2025")
+	server := newJWKSServer(t, oldKey)
+	verifier, err := NewJWTVerifier(jwksConfig(server.URL))
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), oldKey.sign(t, validClaims("user-1"))); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+
+	// The provider rotates in a new key; its first token reloads the set
+	server.publish(oldKey, newKey)
+	if _, err := verifier.Verify(context.Background(), newKey.sign(t, validClaims("user-1"))); err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+}
+
+func TestJWTVerifierUnknownKeyRefreshIsThrottled(t *testing.T) {
+	key := newRSAKey(t, "rsa-1")
+	server := newJWKSServer(t, key)
+	verifier, err := NewJWTVerifier(jwksConfig(server.URL))
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	stranger := newRSAKey(t, "made-up")
+	for i := 0; i < 5; i++ {
+		verifier.Verify(context.Background(), stranger.sign(t, validClaims("user-1")))
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times for unknown key IDs, want 1", n)
+	}
+}
+
+func TestJWTVerifierJWKSFile(t *testing.T) {
+	key := newECKey(t, "ec-1")
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, jwksJSON(t, key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := jwksConfig("")
+	cfg.JWTJWKSFile = file
+	verifier, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), key.sign(t, validClaims("user-1"))); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// A broken file fails at startup
+	if err := os.WriteFile(file, []byte(`{"keys": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJWTVerifier(cfg); err == nil {
+		t.Error("NewJWTVerifier accepted an empty key set")
+	}
+}
+
+func TestJWTVerifierHMAC(t *testing.T) {
+	cfg := config.Default()
+	cfg.JWTMode = config.JWTModeHMAC
+	verifier, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	token, err := MintToken(UserClaims{UserID: "user-1"}, cfg.JWTSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := verifier.Verify(context.Background(), token); err != nil || claims.UserID != "user-1" {
+		t.Errorf("Verify = %+v, %v", claims, err)
+	}
+
+	forged, err := MintToken(UserClaims{UserID: "user-1"}, "another-secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(context.Background(), forged); err == nil {
+		t.Error("token signed with another secret accepted")
+	}
+	if _, err := verifier.Verify(context.Background(), newRSAKey(t, "rsa-1").sign(t, validClaims("user-1"))); err == nil {
+		t.Error("RS256 token accepted in hmac mode")
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/EyeQuila/eyeQcheck/internal/i18n"
+	"github.com/gin-gonic/gin"
+)
+
+// LanguageSource picks the language to answer a request in from the
+// caller's preferences and Accept-Language header
+type LanguageSource interface {
+	LanguageFor(userID, acceptLanguage string) string
+}
+
+// LocalizeErrors translates the "error" and "message" fields of JSON error
+// responses into the caller's language: the language in their preferences,
+// or the one their Accept-Language header asks for. Successful responses
+// and streams are passed through untouched.
+func LocalizeErrors(languages LanguageSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &localizingWriter{ResponseWriter: c.Writer, c: c, languages: languages}
+		c.Next()
+	}
+}
+
+type localizingWriter struct {
+	gin.ResponseWriter
+	c         *gin.Context
+	languages LanguageSource
+}
+
+func (w *localizingWriter) Write(data []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+
+	lang := w.languages.LanguageFor(w.c.GetString("user_id"), w.c.GetHeader("Accept-Language"))
+	if lang == "" || lang == i18n.English {
+		return w.ResponseWriter.Write(data)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	for _, field := range []string{"error", "message"} {
+		if text, ok := body[field].(string); ok {
+			body[field] = i18n.Translate(lang, text)
+		}
+	}
+	translated, err := json.Marshal(body)
+	if err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.Header().Set("Content-Language", lang)
+	if _, err := w.ResponseWriter.Write(translated); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *localizingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift
+// the write deadline for streams
+func (w *localizingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
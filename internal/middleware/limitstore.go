@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limit is a token bucket: Burst tokens that refill at Rate per second
+type Limit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// fillTime returns how long an empty bucket takes to refill completely
+func (l Limit) fillTime() time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(l.Burst) / float64(l.Rate) * float64(time.Second))
+}
+
+// resetAt returns when a bucket holding tokens will be full again
+func (l Limit) resetAt(now time.Time, tokens float64) time.Time {
+	if l.Rate <= 0 || tokens >= float64(l.Burst) {
+		return now
+	}
+	missing := float64(l.Burst) - tokens
+	return now.Add(time.Duration(missing / float64(l.Rate) * float64(time.Second)))
+}
+
+// LimitResult is the outcome of taking a token from a bucket
+type LimitResult struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// Reset is when the bucket will be full again
+	Reset time.Time
+}
+
+// LimiterStore keeps the token buckets of rate-limited clients
+type LimiterStore interface {
+	// Allow takes one token from key's bucket, creating a full bucket for
+	// keys it has not seen
+	Allow(ctx context.Context, key string, limit Limit) (LimitResult, error)
+}
+
+// MemoryLimiterStore keeps buckets in process memory. Each replica of the
+// server has its own buckets, so it is only accurate for a single instance.
+type MemoryLimiterStore struct {
+	// IdleTimeout is how long a client's bucket is kept after its last
+	// request. A client that comes back later starts with a full bucket.
+	IdleTimeout time.Duration
+
+	mu        sync.Mutex
+	limiters  map[string]*limiterEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemoryLimiterStore creates an empty in-memory store
+func NewMemoryLimiterStore(idleTimeout time.Duration) *MemoryLimiterStore {
+	return &MemoryLimiterStore{
+		IdleTimeout: idleTimeout,
+		limiters:    make(map[string]*limiterEntry),
+		now:         time.Now,
+	}
+}
+
+// Allow implements LimiterStore. It is safe for concurrent use.
+func (s *MemoryLimiterStore) Allow(ctx context.Context, key string, limit Limit) (LimitResult, error) {
+	now, limiter := s.getLimiter(key, limit)
+
+	allowed := limiter.AllowN(now, 1)
+	tokens := limiter.TokensAt(now)
+	return LimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     limit.resetAt(now, tokens),
+	}, nil
+}
+
+// getLimiter gets or creates the rate limiter for a specific key
+func (s *MemoryLimiterStore) getLimiter(key string, limit Limit) (time.Time, *rate.Limiter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evictIdle(now)
+
+	entry, exists := s.limiters[key]
+	if !exists {
+		// Create new limiter for this key
+		entry = &limiterEntry{limiter: rate.NewLimiter(limit.Rate, limit.Burst)}
+		s.limiters[key] = entry
+	}
+	entry.lastSeen = now
+
+	return now, entry.limiter
+}
+
+// evictIdle drops limiters that have not been used for IdleTimeout. The map
+// is swept at most once per IdleTimeout so the cost is spread over many
+// requests. s.mu must be held.
+func (s *MemoryLimiterStore) evictIdle(now time.Time) {
+	if s.IdleTimeout <= 0 || now.Sub(s.lastSweep) < s.IdleTimeout {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.limiters {
+		if now.Sub(entry.lastSeen) >= s.IdleTimeout {
+			delete(s.limiters, key)
+		}
+	}
+}
+
+// size returns the number of tracked keys
+func (s *MemoryLimiterStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.limiters)
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills and takes a token from the bucket at KEYS[1] in
+// one atomic step, so every replica sees the same bucket.
+//
+// ARGV: refill rate in tokens per millisecond, burst, current time in unix
+// milliseconds, key TTL in milliseconds.
+// Returns {allowed (0 or 1), tokens left as a string}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisLimiterStore keeps buckets in Redis (or anything speaking its
+// protocol) so that all replicas of the server share one quota per client
+type RedisLimiterStore struct {
+	client redis.Scripter
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisLimiterStore creates a store that keeps its buckets under keys
+// starting with prefix
+func NewRedisLimiterStore(client redis.Scripter, prefix string) *RedisLimiterStore {
+	return &RedisLimiterStore{
+		client: client,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+// Allow implements LimiterStore
+func (s *RedisLimiterStore) Allow(ctx context.Context, key string, limit Limit) (LimitResult, error) {
+	now := s.now()
+
+	// A full bucket behaves exactly like a missing one, so the key only has
+	// to live until the bucket has refilled
+	ttl := limit.fillTime()
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	perMilli := float64(limit.Rate) / 1000
+	values, err := tokenBucketScript.Run(ctx, s.client, []string{s.prefix + key},
+		strconv.FormatFloat(perMilli, 'g', -1, 64),
+		limit.Burst,
+		now.UnixMilli(),
+		ttl.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return LimitResult{}, fmt.Errorf("rate limit script failed: %w", err)
+	}
+	if len(values) != 2 {
+		return LimitResult{}, fmt.Errorf("rate limit script returned %d values", len(values))
+	}
+
+	allowed, _ := values[0].(int64)
+	tokensText, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensText, 64)
+	if err != nil {
+		return LimitResult{}, fmt.Errorf("rate limit script returned invalid tokens %q: %w", tokensText, err)
+	}
+
+	return LimitResult{
+		Allowed:   allowed == 1,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     limit.resetAt(now, tokens),
+	}, nil
+}
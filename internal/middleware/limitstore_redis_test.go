@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+func newTestRedisStore(t *testing.T) (*miniredis.Miniredis, *RedisLimiterStore) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, NewRedisLimiterStore(client, "ratelimit:")
+}
+
+func TestRedisLimiterStoreParallelClients(t *testing.T) {
+	_, store := newTestRedisStore(t)
+	limiter := newTestLimiter(store)
+
+	userRouter := newRateLimitRouter(RateLimitMiddleware(limiter, services.RouteGroupChat))
+	allowed := hammer(t, userRouter, 20, 10, func(req *http.Request, client int) {
+		req.Header.Set("X-Test-User", fmt.Sprintf("user-%d", client))
+	})
+	for client, n := range allowed {
+		if n != 5 {
+			t.Errorf("user %d: got %d allowed requests, want 5", client, n)
+		}
+	}
+
+	guestRouter := newRateLimitRouter(GuestRateLimitMiddleware(limiter, services.RouteGroupChat))
+	allowed = hammer(t, guestRouter, 20, 10, func(req *http.Request, client int) {
+		req.RemoteAddr = fmt.Sprintf("10.1.0.%d:4321", client)
+	})
+	for client, n := range allowed {
+		if n != 2 {
+			t.Errorf("guest %d: got %d allowed requests, want 2", client, n)
+		}
+	}
+}
+
+func TestRedisLimiterStoreSharedBetweenReplicas(t *testing.T) {
+	server, first := newTestRedisStore(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	second := NewRedisLimiterStore(client, "ratelimit:")
+
+	limit := Limit{Rate: rate.Every(time.Hour), Burst: 4}
+	var allowed int
+	for i := 0; i < 10; i++ {
+		store := first
+		if i%2 == 1 {
+			store = second
+		}
+		result, err := store.Allow(context.Background(), "user:shared", limit)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if result.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Fatalf("replicas allowed %d requests together, want 4", allowed)
+	}
+}
+
+func TestRedisLimiterStoreRefills(t *testing.T) {
+	server, store := newTestRedisStore(t)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: rate.Every(time.Minute / 10), Burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := store.Allow(ctx, "guest:1.2.3.4", limit)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d: allowed=%v err=%v", i, result.Allowed, err)
+		}
+	}
+	result, err := store.Allow(ctx, "guest:1.2.3.4", limit)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("got %+v, want a rejection with nothing remaining", result)
+	}
+	if want := now.Add(12 * time.Second); !result.Reset.Equal(want) {
+		t.Fatalf("reset at %v, want %v", result.Reset, want)
+	}
+	if ttl := server.TTL("ratelimit:guest:1.2.3.4"); ttl != 12*time.Second {
+		t.Fatalf("bucket TTL is %v, want the refill time", ttl)
+	}
+
+	// One token comes back every six seconds
+	now = now.Add(6 * time.Second)
+	result, err = store.Allow(ctx, "guest:1.2.3.4", limit)
+	if err != nil || !result.Allowed {
+		t.Fatalf("after refill: allowed=%v err=%v", result.Allowed, err)
+	}
+}
+
+func TestRateLimitMiddlewareAllowsWhenStoreIsDown(t *testing.T) {
+	server, store := newTestRedisStore(t)
+	limiter := newTestLimiter(store)
+	server.Close()
+
+	r := newRateLimitRouter(GuestRateLimitMiddleware(limiter, services.RouteGroupChat))
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/chat", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i, w.Code)
+		}
+	}
+}
@@ -1,41 +1,68 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/metrics"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/EyeQuila/eyeQcheck/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
-// RateLimiter holds rate limiting configuration for different user tiers
+// RateLimiter takes requests from per-client token buckets sized by the
+// caller's plan and enforces the plan's quotas. It is built once by the
+// application container and shared by the rate-limited routes.
 type RateLimiter struct {
-	// Requests per minute for free users
-	FreeUserLimit rate.Limit
-	// Burst capacity for free users
-	FreeUserBurst int
-	// Storage for user rate limiters (in production, use Redis)
-	limiters map[string]*rate.Limiter
+	// Storage for client rate limiters
+	store LimiterStore
+	plans PlanSource
 }
 
-// Global rate limiter instance
-var globalRateLimiter = &RateLimiter{
-	FreeUserLimit: rate.Every(time.Minute / 10), // 10 requests per minute
-	FreeUserBurst: 5,                            // Allow burst of 5 requests
-	limiters:      make(map[string]*rate.Limiter),
+// PlanSource looks up the plan that applies to a caller and the quota usage
+// recorded against it
+type PlanSource interface {
+	PlanForUser(userID, role string) (*model.Plan, error)
+	GuestPlan() (*model.Plan, error)
+	Quotas(subject, routeGroup string, limit *model.PlanLimit, now time.Time) ([]model.Quota, error)
+	ReserveMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) (bool, error)
+	ReleaseMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) error
+	RecordUsage(subject, routeGroup string, limit *model.PlanLimit, tokens int, audioSeconds float64, now time.Time) error
 }
 
-// Guest rate limiter (more restrictive)
-var guestRateLimiter = &RateLimiter{
-	FreeUserLimit: rate.Every(time.Minute / 3), // 3 requests per minute
-	FreeUserBurst: 2,                           // Allow burst of 2 requests
-	limiters:      make(map[string]*rate.Limiter),
+// NewRateLimiter creates a rate limiter keeping its buckets in store and
+// looking plans up in plans
+func NewRateLimiter(store LimiterStore, plans PlanSource) *RateLimiter {
+	return &RateLimiter{store: store, plans: plans}
 }
 
-// RateLimitMiddleware applies rate limiting for authenticated users
-func RateLimitMiddleware() gin.HandlerFunc {
+// NewLimiterStore returns the store selected by RATE_LIMIT_STORE. If Redis
+// is selected but its URL is invalid, limits fall back to process memory.
+func NewLimiterStore(cfg *config.Config) LimiterStore {
+	if cfg.RateLimitStore == "redis" {
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err == nil {
+			return NewRedisLimiterStore(redis.NewClient(opts), "ratelimit:")
+		}
+		slog.Warn("Invalid REDIS_URL, using in-memory rate limits", "err", err)
+	}
+	return NewMemoryLimiterStore(cfg.RateLimitIdleTimeout)
+}
+
+// RateLimitMiddleware applies the limits of the authenticated user's plan for
+// a route group ("chat" or "stt")
+func RateLimitMiddleware(limiter *RateLimiter, routeGroup string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from JWT context
 		userID := c.GetString("user_id")
@@ -45,92 +72,226 @@ func RateLimitMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Get user role to determine if rate limiting applies
-		userRole := c.GetString("user_role")
-		
-		// Skip rate limiting for authenicated users
-		if userRole == "user" || userRole == "admin" {
-			c.Next()
+		// Look up the plan assigned to this user, or their role's default
+		plan, err := limiter.plans.PlanForUser(userID, c.GetString("user_role"))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to load plan", "user_id", userID, "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plan"})
+			c.Abort()
 			return
 		}
 
-		// Get or create rate limiter for this user
-		limiter := globalRateLimiter.getLimiter(userID)
-
-		// Check if request is allowed
-		if !limiter.Allow() {
-			// Rate limit exceeded
-			c.Header("X-RateLimit-Limit", "10")
-			c.Header("X-RateLimit-Remaining", "0")
-			c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Minute).Unix()))
-			
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Rate limit exceeded",
-				"message": "Free tier allows 10 requests per minute. Upgrade to premium for unlimited access.",
-				"upgrade_url": "/api/public/upgrade",
-			})
+		limiter.enforcePlan(c, plan, routeGroup, services.UserQuotaSubject(userID), gin.H{
+			"upgrade_url": "/api/public/upgrade",
+		})
+	}
+}
+
+// GuestRateLimitMiddleware applies the guest plan's limits for a route group
+// to anonymous users, identified by IP address
+func GuestRateLimitMiddleware(limiter *RateLimiter, routeGroup string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan, err := limiter.plans.GuestPlan()
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to load guest plan", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plan"})
 			c.Abort()
 			return
 		}
 
-		// Add rate limit headers
-		remaining := limiter.Tokens()
-		c.Header("X-RateLimit-Limit", "10")
-		c.Header("X-RateLimit-Remaining", strconv.FormatFloat(remaining, 'f', 0, 64))
-		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Minute).Unix()))
+		// Use IP address as identifier for guest users
+		limiter.enforcePlan(c, plan, routeGroup, services.GuestQuotaSubject(c.ClientIP()), gin.H{
+			"signup_url": "/api/public/register-user",
+		})
+	}
+}
 
+// enforcePlan checks the per-minute rate and the daily and monthly quotas
+// the plan sets for routeGroup and reserves the request's message, then runs
+// the handler and records the tokens and audio it used. Handlers report
+// those through the "usage_tokens" and "audio_seconds" context keys.
+// hint is added to 429 bodies to tell the caller how to get more.
+func (rl *RateLimiter) enforcePlan(c *gin.Context, plan *model.Plan, routeGroup, subject string, hint gin.H) {
+	c.Header("X-RateLimit-Plan", plan.ID)
+	c.Set("plan_id", plan.ID)
+
+	limit := services.PlanLimit(plan, routeGroup)
+	if limit == nil {
+		// Nothing is limited for this route group on this plan
 		c.Next()
+		return
+	}
+
+	now := time.Now()
+	allowed, reserved := rl.checkPlanLimits(c, plan, limit, routeGroup, subject, hint, now)
+	if !allowed {
+		return
+	}
+
+	c.Next()
+
+	// Only served requests count against the quotas
+	if c.Writer.Status() >= http.StatusBadRequest {
+		if reserved {
+			if err := rl.plans.ReleaseMessage(subject, routeGroup, limit, now); err != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to release quota", "subject", subject, "err", err)
+			}
+		}
+		return
+	}
+	tokens := c.GetInt("usage_tokens")
+	audioSeconds := c.GetFloat64("audio_seconds")
+	if err := rl.plans.RecordUsage(subject, routeGroup, limit, tokens, audioSeconds, now); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record quota usage", "subject", subject, "err", err)
 	}
 }
 
-// getLimiter gets or creates a rate limiter for a specific user
-func (rl *RateLimiter) getLimiter(userID string) *rate.Limiter {
-	// In production, use Redis with TTL for distributed rate limiting
-	if limiter, exists := rl.limiters[userID]; exists {
-		return limiter
-	}
-
-	// Create new limiter for this user
-	limiter := rate.NewLimiter(rl.FreeUserLimit, rl.FreeUserBurst)
-	rl.limiters[userID] = limiter
-	
-	// TODO: In production, clean up old limiters periodically
-	// or use Redis with appropriate TTL
-	
-	return limiter
+// checkPlanLimits takes a request from the per-minute bucket, checks the
+// daily and monthly quotas and reserves the request's message, in a span of
+// its own so traces show the time spent in the limiter. It answers 429 and
+// returns false when a limit is hit; reserved reports whether the message
+// was counted and must be released if the request fails.
+func (rl *RateLimiter) checkPlanLimits(c *gin.Context, plan *model.Plan, limit *model.PlanLimit, routeGroup, subject string, hint gin.H, now time.Time) (allowed, reserved bool) {
+	ctx, span := tracing.Start(c.Request.Context(), "ratelimit "+routeGroup, trace.WithAttributes(
+		attribute.String("ratelimit.plan", plan.ID),
+		attribute.String("ratelimit.route_group", routeGroup),
+	))
+	defer span.End()
+
+	// Per-minute rate. The plan is part of the key so that a plan change
+	// starts a new bucket of the new size right away.
+	if limit.RequestsPerMinute > 0 {
+		key := routeGroup + ":" + plan.ID + ":" + subject
+		result := rl.allow(ctx, key, limit)
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.RequestsPerMinute))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", result.Reset.Unix()))
+
+		if !result.Allowed {
+			span.SetAttributes(attribute.String("ratelimit.rejected", "rate"))
+			rejectRequest(c, plan, routeGroup, "rate", hint, "Rate limit exceeded",
+				fmt.Sprintf("The %s plan allows %d requests per minute.", plan.Name, limit.RequestsPerMinute))
+			return false, false
+		}
+	}
+
+	// Daily and monthly quotas
+	quotas, err := rl.plans.Quotas(subject, routeGroup, limit, now)
+	if err != nil {
+		// Like the rate limit store, a quota lookup failure should not take
+		// the API down with it
+		slog.ErrorContext(ctx, "Failed to load quota usage", "subject", subject, "err", err)
+	}
+	if tightest := tightestQuota(quotas); tightest != nil {
+		setQuotaHeaders(c, tightest)
+		if tightest.Remaining() <= 0 {
+			span.SetAttributes(attribute.String("ratelimit.rejected", "quota"))
+			rejectRequest(c, plan, routeGroup, "quota", hint, "Quota exceeded", quotaMessage(plan, tightest))
+			return false, false
+		}
+	}
+
+	// Token and audio use is only known afterwards, but the message is
+	// counted now: concurrent requests may all pass the check above, and
+	// only as many as the quota has room for get a message
+	reserved, err = rl.plans.ReserveMessage(subject, routeGroup, limit, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to reserve quota, allowing request", "subject", subject, "err", err)
+		return true, false
+	}
+	if !reserved {
+		var messages []model.Quota
+		for _, q := range quotas {
+			if q.Metric == services.QuotaMessages {
+				messages = append(messages, q)
+			}
+		}
+		message := fmt.Sprintf("The %s plan's message quota is used up.", plan.Name)
+		if tightest := tightestQuota(messages); tightest != nil {
+			// Taken by requests that were served since it was loaded
+			tightest.Used = tightest.Limit
+			setQuotaHeaders(c, tightest)
+			message = quotaMessage(plan, tightest)
+		}
+		span.SetAttributes(attribute.String("ratelimit.rejected", "quota"))
+		rejectRequest(c, plan, routeGroup, "quota", hint, "Quota exceeded", message)
+		return false, false
+	}
+	return true, true
 }
 
-// GuestRateLimitMiddleware applies stricter rate limiting for anonymous users
-func GuestRateLimitMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Use IP address as identifier for guest users
-		clientIP := c.ClientIP()
-		
-		// Get rate limiter for this IP
-		limiter := guestRateLimiter.getLimiter(clientIP)
-
-		// Check if request is allowed
-		if !limiter.Allow() {
-			// Rate limit exceeded
-			c.Header("X-RateLimit-Limit", "3")
-			c.Header("X-RateLimit-Remaining", "0")
-			c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Minute).Unix()))
-			
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Rate limit exceeded",
-				"message": "Guest users are limited to 3 requests per minute. Please sign up for more access.",
-				"signup_url": "/api/public/register-user",
-			})
-			c.Abort()
-			return
+func setQuotaHeaders(c *gin.Context, q *model.Quota) {
+	c.Header("X-Quota-Metric", q.Metric)
+	c.Header("X-Quota-Window", q.Window)
+	c.Header("X-Quota-Limit", formatAmount(q.Limit))
+	c.Header("X-Quota-Remaining", formatAmount(q.Remaining()))
+	c.Header("X-Quota-Reset", fmt.Sprintf("%d", q.Reset.Unix()))
+}
+
+func quotaMessage(plan *model.Plan, q *model.Quota) string {
+	return fmt.Sprintf("The %s plan allows %s %s per %s.", plan.Name, formatAmount(q.Limit), quotaUnit(q.Metric), q.Window)
+}
+
+// rejectRequest answers 429 with the limit that was hit. kind ("rate" or
+// "quota") labels the rejection in the metrics.
+func rejectRequest(c *gin.Context, plan *model.Plan, routeGroup, kind string, hint gin.H, reason, message string) {
+	metrics.RateLimitRejections.WithLabelValues(plan.ID, routeGroup, kind).Inc()
+
+	body := gin.H{
+		"error":   reason,
+		"message": message,
+		"plan":    plan.ID,
+	}
+	for key, value := range hint {
+		body[key] = value
+	}
+	c.JSON(http.StatusTooManyRequests, body)
+	c.Abort()
+}
+
+// tightestQuota returns the quota with the smallest share left
+func tightestQuota(quotas []model.Quota) *model.Quota {
+	var tightest *model.Quota
+	for i := range quotas {
+		q := &quotas[i]
+		if tightest == nil || q.Remaining()/q.Limit < tightest.Remaining()/tightest.Limit {
+			tightest = q
 		}
+	}
+	return tightest
+}
+
+func quotaUnit(metric string) string {
+	switch metric {
+	case services.QuotaSTTMinutes:
+		return "speech-to-text minutes"
+	case services.QuotaTokens:
+		return "tokens"
+	}
+	return "messages"
+}
 
-		// Add rate limit headers
-		remaining := limiter.Tokens()
-		c.Header("X-RateLimit-Limit", "3")
-		c.Header("X-RateLimit-Remaining", strconv.FormatFloat(remaining, 'f', 0, 64))
-		c.Header("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Minute).Unix()))
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(math.Floor(amount*10)/10, 'f', -1, 64)
+}
 
-		c.Next()
+// allow takes one request from key's bucket. If the store cannot be reached
+// the request is let through: an outage of the limiter store should not
+// take the API down with it.
+func (rl *RateLimiter) allow(ctx context.Context, key string, planLimit *model.PlanLimit) LimitResult {
+	limit := Limit{
+		Rate:  rate.Every(time.Minute / time.Duration(planLimit.RequestsPerMinute)),
+		Burst: planLimit.Burst,
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+
+	result, err := rl.store.Allow(ctx, key, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "Rate limit store error, allowing request", "err", err)
+		return LimitResult{Allowed: true, Remaining: limit.Burst, Reset: time.Now()}
 	}
+	return result
 }
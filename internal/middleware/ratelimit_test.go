@@ -0,0 +1,454 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// fakePlanSource serves fixed plans and keeps quota usage in memory
+type fakePlanSource struct {
+	mu    sync.Mutex
+	plans map[string]*model.Plan
+	usage map[string]float64
+}
+
+func newFakePlanSource() *fakePlanSource {
+	return &fakePlanSource{
+		plans: map[string]*model.Plan{
+			services.PlanGuest: {ID: services.PlanGuest, Name: "Guest", Limits: []model.PlanLimit{
+				{RouteGroup: services.RouteGroupChat, RequestsPerMinute: 1, Burst: 2},
+			}},
+			services.PlanFree: {ID: services.PlanFree, Name: "Free", Limits: []model.PlanLimit{
+				{RouteGroup: services.RouteGroupChat, RequestsPerMinute: 1, Burst: 5},
+				{RouteGroup: services.RouteGroupSTT, RequestsPerMinute: 60, Burst: 60, DailyMessages: 3, DailySTTMinutes: 1},
+			}},
+			services.PlanPremium: {ID: services.PlanPremium, Name: "Premium", Limits: []model.PlanLimit{
+				{RouteGroup: services.RouteGroupChat, RequestsPerMinute: 1, Burst: 20, DailyTokens: 100},
+			}},
+			services.PlanInternal: {ID: services.PlanInternal, Name: "Internal"},
+		},
+		usage: make(map[string]float64),
+	}
+}
+
+func (f *fakePlanSource) PlanForUser(userID, role string) (*model.Plan, error) {
+	switch {
+	case role == "admin":
+		return f.plans[services.PlanInternal], nil
+	case role == "premium":
+		return f.plans[services.PlanPremium], nil
+	}
+	return f.plans[services.PlanFree], nil
+}
+
+func (f *fakePlanSource) GuestPlan() (*model.Plan, error) {
+	return f.plans[services.PlanGuest], nil
+}
+
+func (f *fakePlanSource) Quotas(subject, routeGroup string, limit *model.PlanLimit, now time.Time) ([]model.Quota, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var quotas []model.Quota
+	if limit.DailyMessages > 0 {
+		quotas = append(quotas, model.Quota{
+			Metric: services.QuotaMessages, Window: services.QuotaDay,
+			Limit: float64(limit.DailyMessages), Used: f.usage[subject+"/"+routeGroup+"/messages"],
+		})
+	}
+	if limit.DailyTokens > 0 {
+		quotas = append(quotas, model.Quota{
+			Metric: services.QuotaTokens, Window: services.QuotaDay,
+			Limit: float64(limit.DailyTokens), Used: f.usage[subject+"/"+routeGroup+"/tokens"],
+		})
+	}
+	if limit.DailySTTMinutes > 0 {
+		quotas = append(quotas, model.Quota{
+			Metric: services.QuotaSTTMinutes, Window: services.QuotaDay,
+			Limit: limit.DailySTTMinutes, Used: f.usage[subject+"/"+routeGroup+"/seconds"] / 60,
+		})
+	}
+	return quotas, nil
+}
+
+func (f *fakePlanSource) ReserveMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := subject + "/" + routeGroup + "/messages"
+	if limit.DailyMessages > 0 && f.usage[key] >= float64(limit.DailyMessages) {
+		return false, nil
+	}
+	f.usage[key]++
+	return true, nil
+}
+
+func (f *fakePlanSource) ReleaseMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.usage[subject+"/"+routeGroup+"/messages"]--
+	return nil
+}
+
+func (f *fakePlanSource) RecordUsage(subject, routeGroup string, limit *model.PlanLimit, tokens int, audioSeconds float64, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.usage[subject+"/"+routeGroup+"/tokens"] += float64(tokens)
+	f.usage[subject+"/"+routeGroup+"/seconds"] += audioSeconds
+	return nil
+}
+
+// newTestLimiter returns a limiter backed by store and fake plans whose
+// buckets do not refill during the test
+func newTestLimiter(store LimiterStore) *RateLimiter {
+	return NewRateLimiter(store, newFakePlanSource())
+}
+
+func newRateLimitRouter(middleware gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if id := c.GetHeader("X-Test-User"); id != "" {
+			c.Set("user_id", id)
+			c.Set("user_role", c.GetHeader("X-Test-Role"))
+		}
+		c.Next()
+	})
+	r.Use(middleware)
+	r.POST("/chat", func(c *gin.Context) {
+		if seconds := c.GetHeader("X-Test-Audio-Seconds"); seconds != "" {
+			audioSeconds, _ := strconv.ParseFloat(seconds, 64)
+			c.Set("audio_seconds", audioSeconds)
+		}
+		if tokens := c.GetHeader("X-Test-Tokens"); tokens != "" {
+			usageTokens, _ := strconv.Atoi(tokens)
+			c.Set("usage_tokens", usageTokens)
+		}
+		if status := c.GetHeader("X-Test-Status"); status != "" {
+			code, _ := strconv.Atoi(status)
+			c.Status(code)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+// hammer sends requests from clients in parallel and counts the responses
+// per client that were let through
+func hammer(t *testing.T, r *gin.Engine, clients, requestsPerClient int, prepare func(req *http.Request, client int)) []int64 {
+	t.Helper()
+
+	allowed := make([]int64, clients)
+	var wg sync.WaitGroup
+	for client := 0; client < clients; client++ {
+		for i := 0; i < requestsPerClient; i++ {
+			wg.Add(1)
+			go func(client int) {
+				defer wg.Done()
+				req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+				prepare(req, client)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				switch w.Code {
+				case http.StatusOK:
+					atomic.AddInt64(&allowed[client], 1)
+				case http.StatusTooManyRequests:
+				default:
+					t.Errorf("unexpected status %d", w.Code)
+				}
+			}(client)
+		}
+	}
+	wg.Wait()
+	return allowed
+}
+
+func TestRateLimitMiddlewareParallelClients(t *testing.T) {
+	store := NewMemoryLimiterStore(time.Minute)
+	limiter := newTestLimiter(store)
+	r := newRateLimitRouter(RateLimitMiddleware(limiter, services.RouteGroupChat))
+
+	const clients, requests = 50, 20
+	allowed := hammer(t, r, clients, requests, func(req *http.Request, client int) {
+		req.Header.Set("X-Test-User", fmt.Sprintf("user-%d", client))
+	})
+
+	for client, n := range allowed {
+		if n != 5 {
+			t.Errorf("client %d: got %d allowed requests, want 5", client, n)
+		}
+	}
+	if got := store.size(); got != clients {
+		t.Errorf("tracked %d clients, want %d", got, clients)
+	}
+}
+
+func TestGuestRateLimitMiddlewareParallelClients(t *testing.T) {
+	store := NewMemoryLimiterStore(time.Minute)
+	limiter := newTestLimiter(store)
+	r := newRateLimitRouter(GuestRateLimitMiddleware(limiter, services.RouteGroupChat))
+
+	const clients, requests = 50, 20
+	allowed := hammer(t, r, clients, requests, func(req *http.Request, client int) {
+		req.RemoteAddr = fmt.Sprintf("10.0.%d.%d:4321", client/256, client%256)
+	})
+
+	for client, n := range allowed {
+		if n != 2 {
+			t.Errorf("client %d: got %d allowed requests, want 2", client, n)
+		}
+	}
+	if got := store.size(); got != clients {
+		t.Errorf("tracked %d clients, want %d", got, clients)
+	}
+}
+
+func TestMemoryLimiterStoreEvictsIdleClients(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryLimiterStore(time.Minute)
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: rate.Every(time.Hour), Burst: 1}
+	allow := func(key string) bool {
+		result, err := store.Allow(context.Background(), key, limit)
+		if err != nil {
+			t.Fatalf("Allow(%q): %v", key, err)
+		}
+		return result.Allowed
+	}
+
+	if !allow("idle") {
+		t.Fatal("first request was rejected")
+	}
+	allow("active")
+
+	now = now.Add(40 * time.Second)
+	allow("active")
+	if allow("idle") {
+		t.Fatal("limiter was reset before it went idle")
+	}
+
+	// The next sweep finds "idle" unused for a full minute
+	now = now.Add(time.Minute)
+	allow("active")
+
+	if got := store.size(); got != 1 {
+		t.Fatalf("tracked %d clients after eviction, want 1", got)
+	}
+	if !allow("idle") {
+		t.Fatal("evicted client did not start with a full bucket")
+	}
+}
+
+func postAs(r *gin.Engine, userID, role string, audioSeconds string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+	req.Header.Set("X-Test-User", userID)
+	req.Header.Set("X-Test-Role", role)
+	if audioSeconds != "" {
+		req.Header.Set("X-Test-Audio-Seconds", audioSeconds)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddlewareUsesCallerPlan(t *testing.T) {
+	limiter := newTestLimiter(NewMemoryLimiterStore(time.Minute))
+	r := newRateLimitRouter(RateLimitMiddleware(limiter, services.RouteGroupChat))
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 6; i++ {
+		w = postAs(r, "alice", "user", "")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("6th free request: got status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("X-RateLimit-Plan"); got != services.PlanFree {
+		t.Errorf("X-RateLimit-Plan = %q, want free", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("X-RateLimit-Limit = %q, want the plan's 1 per minute", got)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "The Free plan allows 1 requests per minute.") || !strings.Contains(body, "/api/public/upgrade") {
+		t.Errorf("429 body does not describe the plan: %s", body)
+	}
+
+	// A plan change gets a new, larger bucket straight away
+	w = postAs(r, "alice", "premium", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("after upgrade: got status %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "19" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 19", got)
+	}
+
+	// Plans without limits for a route group let everything through
+	for i := 0; i < 50; i++ {
+		if w := postAs(r, "root", "admin", ""); w.Code != http.StatusOK {
+			t.Fatalf("internal plan request %d: got status %d", i, w.Code)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareQuotas(t *testing.T) {
+	limiter := newTestLimiter(NewMemoryLimiterStore(time.Minute))
+	r := newRateLimitRouter(RateLimitMiddleware(limiter, services.RouteGroupSTT))
+
+	// 1 STT minute per day: two 40 second clips use it up
+	for i := 0; i < 2; i++ {
+		if w := postAs(r, "bob", "user", "40"); w.Code != http.StatusOK {
+			t.Fatalf("clip %d: got status %d, want 200", i, w.Code)
+		}
+	}
+	w := postAs(r, "bob", "user", "40")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third clip: got status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("X-Quota-Metric"); got != services.QuotaSTTMinutes {
+		t.Errorf("X-Quota-Metric = %q, want stt_minutes", got)
+	}
+	if !strings.Contains(w.Body.String(), "The Free plan allows 1 speech-to-text minutes per day.") {
+		t.Errorf("429 body does not describe the quota: %s", w.Body.String())
+	}
+
+	// 3 requests per day
+	for i := 0; i < 3; i++ {
+		if w := postAs(r, "carol", "user", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i, w.Code)
+		}
+	}
+	w = postAs(r, "carol", "user", "")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "Quota exceeded") {
+		t.Fatalf("4th request: got %d %s, want a quota rejection", w.Code, w.Body.String())
+	}
+}
+
+func TestRateLimitMiddlewareTokenQuota(t *testing.T) {
+	limiter := newTestLimiter(NewMemoryLimiterStore(time.Minute))
+	r := newRateLimitRouter(RateLimitMiddleware(limiter, services.RouteGroupChat))
+
+	postTokens := func(tokens string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+		req.Header.Set("X-Test-User", "dave")
+		req.Header.Set("X-Test-Role", "premium")
+		req.Header.Set("X-Test-Tokens", tokens)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 100 tokens per day: the third 40 token reply still fits under the
+	// quota when it starts, the fourth does not
+	for i := 0; i < 3; i++ {
+		if w := postTokens("40"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i, w.Code)
+		}
+	}
+	w := postTokens("40")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("4th request: got status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("X-Quota-Metric"); got != services.QuotaTokens {
+		t.Errorf("X-Quota-Metric = %q, want tokens", got)
+	}
+	if !strings.Contains(w.Body.String(), "The Premium plan allows 100 tokens per day.") {
+		t.Errorf("429 body does not describe the quota: %s", w.Body.String())
+	}
+}
+
+func TestRateLimitMiddlewareReservesMessages(t *testing.T) {
+	limiter := newTestLimiter(NewMemoryLimiterStore(time.Minute))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "erin")
+		c.Set("user_role", "user")
+	}, RateLimitMiddleware(limiter, services.RouteGroupSTT))
+
+	// Served requests hold the handler until every request has been checked
+	started, release := make(chan struct{}), make(chan struct{})
+	r.POST("/chat", func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	// 3 requests per day: of 6 concurrent ones, 3 get through even though
+	// none has finished when the others are checked
+	codes := make(chan int, 6)
+	for i := 0; i < 6; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/chat", nil))
+			codes <- w.Code
+		}()
+	}
+	for served, rejected := 0, 0; served+rejected < 6; {
+		select {
+		case <-started:
+			served++
+		case code := <-codes:
+			if code != http.StatusTooManyRequests {
+				t.Fatalf("got status %d before any request was served, want 429", code)
+			}
+			rejected++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d requests served and %d rejected, want 3 and 3", served, rejected)
+		}
+		if served > 3 {
+			t.Fatal("more requests were let through than the quota allows")
+		}
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("served request: got status %d, want 200", code)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareFailedRequestsKeepQuota(t *testing.T) {
+	limiter := newTestLimiter(NewMemoryLimiterStore(time.Minute))
+	r := newRateLimitRouter(RateLimitMiddleware(limiter, services.RouteGroupSTT))
+	post := func(status string) int {
+		req := httptest.NewRequest(http.MethodPost, "/chat", nil)
+		req.Header.Set("X-Test-User", "frank")
+		req.Header.Set("X-Test-Role", "user")
+		req.Header.Set("X-Test-Status", status)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Failed requests give their reserved message back
+	for i := 0; i < 5; i++ {
+		if code := post("502"); code != http.StatusBadGateway {
+			t.Fatalf("failed request %d: got status %d, want 502", i, code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if code := post("200"); code != http.StatusOK {
+			t.Fatalf("request %d after failures: got status %d, want 200", i, code)
+		}
+	}
+	if code := post("200"); code != http.StatusTooManyRequests {
+		t.Errorf("4th served request: got status %d, want 429", code)
+	}
+}
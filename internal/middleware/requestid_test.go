@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func newRequestIDRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/ping", func(c *gin.Context) {
+		// The handler sees the same ID in the gin and request contexts
+		if logging.RequestID(c.Request.Context()) != c.GetString("request_id") {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, c.GetString("request_id"))
+	})
+	return r
+}
+
+func TestRequestIDEchoesCallerID(t *testing.T) {
+	r := newRequestIDRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(RequestIDHeader, "edge-1234.abc")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get(RequestIDHeader); got != "edge-1234.abc" {
+		t.Errorf("%s = %q, want the caller's ID", RequestIDHeader, got)
+	}
+	if w.Body.String() != "edge-1234.abc" {
+		t.Errorf("handler saw request ID %q", w.Body.String())
+	}
+}
+
+func TestRequestIDGeneratesID(t *testing.T) {
+	r := newRequestIDRouter()
+
+	for name, header := range map[string]string{
+		"missing":   "",
+		"malformed": "bad id\nlevel=ERROR",
+		"too long":  strings.Repeat("a", 129),
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", name, w.Code)
+		}
+		got := w.Header().Get(RequestIDHeader)
+		if _, err := uuid.Parse(got); err != nil {
+			t.Errorf("%s: %s = %q, want a generated UUID", name, RequestIDHeader, got)
+		}
+		if w.Body.String() != got {
+			t.Errorf("%s: handler saw request ID %q, response carries %q", name, w.Body.String(), got)
+		}
+	}
+}
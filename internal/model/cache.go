@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// CachedResponse is a persisted entry of the chat response cache
+type CachedResponse struct {
+	Key       string    `json:"key" gorm:"column:cache_key;primaryKey;type:varchar(64)"`
+	Backend   string    `json:"backend" gorm:"type:varchar(32);index"`
+	Model     string    `json:"model,omitempty" gorm:"type:varchar(128)"`
+	Reply     string    `json:"reply" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// CacheInvalidateResponse reports how many cache entries were removed
+type CacheInvalidateResponse struct {
+	Message     string `json:"message" example:"Response cache invalidated"`
+	Invalidated int64  `json:"invalidated" example:"12"`
+}
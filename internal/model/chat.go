@@ -2,8 +2,36 @@ package model
 
 // GPTRequest represents the request sent to the OpenAI API.
 type GPTRequest struct {
-	Model    string       `json:"model"`
-	Messages []GPTMessage `json:"messages"`
+	Model         string            `json:"model"`
+	Messages      []GPTMessage      `json:"messages"`
+	Stream        bool              `json:"stream,omitempty"`
+	StreamOptions *GPTStreamOptions `json:"stream_options,omitempty"`
+}
+
+// GPTStreamOptions asks an OpenAI-compatible API to report usage when streaming
+type GPTStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// GPTResponse represents a response, or a streamed chunk, from an
+// OpenAI-compatible chat completions API
+type GPTResponse struct {
+	Model   string      `json:"model"`
+	Choices []GPTChoice `json:"choices"`
+	Usage   *Usage      `json:"usage,omitempty"`
+	Error   *GPTError   `json:"error,omitempty"`
+}
+
+// GPTChoice is one completion choice; Delta is set instead of Message when streaming
+type GPTChoice struct {
+	Message      GPTMessage `json:"message"`
+	Delta        GPTMessage `json:"delta"`
+	FinishReason string     `json:"finish_reason"`
+}
+
+// GPTError is the error object returned by OpenAI-compatible APIs
+type GPTError struct {
+	Message string `json:"message"`
 }
 
 // GPTMessage represents a single message in the conversation
@@ -12,10 +40,17 @@ type GPTMessage struct {
     Content string `json:"content" binding:"required" example:"Hello, how are you?"`
 }
 
-// ChatRequest represents the request body for chat endpoint
+// ChatRequest represents the request body for chat endpoint.
+// Clients either send the full history in Messages, or a single new Message
+// and let the server rebuild the history from the stored thread.
 type ChatRequest struct {
-    Messages []GPTMessage `json:"messages" binding:"required"`
+    Messages []GPTMessage `json:"messages,omitempty"`
+    Message  *GPTMessage  `json:"message,omitempty"`
     ThreadID string       `json:"thread_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+    Stream   bool         `json:"stream,omitempty" example:"false"`
+    // Backend and Model override the deployment defaults; admins only
+    Backend  string       `json:"backend,omitempty" example:"openai" enums:"rag,openai,echo"`
+    Model    string       `json:"model,omitempty" example:"gpt-4o-mini"`
 }
 
 // ChatResponse represents the response from chat endpoint
@@ -23,11 +58,34 @@ type ChatResponse struct {
     Reply    string `json:"reply" example:"Hello! How can I help you with your eye examination today?"`
     ThreadID string `json:"thread_id" example:"550e8400-e29b-41d4-a716-446655440000"`
     Cached   bool   `json:"cached" example:"false"`
+    // Usage is the token usage of this reply, estimated when the backend
+    // does not report it
+    Usage    *Usage `json:"usage,omitempty"`
+}
+
+// Usage reports token consumption for a single upstream call
+type Usage struct {
+    PromptTokens     int `json:"prompt_tokens" example:"42"`
+    CompletionTokens int `json:"completion_tokens" example:"128"`
+    TotalTokens      int `json:"total_tokens" example:"170"`
+}
+
+// ChatStreamDelta is sent as an SSE "delta" event for every token chunk
+type ChatStreamDelta struct {
+    Delta string `json:"delta" example:"Hello"`
+}
+
+// ChatStreamDone is sent as the final SSE "done" event of a streamed reply
+type ChatStreamDone struct {
+    ThreadID string `json:"thread_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+    Usage    *Usage `json:"usage,omitempty"`
+    Cached   bool   `json:"cached" example:"false"`
 }
 
 type RAGResponse struct {
     Reply    string `json:"reply"`
     ThreadID string `json:"thread_id"`
+    Usage    *Usage `json:"usage,omitempty"`
     Error    string `json:"error"`
 }
 
@@ -35,4 +93,13 @@ type RAGResponse struct {
 type STTResponse struct {
     Text     string `json:"text" example:"Hello, I would like to book an eye examination"`
     Filename string `json:"filename,omitempty" example:"audio.wav"`
-}
\ No newline at end of file
+}
+
+// RAGStreamChunk is a single event emitted by the streaming RAG endpoint
+type RAGStreamChunk struct {
+    Delta    string `json:"delta"`
+    ThreadID string `json:"thread_id"`
+    Usage    *Usage `json:"usage,omitempty"`
+    Done     bool   `json:"done"`
+    Error    string `json:"error"`
+}
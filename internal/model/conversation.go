@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Conversation is a chat thread. Its ID is the thread_id exchanged with clients
+// and with the RAG service.
+type Conversation struct {
+	ID            string         `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	UserID        string         `json:"user_id,omitempty" gorm:"type:varchar(128);index"`
+	Title         string         `json:"title,omitempty"`
+	CandidateName string         `json:"candidate_name,omitempty"`
+	Position      string         `json:"position,omitempty"`
+	InterviewDate string         `json:"interview_date,omitempty"`
+	Status        string         `json:"status,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" gorm:"index"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Message is a single turn within a Conversation
+type Message struct {
+	ID             uint64    `json:"id" gorm:"primaryKey;autoIncrement"`
+	ConversationID string    `json:"conversation_id" gorm:"type:varchar(64);index;not null"`
+	Role           string    `json:"role" gorm:"type:varchar(16);not null"`
+	Content        string    `json:"content" gorm:"type:text"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Upstream metadata, only set on assistant messages
+	Backend          string `json:"backend,omitempty" gorm:"type:varchar(32)"`
+	Model            string `json:"model,omitempty" gorm:"type:varchar(128)"`
+	UpstreamThreadID string `json:"upstream_thread_id,omitempty" gorm:"type:varchar(64)"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	LatencyMS        int64  `json:"latency_ms,omitempty"`
+	Cached           bool   `json:"cached,omitempty"`
+}
+
+// ConversationListResponse represents a page of the caller's conversations
+type ConversationListResponse struct {
+	Conversations []Conversation `json:"conversations"`
+	Page          int            `json:"page" example:"1"`
+	PageSize      int            `json:"page_size" example:"20"`
+	Total         int64          `json:"total" example:"42"`
+}
+
+// ConversationDetailResponse represents a conversation with its messages
+type ConversationDetailResponse struct {
+	Conversation Conversation `json:"conversation"`
+	Messages     []Message    `json:"messages"`
+}
+
+// RenameConversationRequest represents the request to rename a conversation
+type RenameConversationRequest struct {
+	Title string `json:"title" binding:"required,max=200" example:"Eye exam follow-up"`
+}
@@ -0,0 +1,35 @@
+package model
+
+// Readiness check statuses
+const (
+	CheckStatusOK   = "ok"
+	CheckStatusFail = "fail"
+)
+
+// Readiness statuses
+const (
+	ReadinessReady    = "ready"
+	ReadinessNotReady = "not_ready"
+)
+
+// LivenessResponse is returned by /livez while the process is serving
+type LivenessResponse struct {
+	Status string `json:"status" example:"alive"`
+}
+
+// ReadinessCheck is the outcome of one dependency check
+type ReadinessCheck struct {
+	Status string `json:"status" example:"ok" enums:"ok,fail"`
+	// Required checks make the service unready when they fail
+	Required  bool    `json:"required" example:"true"`
+	LatencyMS float64 `json:"latency_ms" example:"1.25"`
+	// Cached is set when the result of an earlier probe was reused
+	Cached bool   `json:"cached,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessResponse is returned by /readyz
+type ReadinessResponse struct {
+	Status string                    `json:"status" example:"ready" enums:"ready,not_ready"`
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
@@ -0,0 +1,85 @@
+package model
+
+import "time"
+
+// Plan is a service tier with its own rate limits and quotas
+type Plan struct {
+	ID          string `json:"id" gorm:"primaryKey;type:varchar(32)"`
+	Name        string `json:"name" gorm:"type:varchar(100);not null"`
+	Description string `json:"description,omitempty"`
+	// Rank orders plans from the most to the least restricted; a plan with a
+	// higher rank is an upgrade
+	Rank int `json:"rank"`
+	// PriceCents is the monthly price in the currency's minor unit. Plans
+	// without a price cannot be bought through the upgrade flow.
+	PriceCents int64       `json:"price_cents"`
+	Currency   string      `json:"currency,omitempty" gorm:"type:varchar(3)"`
+	Limits     []PlanLimit `json:"limits" gorm:"foreignKey:PlanID;constraint:OnDelete:CASCADE"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// PlanLimit holds a plan's limits for one route group, e.g. "chat" or "stt".
+// A zero value means that dimension is unlimited.
+type PlanLimit struct {
+	ID                uint    `json:"-" gorm:"primaryKey"`
+	PlanID            string  `json:"-" gorm:"type:varchar(32);not null;uniqueIndex:idx_plan_limit_group"`
+	RouteGroup        string  `json:"route_group" gorm:"type:varchar(32);not null;uniqueIndex:idx_plan_limit_group"`
+	RequestsPerMinute int     `json:"requests_per_minute"`
+	Burst             int     `json:"burst"`
+	DailyMessages     int     `json:"daily_messages"`
+	MonthlyMessages   int     `json:"monthly_messages"`
+	DailyTokens       int     `json:"daily_tokens"`
+	MonthlyTokens     int     `json:"monthly_tokens"`
+	DailySTTMinutes   float64 `json:"daily_stt_minutes"`
+	MonthlySTTMinutes float64 `json:"monthly_stt_minutes"`
+}
+
+// UserPlan assigns a plan to a user. Users without one get their role's
+// default plan.
+type UserPlan struct {
+	UserID    string    `json:"user_id" gorm:"primaryKey;type:varchar(128)"`
+	PlanID    string    `json:"plan_id" gorm:"type:varchar(32);not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QuotaUsage accumulates how much of a quota a subject (a user or a guest
+// IP) used in one route group during one period, e.g. a day or a month
+type QuotaUsage struct {
+	Subject    string  `gorm:"primaryKey;type:varchar(255)"`
+	RouteGroup string  `gorm:"primaryKey;type:varchar(32)"`
+	Metric     string  `gorm:"primaryKey;type:varchar(32)"`
+	Period     string  `gorm:"primaryKey;type:varchar(16)"`
+	Amount     float64 `gorm:"not null;default:0"`
+	UpdatedAt  time.Time
+}
+
+// Quota is one daily or monthly allowance and how much of it is used
+type Quota struct {
+	Metric string    `json:"metric" example:"messages" enums:"messages,tokens,stt_minutes"`
+	Window string    `json:"window" example:"day" enums:"day,month"`
+	Limit  float64   `json:"limit" example:"50"`
+	Used   float64   `json:"used" example:"12"`
+	Reset  time.Time `json:"reset"`
+}
+
+// Remaining returns how much of the quota is left
+func (q Quota) Remaining() float64 {
+	if q.Used >= q.Limit {
+		return 0
+	}
+	return q.Limit - q.Used
+}
+
+// Request/Response structs for plan operations
+
+// PlanListResponse represents the list of available plans
+type PlanListResponse struct {
+	Plans []Plan `json:"plans"`
+}
+
+// AssignPlanRequest represents the request to move a user to another plan
+type AssignPlanRequest struct {
+	PlanID string `json:"plan_id" binding:"required"`
+}
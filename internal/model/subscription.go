@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// Subscription statuses
+const (
+	SubscriptionPending  = "pending"
+	SubscriptionActive   = "active"
+	SubscriptionFailed   = "failed"
+	SubscriptionCanceled = "canceled"
+)
+
+// Subscription is a user's purchase of a paid plan through a payment provider
+type Subscription struct {
+	ID     string `json:"id" gorm:"primaryKey;type:varchar(64)"`
+	UserID string `json:"user_id" gorm:"type:varchar(128);not null;index"`
+	PlanID string `json:"plan_id" gorm:"type:varchar(32);not null"`
+	Status string `json:"status" gorm:"type:varchar(16);not null;index"`
+	// Provider is the payment provider that handles the subscription
+	Provider string `json:"provider" gorm:"type:varchar(32);not null"`
+	// CheckoutSessionID is the provider's ID for the checkout session
+	CheckoutSessionID string `json:"-" gorm:"type:varchar(128);uniqueIndex"`
+	// ProviderSubscriptionID is the provider's ID once payment succeeded
+	ProviderSubscriptionID string     `json:"-" gorm:"type:varchar(128);index"`
+	CurrentPeriodEnd       *time.Time `json:"current_period_end,omitempty"`
+	CanceledAt             *time.Time `json:"canceled_at,omitempty"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+}
+
+// Request/Response structs for the upgrade flow
+
+// UpgradeCatalogResponse represents the plans that can be bought
+type UpgradeCatalogResponse struct {
+	Plans []Plan `json:"plans"`
+}
+
+// CheckoutSessionRequest represents the request to start buying a plan
+type CheckoutSessionRequest struct {
+	PlanID string `json:"plan_id" binding:"required"`
+}
+
+// CheckoutSessionResponse represents a started checkout
+type CheckoutSessionResponse struct {
+	SubscriptionID string `json:"subscription_id"`
+	SessionID      string `json:"session_id"`
+	CheckoutURL    string `json:"checkout_url"`
+}
+
+// SubscriptionStatusResponse represents the caller's plan and their most
+// recent subscription, if any
+type SubscriptionStatusResponse struct {
+	PlanID       string        `json:"plan_id"`
+	Subscription *Subscription `json:"subscription,omitempty"`
+}
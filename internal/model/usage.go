@@ -0,0 +1,71 @@
+package model
+
+import "time"
+
+// Usage record kinds
+const (
+	UsageKindChat = "chat"
+	UsageKindSTT  = "stt"
+)
+
+// UsageRecord is what one chat reply or transcription consumed
+type UsageRecord struct {
+	ID       uint64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID   string `json:"user_id" gorm:"type:varchar(128);index:idx_usage_user_created"`
+	ThreadID string `json:"thread_id,omitempty" gorm:"type:varchar(64);index"`
+	PlanID   string `json:"plan_id" gorm:"type:varchar(32);index"`
+	Kind     string `json:"kind" gorm:"type:varchar(16);not null"`
+	Backend  string `json:"backend,omitempty" gorm:"type:varchar(32)"`
+	Model    string `json:"model,omitempty" gorm:"type:varchar(100)"`
+
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+	// Estimated is set when the backend did not report token usage and it
+	// was estimated locally
+	Estimated bool `json:"estimated"`
+	// Cached is set for replies served from the response cache
+	Cached bool `json:"cached"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"index;index:idx_usage_user_created"`
+}
+
+// Request/Response structs for usage reporting
+
+// UsageTotals sums usage records
+type UsageTotals struct {
+	Requests         int64   `json:"requests" example:"42"`
+	PromptTokens     int64   `json:"prompt_tokens" example:"12000"`
+	CompletionTokens int64   `json:"completion_tokens" example:"8000"`
+	TotalTokens      int64   `json:"total_tokens" example:"20000"`
+	AudioSeconds     float64 `json:"audio_seconds" example:"95.5"`
+}
+
+// UsageGroup is the usage of one thread, plan, user, model or day
+type UsageGroup struct {
+	Key string `json:"key" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UsageTotals
+}
+
+// UsageSummaryResponse represents the caller's usage over a time range
+type UsageSummaryResponse struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	PlanID  string       `json:"plan_id" example:"free"`
+	Totals  UsageTotals  `json:"totals"`
+	Threads []UsageGroup `json:"threads"`
+	Plans   []UsageGroup `json:"plans"`
+	// Quotas are the caller's current quotas per route group
+	Quotas map[string][]Quota `json:"quotas,omitempty"`
+}
+
+// UsageAggregateResponse represents usage of all users over a time range,
+// grouped by one dimension
+type UsageAggregateResponse struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	GroupBy string       `json:"group_by" example:"plan"`
+	Totals  UsageTotals  `json:"totals"`
+	Groups  []UsageGroup `json:"groups"`
+}
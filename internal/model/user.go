@@ -4,39 +4,39 @@ import "time"
 
 // User represents a user in the system
 type User struct {
-	ID          string    `json:"id" db:"id"`
-	Email       string    `json:"email" db:"email"`
-	DisplayName string    `json:"display_name" db:"display_name"`
-	GoogleID    string    `json:"google_id,omitempty" db:"google_id"`
-	AvatarURL   string    `json:"avatar_url,omitempty" db:"avatar_url"`
-	Role        string    `json:"role" db:"role"`
-	IsActive    bool      `json:"is_active" db:"is_active"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
-	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+	ID          string     `json:"id" gorm:"primaryKey;type:varchar(128)"`
+	Email       string     `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
+	DisplayName string     `json:"display_name" gorm:"type:varchar(255)"`
+	GoogleID    string     `json:"google_id,omitempty" gorm:"type:varchar(128);index"`
+	AvatarURL   string     `json:"avatar_url,omitempty" gorm:"type:text"`
+	Role        string     `json:"role" gorm:"type:varchar(32);not null;default:user"`
+	IsActive    bool       `json:"is_active" gorm:"not null"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
 }
 
 // UserPreferences represents user preferences for the eye examination system
 type UserPreferences struct {
-	UserID             string `json:"user_id" db:"user_id"`
-	Language           string `json:"language" db:"language"`
-	NotificationsEmail bool   `json:"notifications_email" db:"notifications_email"`
-	NotificationsPush  bool   `json:"notifications_push" db:"notifications_push"`
-	ThemePreference    string `json:"theme_preference" db:"theme_preference"`
-	CreatedAt          time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+	UserID             string    `json:"user_id" gorm:"primaryKey;type:varchar(128)"`
+	Language           string    `json:"language" gorm:"type:varchar(8);not null"`
+	NotificationsEmail bool      `json:"notifications_email"`
+	NotificationsPush  bool      `json:"notifications_push"`
+	ThemePreference    string    `json:"theme_preference" gorm:"type:varchar(16)"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
 }
 
 // Request/Response structs for user operations
 
-// RegisterUserRequest represents the request to register a user from external OAuth system
+// RegisterUserRequest represents the request to register a user from external OAuth system.
+// The user is the token's subject; UserID is optional and must match it.
 type RegisterUserRequest struct {
-	UserID      string `json:"user_id" binding:"required"`
+	UserID      string `json:"user_id,omitempty"`
 	Email       string `json:"email" binding:"required,email"`
 	DisplayName string `json:"display_name" binding:"required"`
 	GoogleID    string `json:"google_id,omitempty"`
 	AvatarURL   string `json:"avatar_url,omitempty"`
-	Role        string `json:"role,omitempty"`
 }
 
 // RegisterUserResponse represents the response after user registration
@@ -55,4 +55,13 @@ type UpdateUserProfileRequest struct {
 	GoogleID    string `json:"google_id,omitempty"`
 	AvatarURL   string `json:"avatar_url,omitempty"`
 	Role        string `json:"role,omitempty"`
-}
\ No newline at end of file
+}
+
+// UpdatePreferencesRequest represents a partial update of user preferences.
+// Omitted fields keep their current value.
+type UpdatePreferencesRequest struct {
+	Language           *string `json:"language,omitempty" example:"en"`
+	NotificationsEmail *bool   `json:"notifications_email,omitempty" example:"true"`
+	NotificationsPush  *bool   `json:"notifications_push,omitempty" example:"false"`
+	ThemePreference    *string `json:"theme_preference,omitempty" example:"dark" enums:"light,dark,system"`
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CacheRepository provides methods to interact with persisted cache entries
+type CacheRepository struct {
+	db *gorm.DB
+}
+
+// NewCacheRepository creates a new CacheRepository instance
+func NewCacheRepository(db *gorm.DB) *CacheRepository {
+	return &CacheRepository{
+		db: db,
+	}
+}
+
+// GetResponse retrieves an unexpired cache entry by key
+func (r *CacheRepository) GetResponse(key string) (*model.CachedResponse, error) {
+	var entry model.CachedResponse
+	if err := r.db.Where("cache_key = ? AND expires_at > ?", key, time.Now()).First(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// PutResponse creates or replaces a cache entry
+func (r *CacheRepository) PutResponse(entry *model.CachedResponse) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(entry).Error
+}
+
+// DeleteResponses removes all cache entries, or only those of one backend
+// when backend is not empty, and reports how many were removed
+func (r *CacheRepository) DeleteResponses(backend string) (int64, error) {
+	query := r.db.Where("1 = 1")
+	if backend != "" {
+		query = r.db.Where("backend = ?", backend)
+	}
+	result := query.Delete(&model.CachedResponse{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteExpiredResponses removes the cache entries that expired before now
+// and reports how many were removed
+func (r *CacheRepository) DeleteExpiredResponses(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ?", now).Delete(&model.CachedResponse{})
+	return result.RowsAffected, result.Error
+}
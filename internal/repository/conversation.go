@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"gorm.io/gorm"
+)
+
+// ErrConversationOwner is returned when a message is appended to a
+// conversation on behalf of someone other than its owner, or of no one
+var ErrConversationOwner = errors.New("conversation belongs to another user")
+
+// ConversationRepository provides methods to interact with conversation data
+type ConversationRepository struct {
+	db *gorm.DB
+}
+
+// NewConversationRepository creates a new ConversationRepository instance
+func NewConversationRepository(db *gorm.DB) *ConversationRepository {
+	return &ConversationRepository{
+		db: db,
+	}
+}
+
+// WithContext returns a repository whose queries run with ctx, so they are
+// traced as part of the request in ctx
+func (r *ConversationRepository) WithContext(ctx context.Context) *ConversationRepository {
+	return &ConversationRepository{db: r.db.WithContext(ctx)}
+}
+
+// GetConversationByID retrieves a conversation by its thread ID
+func (r *ConversationRepository) GetConversationByID(conversationID string) (*model.Conversation, error) {
+	var conversation model.Conversation
+	if err := r.db.Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// GetConversationByIDUnscoped retrieves a conversation by its thread ID,
+// including conversations that have been deleted
+func (r *ConversationRepository) GetConversationByIDUnscoped(conversationID string) (*model.Conversation, error) {
+	var conversation model.Conversation
+	if err := r.db.Unscoped().Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// ListConversationsByUser returns a page of a user's conversations, most
+// recently active first, together with the total number of conversations
+func (r *ConversationRepository) ListConversationsByUser(userID string, offset, limit int) ([]model.Conversation, int64, error) {
+	var total int64
+	query := r.db.Model(&model.Conversation{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var conversations []model.Conversation
+	if err := query.Order("updated_at DESC").Offset(offset).Limit(limit).Find(&conversations).Error; err != nil {
+		return nil, 0, err
+	}
+	return conversations, total, nil
+}
+
+// UpdateConversationTitle renames a conversation
+func (r *ConversationRepository) UpdateConversationTitle(conversationID, title string) error {
+	return r.db.Model(&model.Conversation{}).Where("id = ?", conversationID).Update("title", title).Error
+}
+
+// DeleteConversation soft-deletes a conversation. Its messages are kept for
+// auditing but are no longer reachable through the API.
+func (r *ConversationRepository) DeleteConversation(conversationID string) error {
+	return r.db.Where("id = ?", conversationID).Delete(&model.Conversation{}).Error
+}
+
+// AppendMessage stores a message and creates its conversation on first use.
+// The conversation's UpdatedAt is bumped in the same transaction. The
+// message is refused with ErrConversationOwner unless conversation.UserID
+// owns the stored conversation; conversations without an owner take no
+// new messages.
+func (r *ConversationRepository) AppendMessage(conversation *model.Conversation, message *model.Message) error {
+	if conversation.UserID == "" {
+		return ErrConversationOwner
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var existing model.Conversation
+		err := tx.Where("id = ?", conversation.ID).First(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(conversation).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case existing.UserID != conversation.UserID:
+			return ErrConversationOwner
+		default:
+			updates := map[string]interface{}{"updated_at": time.Now()}
+			if existing.CandidateName == "" && conversation.CandidateName != "" {
+				updates["candidate_name"] = conversation.CandidateName
+			}
+			if err := tx.Model(&existing).Updates(updates).Error; err != nil {
+				return err
+			}
+			*conversation = existing
+		}
+
+		message.ConversationID = conversation.ID
+		return tx.Create(message).Error
+	})
+}
+
+// ListMessages returns the messages of a conversation in the order they were written
+func (r *ConversationRepository) ListMessages(conversationID string) ([]model.Message, error) {
+	var messages []model.Message
+	if err := r.db.Where("conversation_id = ?", conversationID).Order("id ASC").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ListRecentMessages returns at most limit of the newest messages of a
+// conversation, oldest first. A non-positive limit returns every message.
+func (r *ConversationRepository) ListRecentMessages(conversationID string, limit int) ([]model.Message, error) {
+	var messages []model.Message
+	query := r.db.Where("conversation_id = ?", conversationID).Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// ImportConversation stores a complete conversation with all of its messages.
+// It returns false without writing anything if the conversation already exists.
+func (r *ConversationRepository) ImportConversation(conversation *model.Conversation, messages []model.Message) (bool, error) {
+	imported := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Unscoped().Model(&model.Conversation{}).Where("id = ?", conversation.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if err := tx.Create(conversation).Error; err != nil {
+			return err
+		}
+		for i := range messages {
+			messages[i].ConversationID = conversation.ID
+		}
+		if len(messages) > 0 {
+			if err := tx.Create(&messages).Error; err != nil {
+				return err
+			}
+		}
+		imported = true
+		return nil
+	})
+	return imported, err
+}
+
+// ListConversations returns a page of conversations in creation order, for
+// exports. An empty userID lists every user's conversations.
+func (r *ConversationRepository) ListConversations(userID string, offset, limit int) ([]model.Conversation, error) {
+	query := r.db.Order("created_at, id")
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var conversations []model.Conversation
+	if err := query.Offset(offset).Limit(limit).Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
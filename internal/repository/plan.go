@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PlanRepository provides methods to interact with plans, plan assignments
+// and quota usage
+type PlanRepository struct {
+	db *gorm.DB
+}
+
+// NewPlanRepository creates a new PlanRepository instance
+func NewPlanRepository(db *gorm.DB) *PlanRepository {
+	return &PlanRepository{
+		db: db,
+	}
+}
+
+// GetPlanByID retrieves a plan with its limits
+func (r *PlanRepository) GetPlanByID(planID string) (*model.Plan, error) {
+	var plan model.Plan
+	if err := r.db.Preload("Limits").Where("id = ?", planID).First(&plan).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// ListPlans retrieves all plans with their limits, least restricted last
+func (r *PlanRepository) ListPlans() ([]model.Plan, error) {
+	var plans []model.Plan
+	if err := r.db.Preload("Limits").Order("rank ASC").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// CreatePlanIfMissing inserts a plan with its limits unless a plan with the
+// same ID exists, so that limits edited in the database are kept
+func (r *PlanRepository) CreatePlanIfMissing(plan *model.Plan) (bool, error) {
+	created := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.Plan{}).Where("id = ?", plan.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		created = true
+		return tx.Create(plan).Error
+	})
+	return created, err
+}
+
+// GetUserPlanID retrieves the ID of the plan assigned to a user. Most users
+// have none, so a missing row is not logged as an error.
+func (r *PlanRepository) GetUserPlanID(userID string) (string, error) {
+	var assignment model.UserPlan
+	result := r.db.Where("user_id = ?", userID).Limit(1).Find(&assignment)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return assignment.PlanID, nil
+}
+
+// AssignPlan sets the plan of a user, replacing any previous assignment
+func (r *PlanRepository) AssignPlan(userID, planID string) error {
+	assignment := &model.UserPlan{UserID: userID, PlanID: planID}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"plan_id", "updated_at"}),
+	}).Create(assignment).Error
+}
+
+// DeletePlanAssignmentIf removes a user's plan assignment if it is still
+// planID, and reports whether it did
+func (r *PlanRepository) DeletePlanAssignmentIf(userID, planID string) (bool, error) {
+	result := r.db.Where("user_id = ? AND plan_id = ?", userID, planID).Delete(&model.UserPlan{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetQuotaUsage retrieves how much a subject used of a metric in a period
+func (r *PlanRepository) GetQuotaUsage(subject, routeGroup, metric, period string) (float64, error) {
+	var usage model.QuotaUsage
+	err := r.db.Where("subject = ? AND route_group = ? AND metric = ? AND period = ?",
+		subject, routeGroup, metric, period).Limit(1).Find(&usage).Error
+	return usage.Amount, err
+}
+
+// AddQuotaUsage adds amount to a subject's usage of a metric in each of
+// the given periods
+func (r *PlanRepository) AddQuotaUsage(subject, routeGroup, metric string, amount float64, periods ...string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, period := range periods {
+			usage := &model.QuotaUsage{
+				Subject:    subject,
+				RouteGroup: routeGroup,
+				Metric:     metric,
+				Period:     period,
+				Amount:     amount,
+				UpdatedAt:  time.Now(),
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "subject"}, {Name: "route_group"}, {Name: "metric"}, {Name: "period"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"amount":     gorm.Expr("quota_usages.amount + ?", amount),
+					"updated_at": usage.UpdatedAt,
+				}),
+			}).Create(usage).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// errQuotaFull rolls back a reservation that does not fit a quota
+var errQuotaFull = errors.New("quota full")
+
+// ReserveQuotaUsage adds amount to a subject's usage of a metric in each
+// period of limits, unless that would take any of them past its limit, and
+// reports whether it did. A zero limit leaves its period unlimited. Each
+// check and increment is a single statement, so concurrent reservations
+// cannot overrun a limit.
+func (r *PlanRepository) ReserveQuotaUsage(subject, routeGroup, metric string, amount float64, limits map[string]float64) (bool, error) {
+	periods := make([]string, 0, len(limits))
+	for period, limit := range limits {
+		if limit > 0 && amount > limit {
+			return false, nil
+		}
+		periods = append(periods, period)
+	}
+	// The same order in every transaction keeps them from deadlocking
+	sort.Strings(periods)
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, period := range periods {
+			usage := &model.QuotaUsage{
+				Subject:    subject,
+				RouteGroup: routeGroup,
+				Metric:     metric,
+				Period:     period,
+				Amount:     amount,
+				UpdatedAt:  time.Now(),
+			}
+			onConflict := clause.OnConflict{
+				Columns: []clause.Column{{Name: "subject"}, {Name: "route_group"}, {Name: "metric"}, {Name: "period"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"amount":     gorm.Expr("quota_usages.amount + ?", amount),
+					"updated_at": usage.UpdatedAt,
+				}),
+			}
+			if limit := limits[period]; limit > 0 {
+				onConflict.Where = clause.Where{Exprs: []clause.Expression{
+					gorm.Expr("quota_usages.amount + ? <= ?", amount, limit),
+				}}
+			}
+			result := tx.Clauses(onConflict).Create(usage)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errQuotaFull
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errQuotaFull) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"gorm.io/gorm"
+)
+
+// SubscriptionRepository provides methods to interact with subscriptions
+type SubscriptionRepository struct {
+	db *gorm.DB
+}
+
+// NewSubscriptionRepository creates a new SubscriptionRepository instance
+func NewSubscriptionRepository(db *gorm.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{
+		db: db,
+	}
+}
+
+// CreateSubscription creates a new subscription in the database
+func (r *SubscriptionRepository) CreateSubscription(subscription *model.Subscription) error {
+	return r.db.Create(subscription).Error
+}
+
+// GetSubscriptionByID retrieves a subscription by its ID
+func (r *SubscriptionRepository) GetSubscriptionByID(id string) (*model.Subscription, error) {
+	var subscription model.Subscription
+	if err := r.db.Where("id = ?", id).First(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// GetSubscriptionBySessionID retrieves a subscription by its provider
+// checkout session ID
+func (r *SubscriptionRepository) GetSubscriptionBySessionID(sessionID string) (*model.Subscription, error) {
+	var subscription model.Subscription
+	if err := r.db.Where("checkout_session_id = ?", sessionID).First(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// GetSubscriptionByProviderID retrieves a subscription by the provider's
+// subscription ID
+func (r *SubscriptionRepository) GetSubscriptionByProviderID(providerSubscriptionID string) (*model.Subscription, error) {
+	var subscription model.Subscription
+	if err := r.db.Where("provider_subscription_id = ?", providerSubscriptionID).First(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// GetLatestSubscription retrieves the most recently created subscription of
+// a user
+func (r *SubscriptionRepository) GetLatestSubscription(userID string) (*model.Subscription, error) {
+	var subscription model.Subscription
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").First(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// GetActiveSubscription retrieves a user's active subscription
+func (r *SubscriptionRepository) GetActiveSubscription(userID string) (*model.Subscription, error) {
+	var subscription model.Subscription
+	err := r.db.Where("user_id = ? AND status = ?", userID, model.SubscriptionActive).
+		Order("created_at DESC").First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// UpdateSubscription saves all fields of a subscription
+func (r *SubscriptionRepository) UpdateSubscription(subscription *model.Subscription) error {
+	return r.db.Save(subscription).Error
+}
+
+// ListOtherActiveSubscriptions retrieves a user's active subscriptions
+// other than keepID, e.g. the ones replaced when they switch plans
+func (r *SubscriptionRepository) ListOtherActiveSubscriptions(userID, keepID string) ([]model.Subscription, error) {
+	var subscriptions []model.Subscription
+	err := r.db.Where("user_id = ? AND status = ? AND id <> ?", userID, model.SubscriptionActive, keepID).
+		Order("created_at").Find(&subscriptions).Error
+	return subscriptions, err
+}
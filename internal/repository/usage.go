@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"gorm.io/gorm"
+)
+
+// usageTotalsColumns selects the UsageTotals of a set of usage records
+const usageTotalsColumns = "COUNT(*) AS requests, " +
+	"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, " +
+	"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, " +
+	"COALESCE(SUM(total_tokens), 0) AS total_tokens, " +
+	"COALESCE(SUM(audio_seconds), 0) AS audio_seconds"
+
+// usageGroupColumns maps the dimensions usage can be grouped by to SQL
+var usageGroupColumns = map[string]string{
+	"user":    "user_id",
+	"thread":  "thread_id",
+	"plan":    "plan_id",
+	"kind":    "kind",
+	"backend": "backend",
+	"model":   "model",
+	"day":     "CAST(DATE(created_at) AS TEXT)",
+}
+
+// UsageRepository provides methods to interact with usage records
+type UsageRepository struct {
+	db *gorm.DB
+}
+
+// NewUsageRepository creates a new UsageRepository instance
+func NewUsageRepository(db *gorm.DB) *UsageRepository {
+	return &UsageRepository{
+		db: db,
+	}
+}
+
+// WithContext returns a repository whose queries run with ctx
+func (r *UsageRepository) WithContext(ctx context.Context) *UsageRepository {
+	return &UsageRepository{db: r.db.WithContext(ctx)}
+}
+
+// CreateUsageRecord stores a usage record
+func (r *UsageRepository) CreateUsageRecord(record *model.UsageRecord) error {
+	return r.db.Create(record).Error
+}
+
+// SumUsage totals the usage records between from and to, only those of one
+// user when userID is not empty
+func (r *UsageRepository) SumUsage(userID string, from, to time.Time) (*model.UsageTotals, error) {
+	var totals model.UsageTotals
+	err := r.usageQuery(userID, from, to).Select(usageTotalsColumns).Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
+// GroupUsage totals the usage records between from and to per value of
+// groupBy ("user", "thread", "plan", "kind", "backend", "model" or "day"), highest
+// token use first. Only one user's records are included when userID is not
+// empty.
+func (r *UsageRepository) GroupUsage(userID, groupBy string, from, to time.Time, limit int) ([]model.UsageGroup, error) {
+	column, ok := usageGroupColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("cannot group usage by %q", groupBy)
+	}
+
+	query := r.usageQuery(userID, from, to)
+	if groupBy == "thread" {
+		// Transcriptions do not belong to a thread
+		query = query.Where("thread_id <> ''")
+	}
+
+	groups := []model.UsageGroup{}
+	err := query.
+		Select(column + " AS key, " + usageTotalsColumns).
+		Group(column).
+		Order("total_tokens DESC, requests DESC").
+		Limit(limit).
+		Scan(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *UsageRepository) usageQuery(userID string, from, to time.Time) *gorm.DB {
+	query := r.db.Model(&model.UsageRecord{}).Where("created_at >= ? AND created_at < ?", from, to)
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	return query
+}
@@ -1,7 +1,8 @@
 package repository
 
 import (
-	"github.com/EyeQuila/eyeQcheck/internal/database"
+	"time"
+
 	"github.com/EyeQuila/eyeQcheck/internal/model"
 	"gorm.io/gorm"
 )
@@ -12,9 +13,9 @@ type UserRepository struct {
 }
 
 // NewUserRepository creates a new UserRepository instance
-func NewUserRepository() *UserRepository {
+func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{
-		db: database.DB,
+		db: db,
 	}
 }
 
@@ -27,6 +28,15 @@ func (r *UserRepository) GetUserByID(userID string) (*model.User,error) {
 	return &user, nil
 }
 
+// GetUserByEmail retrieves a user by their email address
+func (r *UserRepository) GetUserByEmail(email string) (*model.User, error) {
+	var user model.User
+	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // CreateUser creates a new user in the database
 func (r *UserRepository) CreateUser(user *model.User) error {
 	if err := r.db.Create(user).Error; err != nil {
@@ -42,3 +52,75 @@ func (r *UserRepository) UpdateUser(user *model.User) error {
 	}
 	return nil
 }
+
+// UpsertUser creates user together with its default preferences, or updates
+// the user with the same ID or email when one exists, all in one
+// transaction. existing is called with the stored user so the caller can
+// merge the new values into it; it is not called when the user is created.
+// An existing user without preferences gets the defaults as well.
+func (r *UserRepository) UpsertUser(user *model.User, defaults *model.UserPreferences, existing func(stored *model.User) error) (created bool, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		var stored model.User
+		result := tx.Where("id = ? OR email = ?", user.ID, user.Email).
+			Order(gorm.Expr("CASE WHEN id = ? THEN 0 ELSE 1 END", user.ID)).
+			Limit(1).Find(&stored)
+		switch {
+		case result.Error != nil:
+			return result.Error
+		case result.RowsAffected == 0:
+			created = true
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+		default:
+			if err := existing(&stored); err != nil {
+				return err
+			}
+			if err := tx.Save(&stored).Error; err != nil {
+				return err
+			}
+			*user = stored
+		}
+
+		defaults.UserID = user.ID
+		return tx.Where("user_id = ?", user.ID).FirstOrCreate(defaults).Error
+	})
+	return created, err
+}
+
+// UpdateUserFields updates the given columns of a user. It returns
+// gorm.ErrRecordNotFound when the user does not exist.
+func (r *UserRepository) UpdateUserFields(userID string, updates map[string]interface{}) error {
+	result := r.db.Model(&model.User{}).Where("id = ?", userID).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchLastLogin sets a user's last login time
+func (r *UserRepository) TouchLastLogin(userID string, at time.Time) error {
+	return r.UpdateUserFields(userID, map[string]interface{}{"last_login_at": at})
+}
+
+// GetUserPreferences retrieves a user's preferences. It returns
+// gorm.ErrRecordNotFound when the user has none.
+func (r *UserRepository) GetUserPreferences(userID string) (*model.UserPreferences, error) {
+	var preferences model.UserPreferences
+	result := r.db.Where("user_id = ?", userID).Limit(1).Find(&preferences)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &preferences, nil
+}
+
+// SaveUserPreferences creates or replaces a user's preferences
+func (r *UserRepository) SaveUserPreferences(preferences *model.UserPreferences) error {
+	return r.db.Save(preferences).Error
+}
@@ -2,34 +2,68 @@ package router
 
 import (
 	_ "github.com/EyeQuila/eyeQcheck/docs" // Import the generated Swagger docs
+	"github.com/EyeQuila/eyeQcheck/internal/config"
 	"github.com/EyeQuila/eyeQcheck/internal/controller"
 	"github.com/EyeQuila/eyeQcheck/internal/middleware"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-// initializes the Gin router and sets up the API routes.
-func RegisterRoutes(r *gin.Engine) {
+// New returns an engine with the global middleware and every route. auth
+// guards the protected routes, see middleware.AuthMiddleware, limiter
+// enforces the plans on the chat and speech-to-text routes, and languages
+// backs the localization of error responses.
+func New(cfg *config.Config, h *controller.Handlers, auth gin.HandlerFunc, limiter *middleware.RateLimiter, languages middleware.LanguageSource) *gin.Engine {
+	r := gin.New()
+
+	// Initialize middleware first. The request ID comes before everything
+	// that logs or traces so they all carry it.
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Tracing())
+	r.Use(middleware.Metrics())
+	r.Use(middleware.CORSMiddleware(cfg))
+	r.Use(gin.Recovery())
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.LocalizeErrors(languages))
+
+	RegisterRoutes(r, h, auth, limiter)
+	return r
+}
+
+// initializes the Gin router and sets up the API routes. auth guards the
+// routes that need a signed-in user and limiter applies the callers' plans.
+func RegisterRoutes(r *gin.Engine, h *controller.Handlers, auth gin.HandlerFunc, limiter *middleware.RateLimiter) {
 	// Swagger documentation route
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Probes for the orchestrator, outside /api so they bypass its
+	// middleware. Metrics have a listener of their own, see metrics_addr.
+	r.GET("/livez", h.Health.Livez)
+	r.GET("/readyz", h.Health.Readyz)
+
 	// Main API group
 	api := r.Group("/api")
 	
 	// Protected routes (require JWT token from OAuth2)
 	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(auth)
 	{
 		// Authenticated user routes
 		user := protected.Group("/user")
-		user.Use(middleware.RateLimitMiddleware()) 
 		{
-			// Conversation routes (unlimited)
+			// Conversation routes (limited by the user's plan)
 			chat := user.Group("/conversation") 
 			{
-				chat.POST("/chat", controller.ChatController)
-				chat.POST("/speech-to-text", controller.SpeechToTextController)
+				chat.POST("/chat", middleware.RateLimitMiddleware(limiter, services.RouteGroupChat), h.Chat.Chat)
+				chat.POST("/speech-to-text", middleware.RateLimitMiddleware(limiter, services.RouteGroupSTT), h.STT.SpeechToText)
+
+				// Conversation history
+				chat.GET("/threads", h.Conversations.ListConversations)
+				chat.GET("/threads/:thread_id", h.Conversations.GetConversation)
+				chat.PATCH("/threads/:thread_id", h.Conversations.RenameConversation)
+				chat.DELETE("/threads/:thread_id", h.Conversations.DeleteConversation)
 			}
 		}
 
@@ -45,24 +79,44 @@ func RegisterRoutes(r *gin.Engine) {
 		// 	assessment.DELETE("/delete/:id", controller.DeleteAssessmentController) // Example route for deleting an assessment by ID
 		// }
 
+		// Admin routes
+		admin := protected.Group("/admin")
+		admin.Use(middleware.RequireRole("admin"))
+		{
+			admin.DELETE("/cache", h.Cache.InvalidateCache)
+
+			// Plans
+			admin.GET("/plans", h.Plans.ListPlans)
+			admin.PUT("/users/:user_id/plan", h.Plans.AssignPlan)
+
+			// Usage
+			admin.GET("/usage", h.Usage.AdminUsage)
+		}
+
 		// Authenticated user management routes
 		profile := protected.Group("/profile")
 		{
 			// Get user profile
-			profile.GET("", controller.GetUserProfileController)
-			profile.PUT("", controller.UpdateUserProfileController)
+			profile.GET("", h.Users.GetUserProfile)
+			profile.PUT("", h.Users.UpdateUserProfile)
+
+			// Language, notification and theme preferences
+			profile.GET("/preferences", h.Preferences.GetPreferences)
+			profile.PATCH("/preferences", h.Preferences.UpdatePreferences)
+
+			// Token and speech-to-text usage
+			profile.GET("/usage", h.Usage.GetUsage)
 		}
 	}
 
 	// Guest/Anonymous routes (no authentication required)
 	guest := api.Group("/guest")
-	guest.Use(middleware.GuestRateLimitMiddleware()) 
 	{
 		// Limited conversation routes for non-logged-in users
 		chat := guest.Group("/conversation")
 		{
-			chat.POST("/demo-chat", controller.DemoChatController)
-			chat.POST("/speech-to-text", controller.DemoSpeechToTextController) 
+			chat.POST("/demo-chat", middleware.GuestRateLimitMiddleware(limiter, services.RouteGroupChat), h.Chat.DemoChat)
+			chat.POST("/speech-to-text", middleware.GuestRateLimitMiddleware(limiter, services.RouteGroupSTT), h.STT.DemoSpeechToText) 
 		}
 	}
 
@@ -73,7 +127,27 @@ func RegisterRoutes(r *gin.Engine) {
 			c.JSON(200, gin.H{"status": "healthy"})
 		})
 		
-		// User registration from external OAuth system
-		public.POST("/register-user", controller.RegisterUserController)
+		// User registration from external OAuth system. The token's subject
+		// is the user registered, so nobody can rewrite another profile.
+		public.POST("/register-user", auth, h.Users.RegisterUser)
+
+		// Upgrade flow: plan catalog, checkout and subscription management
+		upgrade := public.Group("/upgrade")
+		{
+			upgrade.GET("", h.Upgrade.UpgradeCatalog)
+			upgrade.POST("/webhook", h.Upgrade.PaymentWebhook)
+
+			subscription := upgrade.Group("")
+			subscription.Use(auth)
+			{
+				subscription.POST("/checkout-session", h.Upgrade.CreateCheckoutSession)
+				subscription.GET("/subscription", h.Upgrade.SubscriptionStatus)
+				subscription.POST("/cancel", h.Upgrade.CancelSubscription)
+				// Development only: pays for one of the caller's checkouts
+				if h.Upgrade.SimulatesCheckout() {
+					subscription.GET("/fake-checkout/:session_id", h.Upgrade.FakeCheckout)
+				}
+			}
+		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,759 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/controller"
+	"github.com/EyeQuila/eyeQcheck/internal/middleware"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/services"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Thread IDs the fakes treat specially
+const (
+	knownThread   = "11111111-1111-4111-8111-111111111111"
+	missingThread = "22222222-2222-4222-8222-222222222222"
+	// longThread has a long stored history
+	longThread = "33333333-3333-4333-8333-333333333333"
+)
+
+// fakeChat answers by echoing the last message and records how the handler
+// set it up
+type fakeChat struct {
+	planID   string
+	language string
+	backend  string
+	userID   string
+}
+
+func (f *fakeChat) UseBackend(name, model string) error {
+	if name != "" && name != services.BackendEcho {
+		return services.ErrUnknownBackend
+	}
+	f.backend = name
+	return nil
+}
+
+func (f *fakeChat) UsePlan(planID string)   { f.planID = planID }
+func (f *fakeChat) UseLanguage(lang string) { f.language = lang }
+
+func (f *fakeChat) BuildHistory(threadID, userID string, message model.GPTMessage) ([]model.GPTMessage, error) {
+	if threadID == missingThread {
+		return nil, services.ErrConversationNotFound
+	}
+	if threadID == longThread {
+		history := make([]model.GPTMessage, 20)
+		for i := range history {
+			history[i] = model.GPTMessage{Role: "assistant", Content: "Hi"}
+		}
+		return append(history, message), nil
+	}
+	return []model.GPTMessage{{Role: "assistant", Content: "Hi"}, message}, nil
+}
+
+func (f *fakeChat) ProcessChat(ctx context.Context, messages []model.GPTMessage, threadID, userID string) (*model.ChatResponse, error) {
+	f.userID = userID
+	if threadID == missingThread {
+		return nil, services.ErrConversationNotFound
+	}
+	return &model.ChatResponse{
+		Reply:    "Echo: " + messages[len(messages)-1].Content,
+		ThreadID: threadID,
+		Usage:    &model.Usage{TotalTokens: 7},
+	}, nil
+}
+
+func (f *fakeChat) StreamChat(ctx context.Context, messages []model.GPTMessage, threadID, userID string, onDelta func(delta string) error) (*model.ChatStreamDone, error) {
+	for _, delta := range []string{"Echo: ", messages[len(messages)-1].Content} {
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+	return &model.ChatStreamDone{ThreadID: threadID, Usage: &model.Usage{TotalTokens: 7}}, nil
+}
+
+// fakeSTT transcribes every file to the same text, and fails as if the STT
+// service were down for down.wav
+type fakeSTT struct {
+	userID   string
+	language string
+}
+
+func (f *fakeSTT) ForUser(userID, planID string) { f.userID = userID }
+func (f *fakeSTT) UseLanguage(lang string)       { f.language = lang }
+
+func (f *fakeSTT) ConvertSpeechToText(ctx context.Context, audioData []byte, filename string) (*services.STTResponse, error) {
+	if filename == "down.wav" {
+		return nil, upstream.ErrCircuitOpen
+	}
+	return &services.STTResponse{Text: "hello", Duration: 1.5}, nil
+}
+
+// fakeUsers is both the user service and the account lookup of the auth
+// middleware
+type fakeUsers struct {
+	accounts map[string]*model.User
+	// registered records the role of every registration
+	registered map[string]string
+}
+
+func (f *fakeUsers) Account(userID string) (*model.User, error) {
+	return f.accounts[userID], nil
+}
+
+func (f *fakeUsers) RegisterOrUpdateUser(userID, email, displayName, googleID, avatarURL, role string) (*model.User, bool, error) {
+	if email == "taken@example.com" {
+		return nil, false, services.ErrEmailTaken
+	}
+	if f.registered == nil {
+		f.registered = map[string]string{}
+	}
+	f.registered[userID] = role
+	_, exists := f.accounts[userID]
+	return &model.User{ID: userID, Email: email, DisplayName: displayName, Role: role}, !exists, nil
+}
+
+func (f *fakeUsers) GetUserProfile(userID string) (*model.User, error) {
+	if user := f.accounts[userID]; user != nil {
+		return user, nil
+	}
+	return nil, services.ErrUserNotFound
+}
+
+func (f *fakeUsers) UpdateUserProfile(user *model.User) error {
+	if f.accounts[user.ID] == nil {
+		return services.ErrUserNotFound
+	}
+	return nil
+}
+
+// fakePreferences answers in Thai to callers whose Accept-Language asks
+// for it
+type fakePreferences struct{}
+
+func (fakePreferences) LanguageFor(userID, acceptLanguage string) string {
+	if strings.HasPrefix(acceptLanguage, "th") {
+		return "th"
+	}
+	return ""
+}
+
+func (fakePreferences) GetPreferences(userID string) (*model.UserPreferences, error) {
+	return &model.UserPreferences{UserID: userID, Language: "en", ThemePreference: services.ThemeLight}, nil
+}
+
+func (fakePreferences) UpdatePreferences(userID string, req *model.UpdatePreferencesRequest) (*model.UserPreferences, error) {
+	if req.ThemePreference != nil && *req.ThemePreference == "neon" {
+		return nil, services.ErrInvalidTheme
+	}
+	return &model.UserPreferences{UserID: userID, Language: "en", ThemePreference: services.ThemeDark}, nil
+}
+
+type fakeConversations struct{}
+
+func (fakeConversations) ListConversations(userID string, page, pageSize int) (*model.ConversationListResponse, error) {
+	return &model.ConversationListResponse{
+		Conversations: []model.Conversation{{ID: knownThread, UserID: userID}},
+		Page:          page,
+		PageSize:      pageSize,
+		Total:         1,
+	}, nil
+}
+
+func (fakeConversations) GetConversation(userID, threadID string) (*model.ConversationDetailResponse, error) {
+	if threadID != knownThread {
+		return nil, services.ErrConversationNotFound
+	}
+	return &model.ConversationDetailResponse{Conversation: model.Conversation{ID: threadID, UserID: userID}}, nil
+}
+
+func (fakeConversations) RenameConversation(userID, threadID, title string) (*model.Conversation, error) {
+	if threadID != knownThread {
+		return nil, services.ErrConversationNotFound
+	}
+	return &model.Conversation{ID: threadID, UserID: userID, Title: title}, nil
+}
+
+func (fakeConversations) DeleteConversation(userID, threadID string) error {
+	if threadID != knownThread {
+		return services.ErrConversationNotFound
+	}
+	return nil
+}
+
+type fakeUsage struct{}
+
+func (fakeUsage) Summary(userID, role string, from, to time.Time) (*model.UsageSummaryResponse, error) {
+	return &model.UsageSummaryResponse{From: from, To: to, PlanID: services.PlanFree}, nil
+}
+
+func (fakeUsage) Aggregate(groupBy string, from, to time.Time) (*model.UsageAggregateResponse, error) {
+	if groupBy == "color" {
+		return nil, services.ErrInvalidUsageGroup
+	}
+	return &model.UsageAggregateResponse{From: from, To: to, GroupBy: groupBy}, nil
+}
+
+// fakePlans is both the plan service and the rate limiter's plan source.
+// Its plans set no limits, so the rate limiter lets every request through.
+type fakePlans struct{}
+
+func (fakePlans) ListPlans() ([]model.Plan, error) {
+	return []model.Plan{{ID: services.PlanFree}, {ID: services.PlanPremium, PriceCents: 990}}, nil
+}
+
+func (fakePlans) AssignPlan(userID, planID string) error {
+	if planID != services.PlanFree && planID != services.PlanPremium {
+		return services.ErrPlanNotFound
+	}
+	return nil
+}
+
+func (fakePlans) PlanForUser(userID, role string) (*model.Plan, error) {
+	return &model.Plan{ID: services.PlanFree}, nil
+}
+
+func (fakePlans) GuestPlan() (*model.Plan, error) {
+	return &model.Plan{ID: services.PlanGuest}, nil
+}
+
+func (fakePlans) Quotas(subject, routeGroup string, limit *model.PlanLimit, now time.Time) ([]model.Quota, error) {
+	return nil, nil
+}
+
+func (fakePlans) ReserveMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) (bool, error) {
+	return true, nil
+}
+
+func (fakePlans) ReleaseMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) error {
+	return nil
+}
+
+func (fakePlans) RecordUsage(subject, routeGroup string, limit *model.PlanLimit, tokens int, audioSeconds float64, now time.Time) error {
+	return nil
+}
+
+type fakeCache struct{}
+
+func (fakeCache) Invalidate(backend string) (int64, error) {
+	return 3, nil
+}
+
+type fakeSubscriptions struct{}
+
+func (fakeSubscriptions) Catalog() ([]model.Plan, error) {
+	return []model.Plan{{ID: services.PlanPremium, PriceCents: 990}}, nil
+}
+
+func (fakeSubscriptions) StartCheckout(ctx context.Context, userID, planID string) (*model.CheckoutSessionResponse, error) {
+	if planID == services.PlanFree {
+		return nil, services.ErrPlanNotPurchasable
+	}
+	return &model.CheckoutSessionResponse{SubscriptionID: "sub_1", SessionID: "cs_1", CheckoutURL: "/checkout/cs_1"}, nil
+}
+
+func (fakeSubscriptions) Status(userID, role string) (*model.SubscriptionStatusResponse, error) {
+	return &model.SubscriptionStatusResponse{PlanID: services.PlanFree}, nil
+}
+
+func (fakeSubscriptions) Cancel(ctx context.Context, userID string) (*model.Subscription, error) {
+	return nil, services.ErrNoActiveSubscription
+}
+
+func (fakeSubscriptions) HandleWebhook(ctx context.Context, payload []byte, header http.Header) error {
+	if header.Get(services.WebhookSignatureHeader) == "" {
+		return services.ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// fakeCheckout knows one session, cs_1, started by user-1
+type fakeCheckout struct{}
+
+func (fakeCheckout) CompleteCheckout(ctx context.Context, sessionID, userID string, succeed bool) error {
+	if sessionID != "cs_1" || userID != "user-1" {
+		return services.ErrCheckoutSessionNotFound
+	}
+	return nil
+}
+
+// fakeHealth reports the configured readiness status
+type fakeHealth struct {
+	status string
+}
+
+func (f *fakeHealth) Readiness(ctx context.Context) *model.ReadinessResponse {
+	return &model.ReadinessResponse{Status: f.status}
+}
+
+// testServer is the router wired to fakes
+type testServer struct {
+	engine *gin.Engine
+	cfg    *config.Config
+	chat   *fakeChat
+	stt    *fakeSTT
+	health *fakeHealth
+	users  *fakeUsers
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+
+	s := &testServer{
+		cfg:    cfg,
+		chat:   &fakeChat{},
+		stt:    &fakeSTT{},
+		health: &fakeHealth{status: model.ReadinessReady},
+	}
+	users := &fakeUsers{accounts: map[string]*model.User{
+		"user-1":   {ID: "user-1", Email: "user@example.com", Role: services.RoleUser, IsActive: true},
+		"admin-1":  {ID: "admin-1", Email: "admin@example.com", Role: services.RoleAdmin, IsActive: true},
+		"banned-1": {ID: "banned-1", Email: "banned@example.com", Role: services.RoleUser, IsActive: false},
+	}}
+	handlers := &controller.Handlers{
+		Chat:          controller.NewChatHandler(func() controller.ChatService { return s.chat }, fakePreferences{}),
+		STT:           controller.NewSTTHandler(func() controller.STTService { return s.stt }, fakePreferences{}),
+		Conversations: controller.NewConversationHandler(fakeConversations{}),
+		Users:         controller.NewUserHandler(users),
+		Preferences:   controller.NewPreferenceHandler(fakePreferences{}),
+		Usage:         controller.NewUsageHandler(fakeUsage{}),
+		Plans:         controller.NewPlanHandler(fakePlans{}),
+		Cache:         controller.NewCacheHandler(fakeCache{}),
+		Upgrade:       controller.NewUpgradeHandler(fakeSubscriptions{}, fakeCheckout{}),
+		Health:        controller.NewHealthHandler(s.health),
+	}
+	s.users = users
+	s.engine = New(cfg, handlers, hmacAuth(t, cfg, users), testLimiter(cfg), fakePreferences{})
+	return s
+}
+
+// testLimiter returns a rate limiter enforcing the limit-free fake plans
+func testLimiter(cfg *config.Config) *middleware.RateLimiter {
+	return middleware.NewRateLimiter(middleware.NewLimiterStore(cfg), fakePlans{})
+}
+
+// hmacAuth returns the auth middleware for cfg's shared secret
+func hmacAuth(t *testing.T, cfg *config.Config, accounts middleware.AccountSource) gin.HandlerFunc {
+	t.Helper()
+	verifier, err := middleware.NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	return middleware.AuthMiddleware(verifier, accounts)
+}
+
+// token mints a bearer token for userID
+func (s *testServer) token(t *testing.T, userID string) string {
+	t.Helper()
+	token, err := middleware.MintToken(middleware.UserClaims{UserID: userID}, s.cfg.JWTSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("MintToken: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// do sends a request with an optional JSON body and Authorization header
+func (s *testServer) do(method, path, auth string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// audioUpload builds a multipart body with one audio file
+func audioUpload(t *testing.T, filename string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("audio", filename)
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write([]byte("RIFF0000WAVE"))
+	writer.Close()
+	return &body, writer.FormDataContentType()
+}
+
+func TestRoutes(t *testing.T) {
+	s := newTestServer(t)
+	user := s.token(t, "user-1")
+	admin := s.token(t, "admin-1")
+	signed := http.Header{services.WebhookSignatureHeader: {"t=1,v1=00"}}
+	message := map[string]interface{}{"message": map[string]string{"role": "user", "content": "hello"}}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		body   interface{}
+		header http.Header
+		want   int
+	}{
+		{"livez", http.MethodGet, "/livez", "", nil, nil, http.StatusOK},
+		{"readyz", http.MethodGet, "/readyz", "", nil, nil, http.StatusOK},
+		{"metrics are not public", http.MethodGet, "/metrics", "", nil, nil, http.StatusNotFound},
+		{"swagger", http.MethodGet, "/swagger/index.html", "", nil, nil, http.StatusOK},
+		{"public health", http.MethodGet, "/api/public/health", "", nil, nil, http.StatusOK},
+
+		{"chat", http.MethodPost, "/api/user/conversation/chat", user, message, nil, http.StatusOK},
+		{"chat without token", http.MethodPost, "/api/user/conversation/chat", "", message, nil, http.StatusUnauthorized},
+		{"chat with bad token", http.MethodPost, "/api/user/conversation/chat", "Bearer nope", message, nil, http.StatusUnauthorized},
+		{"chat with disabled account", http.MethodPost, "/api/user/conversation/chat", s.token(t, "banned-1"), message, nil, http.StatusForbidden},
+		{"chat without messages", http.MethodPost, "/api/user/conversation/chat", user, map[string]string{}, nil, http.StatusBadRequest},
+		{"chat on another user's thread", http.MethodPost, "/api/user/conversation/chat?thread_id=" + missingThread, user, message, nil, http.StatusNotFound},
+		{"chat backend override by user", http.MethodPost, "/api/user/conversation/chat", user, map[string]interface{}{"message": map[string]string{"role": "user", "content": "hi"}, "backend": "echo"}, nil, http.StatusForbidden},
+		{"chat backend override by admin", http.MethodPost, "/api/user/conversation/chat", admin, map[string]interface{}{"message": map[string]string{"role": "user", "content": "hi"}, "backend": "echo"}, nil, http.StatusOK},
+		{"chat unknown backend", http.MethodPost, "/api/user/conversation/chat", admin, map[string]interface{}{"message": map[string]string{"role": "user", "content": "hi"}, "backend": "nope"}, nil, http.StatusBadRequest},
+
+		{"list threads", http.MethodGet, "/api/user/conversation/threads", user, nil, nil, http.StatusOK},
+		{"list threads bad page", http.MethodGet, "/api/user/conversation/threads?page=x", user, nil, nil, http.StatusBadRequest},
+		{"get thread", http.MethodGet, "/api/user/conversation/threads/" + knownThread, user, nil, nil, http.StatusOK},
+		{"get missing thread", http.MethodGet, "/api/user/conversation/threads/" + missingThread, user, nil, nil, http.StatusNotFound},
+		{"rename thread", http.MethodPatch, "/api/user/conversation/threads/" + knownThread, user, map[string]string{"title": "Follow-up"}, nil, http.StatusOK},
+		{"rename without title", http.MethodPatch, "/api/user/conversation/threads/" + knownThread, user, map[string]string{}, nil, http.StatusBadRequest},
+		{"delete thread", http.MethodDelete, "/api/user/conversation/threads/" + knownThread, user, nil, nil, http.StatusOK},
+		{"delete missing thread", http.MethodDelete, "/api/user/conversation/threads/" + missingThread, user, nil, nil, http.StatusNotFound},
+
+		{"invalidate cache", http.MethodDelete, "/api/admin/cache", admin, nil, nil, http.StatusOK},
+		{"invalidate cache as user", http.MethodDelete, "/api/admin/cache", user, nil, nil, http.StatusForbidden},
+		{"list plans", http.MethodGet, "/api/admin/plans", admin, nil, nil, http.StatusOK},
+		{"assign plan", http.MethodPut, "/api/admin/users/user-1/plan", admin, map[string]string{"plan_id": services.PlanPremium}, nil, http.StatusOK},
+		{"assign unknown plan", http.MethodPut, "/api/admin/users/user-1/plan", admin, map[string]string{"plan_id": "gold"}, nil, http.StatusNotFound},
+		{"admin usage", http.MethodGet, "/api/admin/usage?group_by=plan", admin, nil, nil, http.StatusOK},
+		{"admin usage bad group", http.MethodGet, "/api/admin/usage?group_by=color", admin, nil, nil, http.StatusBadRequest},
+
+		{"get profile", http.MethodGet, "/api/profile", user, nil, nil, http.StatusOK},
+		{"get unregistered profile", http.MethodGet, "/api/profile", s.token(t, "guest-9"), nil, nil, http.StatusNotFound},
+		{"update profile", http.MethodPut, "/api/profile", user, map[string]string{"user_id": "user-1", "email": "new@example.com", "display_name": "New"}, nil, http.StatusOK},
+		{"update profile bad email", http.MethodPut, "/api/profile", user, map[string]string{"user_id": "user-1", "email": "nope", "display_name": "New"}, nil, http.StatusBadRequest},
+		{"get preferences", http.MethodGet, "/api/profile/preferences", user, nil, nil, http.StatusOK},
+		{"update preferences", http.MethodPatch, "/api/profile/preferences", user, map[string]string{"theme_preference": "dark"}, nil, http.StatusOK},
+		{"update preferences bad theme", http.MethodPatch, "/api/profile/preferences", user, map[string]string{"theme_preference": "neon"}, nil, http.StatusBadRequest},
+		{"usage", http.MethodGet, "/api/profile/usage", user, nil, nil, http.StatusOK},
+		{"usage bad range", http.MethodGet, "/api/profile/usage?from=yesterday", user, nil, nil, http.StatusBadRequest},
+
+		{"demo chat", http.MethodPost, "/api/guest/conversation/demo-chat", "", message, nil, http.StatusOK},
+
+		{"register user", http.MethodPost, "/api/public/register-user", s.token(t, "user-2"), map[string]string{"user_id": "user-2", "email": "two@example.com", "display_name": "Two"}, nil, http.StatusCreated},
+		{"register without user_id", http.MethodPost, "/api/public/register-user", s.token(t, "user-2"), map[string]string{"email": "two@example.com", "display_name": "Two"}, nil, http.StatusCreated},
+		{"register existing user", http.MethodPost, "/api/public/register-user", user, map[string]string{"user_id": "user-1", "email": "user@example.com", "display_name": "One"}, nil, http.StatusOK},
+		{"register taken email", http.MethodPost, "/api/public/register-user", s.token(t, "user-3"), map[string]string{"user_id": "user-3", "email": "taken@example.com", "display_name": "Three"}, nil, http.StatusConflict},
+		{"register another user", http.MethodPost, "/api/public/register-user", user, map[string]string{"user_id": "user-2", "email": "two@example.com", "display_name": "Two"}, nil, http.StatusForbidden},
+		{"register without token", http.MethodPost, "/api/public/register-user", "", map[string]string{"user_id": "user-2", "email": "two@example.com", "display_name": "Two"}, nil, http.StatusUnauthorized},
+
+		{"upgrade catalog", http.MethodGet, "/api/public/upgrade", "", nil, nil, http.StatusOK},
+		{"webhook", http.MethodPost, "/api/public/upgrade/webhook", "", map[string]string{"type": "checkout.completed"}, signed, http.StatusOK},
+		{"unsigned webhook", http.MethodPost, "/api/public/upgrade/webhook", "", map[string]string{"type": "checkout.completed"}, nil, http.StatusUnauthorized},
+		{"fake checkout", http.MethodGet, "/api/public/upgrade/fake-checkout/cs_1", user, nil, nil, http.StatusOK},
+		{"fake checkout unknown session", http.MethodGet, "/api/public/upgrade/fake-checkout/cs_9", user, nil, nil, http.StatusNotFound},
+		{"fake checkout of another user", http.MethodGet, "/api/public/upgrade/fake-checkout/cs_1", admin, nil, nil, http.StatusNotFound},
+		{"fake checkout without token", http.MethodGet, "/api/public/upgrade/fake-checkout/cs_1", "", nil, nil, http.StatusUnauthorized},
+		{"checkout session", http.MethodPost, "/api/public/upgrade/checkout-session", user, map[string]string{"plan_id": services.PlanPremium}, nil, http.StatusCreated},
+		{"checkout free plan", http.MethodPost, "/api/public/upgrade/checkout-session", user, map[string]string{"plan_id": services.PlanFree}, nil, http.StatusBadRequest},
+		{"checkout without token", http.MethodPost, "/api/public/upgrade/checkout-session", "", map[string]string{"plan_id": services.PlanPremium}, nil, http.StatusUnauthorized},
+		{"subscription status", http.MethodGet, "/api/public/upgrade/subscription", user, nil, nil, http.StatusOK},
+		{"cancel without subscription", http.MethodPost, "/api/public/upgrade/cancel", user, nil, nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.do(tt.method, tt.path, tt.auth, tt.body, tt.header)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body.String())
+			}
+			if w.Header().Get(middleware.RequestIDHeader) == "" {
+				t.Errorf("response has no %s header", middleware.RequestIDHeader)
+			}
+		})
+	}
+}
+
+func TestRegisterUserIgnoresRole(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.do(http.MethodPost, "/api/public/register-user", s.token(t, "user-9"), map[string]string{
+		"user_id": "user-9", "email": "nine@example.com", "display_name": "Nine", "role": services.RoleAdmin,
+	}, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", w.Code, w.Body.String())
+	}
+	if role := s.users.registered["user-9"]; role != services.RoleUser {
+		t.Errorf("registered with role %q, want %q", role, services.RoleUser)
+	}
+}
+
+func TestChatReply(t *testing.T) {
+	s := newTestServer(t)
+	w := s.do(http.MethodPost, "/api/user/conversation/chat?thread_id="+knownThread, s.token(t, "user-1"),
+		map[string]interface{}{"message": map[string]string{"role": "user", "content": "hello"}},
+		http.Header{"Accept-Language": {"th"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp model.ChatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if resp.Reply != "Echo: hello" || resp.ThreadID != knownThread {
+		t.Errorf("response = %+v", resp)
+	}
+	if s.chat.language != "th" {
+		t.Errorf("language = %q, want th", s.chat.language)
+	}
+	if s.chat.planID != services.PlanFree {
+		t.Errorf("plan = %q, want %s", s.chat.planID, services.PlanFree)
+	}
+}
+
+func TestDemoChatThreadsBelongToTheGuest(t *testing.T) {
+	s := newTestServer(t)
+	w := s.do(http.MethodPost, "/api/guest/conversation/demo-chat?thread_id="+knownThread, "",
+		map[string]interface{}{"message": map[string]string{"role": "user", "content": "hello"}}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if s.chat.userID != services.GuestQuotaSubject("192.0.2.1") {
+		t.Errorf("thread owner = %q, want the guest's subject", s.chat.userID)
+	}
+
+	w = s.do(http.MethodPost, "/api/user/conversation/chat?thread_id="+knownThread, s.token(t, "user-1"),
+		map[string]interface{}{"message": map[string]string{"role": "user", "content": "hello"}}, nil)
+	if w.Code != http.StatusOK || s.chat.userID != "user-1" {
+		t.Errorf("signed-in owner = %q (status %d), want user-1", s.chat.userID, w.Code)
+	}
+}
+
+func TestDemoChatMessageCap(t *testing.T) {
+	s := newTestServer(t)
+	messages := make([]map[string]string, 11)
+	for i := range messages {
+		messages[i] = map[string]string{"role": "user", "content": "hello"}
+	}
+	w := s.do(http.MethodPost, "/api/guest/conversation/demo-chat", "", map[string]interface{}{"messages": messages}, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("11 client messages: status = %d, want 400", w.Code)
+	}
+
+	// The cap is on what the guest sends, not on the stored thread
+	w = s.do(http.MethodPost, "/api/guest/conversation/demo-chat?thread_id="+longThread, "",
+		map[string]interface{}{"message": map[string]string{"role": "user", "content": "hello"}}, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("long stored thread: status = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChatThreadID(t *testing.T) {
+	s := newTestServer(t)
+	const other = "44444444-4444-4444-8444-444444444444"
+
+	for _, route := range []struct{ path, auth string }{
+		{"/api/user/conversation/chat", s.token(t, "user-1")},
+		{"/api/guest/conversation/demo-chat", ""},
+	} {
+		for _, tc := range []struct {
+			name, body, query string
+			want              int
+			thread            string // "" for a newly generated one
+		}{
+			{"body", knownThread, "", http.StatusOK, knownThread},
+			{"query", "", knownThread, http.StatusOK, knownThread},
+			{"body and matching query", knownThread, knownThread, http.StatusOK, knownThread},
+			{"body over blank query", knownThread, " ", http.StatusOK, knownThread},
+			{"body and query differ", knownThread, other, http.StatusBadRequest, ""},
+			{"body not a uuid", "thread-1", "", http.StatusBadRequest, ""},
+			{"query not a uuid", "", "thread-1", http.StatusBadRequest, ""},
+			{"neither", "", "", http.StatusOK, ""},
+		} {
+			t.Run(route.path+"/"+tc.name, func(t *testing.T) {
+				path := route.path
+				if tc.query != "" {
+					path += "?thread_id=" + url.QueryEscape(tc.query)
+				}
+				body := map[string]interface{}{
+					"thread_id": tc.body,
+					"messages":  []map[string]string{{"role": "user", "content": "hello"}},
+				}
+				w := s.do(http.MethodPost, path, route.auth, body, nil)
+				if w.Code != tc.want {
+					t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+				}
+				if tc.want != http.StatusOK {
+					return
+				}
+
+				var resp model.ChatResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("invalid response: %v", err)
+				}
+				if tc.thread != "" && resp.ThreadID != tc.thread {
+					t.Errorf("thread_id = %q, want %q", resp.ThreadID, tc.thread)
+				}
+				if tc.thread == "" {
+					if _, err := uuid.Parse(resp.ThreadID); err != nil || resp.ThreadID == knownThread {
+						t.Errorf("thread_id = %q, want a new UUID", resp.ThreadID)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	s := newTestServer(t)
+	w := s.do(http.MethodPost, "/api/user/conversation/chat?stream=true", s.token(t, "user-1"),
+		map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": "hello"}}}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/event-stream") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"event:delta", "hello", "event:done"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("stream lacks %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSpeechToText(t *testing.T) {
+	s := newTestServer(t)
+	for _, tt := range []struct {
+		name     string
+		path     string
+		auth     string
+		filename string
+		want     int
+	}{
+		{"user", "/api/user/conversation/speech-to-text", s.token(t, "user-1"), "clip.wav", http.StatusOK},
+		{"guest", "/api/guest/conversation/speech-to-text", "", "clip.wav", http.StatusOK},
+		{"service down", "/api/user/conversation/speech-to-text", s.token(t, "user-1"), "down.wav", http.StatusServiceUnavailable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := audioUpload(t, tt.filename)
+			req := httptest.NewRequest(http.MethodPost, tt.path, body)
+			req.Header.Set("Content-Type", contentType)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			s.engine.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// A request without a file never reaches the service
+	w := s.do(http.MethodPost, "/api/user/conversation/speech-to-text", s.token(t, "user-1"), nil, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("without file: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestReadyzNotReady(t *testing.T) {
+	s := newTestServer(t)
+	s.health.status = model.ReadinessNotReady
+	if w := s.do(http.MethodGet, "/readyz", "", nil, nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestErrorsAreLocalized(t *testing.T) {
+	s := newTestServer(t)
+	w := s.do(http.MethodGet, "/api/user/conversation/threads/"+missingThread, s.token(t, "user-1"), nil,
+		http.Header{"Accept-Language": {"th"}})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if got := w.Header().Get("Content-Language"); got != "th" {
+		t.Errorf("Content-Language = %q, want th", got)
+	}
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["error"] == "Conversation not found" {
+		t.Errorf("error was not translated: %q", body["error"])
+	}
+}
+
+func TestDisabledFeatures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+
+	handlers := &controller.Handlers{
+		Chat:          controller.NewChatHandler(func() controller.ChatService { return &fakeChat{} }, fakePreferences{}),
+		STT:           controller.NewSTTHandler(func() controller.STTService { return &fakeSTT{} }, fakePreferences{}),
+		Conversations: controller.NewConversationHandler(fakeConversations{}),
+		Users:         controller.NewUserHandler(&fakeUsers{}),
+		Preferences:   controller.NewPreferenceHandler(fakePreferences{}),
+		Usage:         controller.NewUsageHandler(fakeUsage{}),
+		Plans:         controller.NewPlanHandler(fakePlans{}),
+		// No response cache and no fake payment provider
+		Cache:   controller.NewCacheHandler(nil),
+		Upgrade: controller.NewUpgradeHandler(fakeSubscriptions{}, nil),
+		Health:  controller.NewHealthHandler(&fakeHealth{status: model.ReadinessReady}),
+	}
+	engine := New(cfg, handlers, hmacAuth(t, cfg, &fakeUsers{accounts: map[string]*model.User{
+		"admin-1": {ID: "admin-1", Role: services.RoleAdmin, IsActive: true},
+	}}), testLimiter(cfg), fakePreferences{})
+	s := &testServer{engine: engine, cfg: cfg}
+
+	w := s.do(http.MethodDelete, "/api/admin/cache", s.token(t, "admin-1"), nil, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "disabled") {
+		t.Errorf("invalidate disabled cache = %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do(http.MethodGet, "/api/public/upgrade/fake-checkout/cs_1", s.token(t, "admin-1"), nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("fake checkout without fake provider = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// Compile-time checks that the real services satisfy the handler
+// interfaces the fakes stand in for
+var (
+	_ controller.ChatService         = (*services.ChatService)(nil)
+	_ controller.STTService          = (*services.STTService)(nil)
+	_ controller.ConversationService = (*services.ConversationService)(nil)
+	_ controller.UserService         = (*services.UserService)(nil)
+	_ controller.PreferenceService   = (*services.PreferenceService)(nil)
+	_ controller.UsageService        = (*services.UsageService)(nil)
+	_ controller.PlanService         = (*services.PlanService)(nil)
+	_ controller.ResponseCache       = (*services.ResponseCache)(nil)
+	_ controller.SubscriptionService = (*services.SubscriptionService)(nil)
+	_ controller.CheckoutSimulator   = (*services.FakePaymentProvider)(nil)
+	_ controller.HealthService       = (*services.HealthService)(nil)
+	_ middleware.AccountSource       = (*services.UserService)(nil)
+	_ middleware.PlanSource          = (*services.PlanService)(nil)
+)
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// compressedAudioBytesPerSecond assumes 128 kbit/s, typical for the MP3,
+// M4A and WebM recordings browsers produce
+const compressedAudioBytesPerSecond = 16000
+
+// estimateAudioSeconds returns the length of a recording in seconds. WAV
+// files are measured from their header; other formats are estimated from
+// their size.
+func estimateAudioSeconds(audioData []byte) float64 {
+	if seconds, ok := wavSeconds(audioData); ok {
+		return seconds
+	}
+	return float64(len(audioData)) / compressedAudioBytesPerSecond
+}
+
+// wavSeconds reads the duration of a RIFF/WAVE file from its fmt and data
+// chunks
+func wavSeconds(audioData []byte) (float64, bool) {
+	if len(audioData) < 12 || !bytes.Equal(audioData[0:4], []byte("RIFF")) || !bytes.Equal(audioData[8:12], []byte("WAVE")) {
+		return 0, false
+	}
+
+	var byteRate uint32
+	for offset := 12; offset+8 <= len(audioData); {
+		chunkID := string(audioData[offset : offset+4])
+		chunkSize := binary.LittleEndian.Uint32(audioData[offset+4 : offset+8])
+		body := offset + 8
+
+		switch chunkID {
+		case "fmt ":
+			if body+12 > len(audioData) {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(audioData[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			// Recorders that stream WAV often leave the size unset
+			dataSize := uint64(chunkSize)
+			if remaining := uint64(len(audioData) - body); dataSize == 0 || dataSize > remaining {
+				dataSize = remaining
+			}
+			return float64(dataSize) / float64(byteRate), true
+		}
+
+		// Chunks are padded to an even size
+		offset = body + int(chunkSize) + int(chunkSize%2)
+	}
+	return 0, false
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+)
+
+// Names of the available chat backends
+const (
+	BackendRAG    = "rag"
+	BackendOpenAI = "openai"
+	BackendEcho   = "echo"
+)
+
+// ErrUnknownBackend is returned when a backend name is not recognised
+var ErrUnknownBackend = errors.New("unknown chat backend")
+
+// ChatBackend produces assistant replies for a conversation
+type ChatBackend interface {
+	// Name returns the backend name, e.g. "rag"
+	Name() string
+	// Complete returns the whole reply at once
+	Complete(ctx context.Context, req *BackendRequest) (*BackendReply, error)
+	// Stream calls onDelta for every chunk of the reply as it is produced and
+	// returns the assembled reply once the backend is done
+	Stream(ctx context.Context, req *BackendRequest, onDelta func(delta string) error) (*BackendReply, error)
+}
+
+// BackendRequest is the input to a ChatBackend
+type BackendRequest struct {
+	Messages []model.GPTMessage
+	ThreadID string
+	// Model is passed to backends that support choosing one; empty means
+	// the backend's default
+	Model string
+	// Language is the language the user wants replies in, e.g. "th"; empty
+	// means no preference
+	Language string
+}
+
+// BackendReply is the output of a ChatBackend
+type BackendReply struct {
+	Reply string
+	// UpstreamThreadID is the thread ID reported by the backend, if any
+	UpstreamThreadID string
+	// Model is the model that produced the reply, if known
+	Model string
+	// Usage is the token usage reported by the backend, if any
+	Usage *model.Usage
+}
+
+// ChatBackends builds the chat backends from the configuration and the
+// shared upstream clients
+type ChatBackends struct {
+	cfg     *config.Config
+	clients *UpstreamClients
+}
+
+// NewChatBackends returns the backends configured in cfg, calling out
+// through clients
+func NewChatBackends(cfg *config.Config, clients *UpstreamClients) *ChatBackends {
+	return &ChatBackends{cfg: cfg, clients: clients}
+}
+
+// New returns the backend registered under name
+func (b *ChatBackends) New(name string) (ChatBackend, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case BackendRAG:
+		return &ragBackend{
+			url:       b.cfg.RagURL,
+			streamURL: b.cfg.RagStreamURL,
+			client:    b.clients.RAG,
+		}, nil
+	case BackendOpenAI:
+		return &openAIBackend{
+			baseURL: b.cfg.OpenAIBaseURL,
+			apiKey:  b.cfg.OpenAIAPIKey,
+			client:  b.clients.OpenAI,
+		}, nil
+	case BackendEcho:
+		return newEchoBackend(b.cfg.ChatFixturesFile)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+)
+
+// echoBackend answers in process without calling any service. It replies
+// from a fixtures file when the last user message matches one of its
+// prompts and otherwise echoes the message back. Meant for local development
+// and tests.
+type echoBackend struct {
+	fixtures map[string]string
+}
+
+// newEchoBackend loads the optional fixtures file, a JSON object that maps
+// user prompts to canned replies
+func newEchoBackend(fixturesFile string) (*echoBackend, error) {
+	backend := &echoBackend{fixtures: map[string]string{}}
+	if fixturesFile == "" {
+		return backend, nil
+	}
+
+	data, err := os.ReadFile(fixturesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat fixtures: %w", err)
+	}
+	var fixtures map[string]string
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("invalid chat fixtures: %w", err)
+	}
+	for prompt, reply := range fixtures {
+		backend.fixtures[normalizePrompt(prompt)] = reply
+	}
+	return backend, nil
+}
+
+func (b *echoBackend) Name() string {
+	return BackendEcho
+}
+
+func (b *echoBackend) Complete(ctx context.Context, req *BackendRequest) (*BackendReply, error) {
+	reply := b.reply(req)
+	return &BackendReply{
+		Reply: reply,
+		Model: BackendEcho,
+		Usage: estimateUsage(req.Messages, reply),
+	}, nil
+}
+
+func (b *echoBackend) Stream(ctx context.Context, req *BackendRequest, onDelta func(delta string) error) (*BackendReply, error) {
+	reply := b.reply(req)
+	words := strings.SplitAfter(reply, " ")
+	for _, word := range words {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+	return &BackendReply{
+		Reply: reply,
+		Model: BackendEcho,
+		Usage: estimateUsage(req.Messages, reply),
+	}, nil
+}
+
+func (b *echoBackend) reply(req *BackendRequest) string {
+	var last string
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			last = req.Messages[i].Content
+			break
+		}
+	}
+	if reply, ok := b.fixtures[normalizePrompt(last)]; ok {
+		return reply
+	}
+	return "Echo: " + last
+}
+
+// normalizePrompt lowercases text and collapses whitespace
+func normalizePrompt(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+// estimateUsage approximates token usage for backends that do not report it
+func estimateUsage(messages []model.GPTMessage, reply string) *model.Usage {
+	prompt := 0
+	for _, m := range messages {
+		prompt += estimateMessageTokens(m)
+	}
+	completion := estimateTokens(reply)
+	return &model.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
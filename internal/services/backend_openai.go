@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
+)
+
+// defaultOpenAIModel is used when neither the deployment nor the request
+// names a model
+const defaultOpenAIModel = "gpt-4o-mini"
+
+// openAIBackend talks directly to any OpenAI-compatible /chat/completions
+// endpoint, e.g. OpenAI itself, Azure OpenAI, vLLM or Ollama
+type openAIBackend struct {
+	baseURL string
+	apiKey  string
+	client  *upstream.Client
+}
+
+func (b *openAIBackend) Name() string {
+	return BackendOpenAI
+}
+
+func (b *openAIBackend) Complete(ctx context.Context, req *BackendRequest) (*BackendReply, error) {
+	resp, err := b.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "OpenAI service error", "status", resp.StatusCode, "body", bodySnippet([]byte(openAIErrorMessage(resp.Body))))
+		return nil, fmt.Errorf("OpenAI service error (status %d)", resp.StatusCode)
+	}
+
+	var gptRes model.GPTResponse
+	if err := json.Unmarshal(resp.Body, &gptRes); err != nil {
+		return nil, fmt.Errorf("invalid OpenAI response: %w", err)
+	}
+	if len(gptRes.Choices) == 0 {
+		return nil, fmt.Errorf("OpenAI response has no choices")
+	}
+
+	return &BackendReply{
+		Reply: gptRes.Choices[0].Message.Content,
+		Model: gptRes.Model,
+		Usage: gptRes.Usage,
+	}, nil
+}
+
+func (b *openAIBackend) Stream(ctx context.Context, req *BackendRequest, onDelta func(delta string) error) (*BackendReply, error) {
+	url := b.completionsURL()
+	slog.DebugContext(ctx, "Calling OpenAI-compatible stream", "url", url)
+
+	payload, err := json.Marshal(b.request(req, true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := b.client.Stream(ctx, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := b.newRequest(ctx, url, payload)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Accept", "text/event-stream")
+		return httpReq, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		slog.WarnContext(ctx, "OpenAI service error", "status", resp.StatusCode, "body", bodySnippet([]byte(openAIErrorMessage(body))))
+		return nil, fmt.Errorf("OpenAI service error (status %d)", resp.StatusCode)
+	}
+
+	reply := &BackendReply{}
+	var text strings.Builder
+	err = readSSEData(resp.Body, func(data string) (bool, error) {
+		var chunk model.GPTResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("invalid OpenAI stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return false, fmt.Errorf("OpenAI error: %s", chunk.Error.Message)
+		}
+		if chunk.Model != "" {
+			reply.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			reply.Usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+	reply.Reply = text.String()
+	return reply, err
+}
+
+// post sends a non-streaming completion request
+func (b *openAIBackend) post(ctx context.Context, req *BackendRequest) (*upstream.Response, error) {
+	url := b.completionsURL()
+	slog.DebugContext(ctx, "Calling OpenAI-compatible API", "url", url)
+
+	payload, err := json.Marshal(b.request(req, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	return b.client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		return b.newRequest(ctx, url, payload)
+	})
+}
+
+func (b *openAIBackend) request(req *BackendRequest, stream bool) *model.GPTRequest {
+	gptReq := &model.GPTRequest{
+		Model:    req.Model,
+		Messages: req.Messages,
+		Stream:   stream,
+	}
+	if gptReq.Model == "" {
+		gptReq.Model = defaultOpenAIModel
+	}
+	if stream {
+		gptReq.StreamOptions = &model.GPTStreamOptions{IncludeUsage: true}
+	}
+	return gptReq
+}
+
+func (b *openAIBackend) newRequest(ctx context.Context, url string, payload []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if b.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+	return httpReq, nil
+}
+
+func (b *openAIBackend) completionsURL() string {
+	return strings.TrimRight(b.baseURL, "/") + "/chat/completions"
+}
+
+// openAIErrorMessage extracts error.message from an error body, falling back
+// to the raw body
+func openAIErrorMessage(body []byte) string {
+	var gptRes model.GPTResponse
+	if err := json.Unmarshal(body, &gptRes); err == nil && gptRes.Error != nil {
+		return gptRes.Error.Message
+	}
+	return string(body)
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/tracing"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ragBackend talks to the Python RAG service using its RAG_URL JSON contract
+type ragBackend struct {
+	url       string
+	streamURL string
+	client    *upstream.Client
+}
+
+func (b *ragBackend) Name() string {
+	return BackendRAG
+}
+
+func (b *ragBackend) Complete(ctx context.Context, req *BackendRequest) (*BackendReply, error) {
+	ragResponse, err := b.callRAGService(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &BackendReply{
+		Reply:            ragResponse.Reply,
+		UpstreamThreadID: ragResponse.ThreadID,
+		Model:            req.Model,
+		Usage:            ragResponse.Usage,
+	}, nil
+}
+
+func (b *ragBackend) Stream(ctx context.Context, req *BackendRequest, onDelta func(delta string) error) (*BackendReply, error) {
+	reply := &BackendReply{Model: req.Model}
+	var text strings.Builder
+	err := b.callRAGStreamService(ctx, req, func(chunk *model.RAGStreamChunk) error {
+		if chunk.ThreadID != "" {
+			reply.UpstreamThreadID = chunk.ThreadID
+		}
+		if chunk.Usage != nil {
+			reply.Usage = chunk.Usage
+		}
+		if chunk.Delta == "" {
+			return nil
+		}
+		text.WriteString(chunk.Delta)
+		return onDelta(chunk.Delta)
+	})
+	reply.Reply = text.String()
+	return reply, err
+}
+
+// ragPayload builds the JSON body understood by the RAG service
+func ragPayload(req *BackendRequest, stream bool) ([]byte, error) {
+	payload := map[string]interface{}{
+		"messages":  req.Messages,
+		"thread_id": req.ThreadID,
+	}
+	if stream {
+		payload["stream"] = true
+	}
+	if req.Model != "" {
+		payload["model"] = req.Model
+	}
+	if req.Language != "" {
+		payload["language"] = req.Language
+	}
+	return json.Marshal(payload)
+}
+
+func (b *ragBackend) callRAGService(ctx context.Context, req *BackendRequest) (ragRes *model.RAGResponse, err error) {
+	ctx, span := tracing.Start(ctx, "callRAGService", trace.WithAttributes(ragSpanAttributes(req)...))
+	defer func() { tracing.End(span, err) }()
+
+	RagURL := b.url
+	slog.DebugContext(ctx, "Calling RAG service", "url", RagURL)
+
+	// Prepare request payload
+	payload, err := ragPayload(req, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Make HTTP request
+	resp, err := b.client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, RagURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Body
+
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "RAG service error", "status", resp.StatusCode, "body", bodySnippet(body))
+		return nil, fmt.Errorf("RAG service error (status %d)", resp.StatusCode)
+	}
+	slog.DebugContext(ctx, "RAG response", "status", resp.StatusCode, "bytes", len(body))
+
+	ragRes = &model.RAGResponse{}
+	if err := json.Unmarshal(body, ragRes); err != nil {
+		return nil, fmt.Errorf("invalid RAG response: %w", err)
+	}
+
+	if ragRes.Error != "" {
+		slog.WarnContext(ctx, "RAG service reported an error", "body", bodySnippet([]byte(ragRes.Error)))
+		return nil, errors.New("RAG service reported an error")
+	}
+
+	return ragRes, nil
+}
+
+func (b *ragBackend) callRAGStreamService(ctx context.Context, req *BackendRequest, onChunk func(*model.RAGStreamChunk) error) (err error) {
+	ctx, span := tracing.Start(ctx, "callRAGStreamService", trace.WithAttributes(ragSpanAttributes(req)...))
+	defer func() { tracing.End(span, err) }()
+
+	ragStreamURL := b.streamURL
+	slog.DebugContext(ctx, "Calling RAG stream service", "url", ragStreamURL)
+
+	payload, err := ragPayload(req, true)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := b.client.Stream(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ragStreamURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySnippet+1))
+		slog.WarnContext(ctx, "RAG stream service error", "status", resp.StatusCode, "body", bodySnippet(body))
+		return fmt.Errorf("RAG stream service error (status %d)", resp.StatusCode)
+	}
+
+	// The upstream speaks SSE: one JSON chunk per "data:" line, terminated
+	// by either a chunk with done=true or a literal [DONE] sentinel.
+	return readSSEData(resp.Body, func(data string) (bool, error) {
+		var chunk model.RAGStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("invalid RAG stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			slog.WarnContext(ctx, "RAG stream reported an error", "body", bodySnippet([]byte(chunk.Error)))
+			return false, errors.New("RAG stream reported an error")
+		}
+		if err := onChunk(&chunk); err != nil {
+			return false, err
+		}
+		return chunk.Done, nil
+	})
+}
+
+// ragSpanAttributes describes a RAG call on its span
+func ragSpanAttributes(req *BackendRequest) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("rag.thread_id", req.ThreadID),
+		attribute.Int("rag.messages", len(req.Messages)),
+		attribute.String("rag.model", req.Model),
+		attribute.String("rag.language", req.Language),
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// background tracks the goroutines that write after their request has
+// been answered, so a shutdown can wait for them
+var background sync.WaitGroup
+
+// goBackground runs fn in a goroutine that Flush waits for
+func goBackground(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// Flush waits until the background writes started so far have finished,
+// or returns ctx's error when it is done first
+func Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
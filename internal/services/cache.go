@@ -0,0 +1,194 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/cache"
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/metrics"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"gorm.io/gorm"
+)
+
+// cachedReply is an in-memory response cache entry
+type cachedReply struct {
+	backend string
+	model   string
+	reply   string
+}
+
+// persistedMemoryTTL bounds how long a replica serves a persisted entry
+// from memory, so invalidations made by other replicas reach it in time
+const persistedMemoryTTL = time.Minute
+
+// cachePurgeInterval is how often expired persisted entries are deleted
+const cachePurgeInterval = 10 * time.Minute
+
+// ResponseCache caches assistant replies to short conversations keyed on
+// the conversation and the backend and model that produced them. Entries
+// live in a bounded in-memory LRU and, when CACHE_PERSIST is set, in the
+// database so they survive restarts and are shared between replicas.
+type ResponseCache struct {
+	memory    *cache.LRU[cachedReply]
+	memoryTTL time.Duration
+	store     *repository.CacheRepository
+	ttl       time.Duration
+	suffix    int
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewResponseCache returns the response cache configured in cfg, or nil when
+// caching is disabled. Entries are persisted to store when CACHE_PERSIST is
+// set.
+func NewResponseCache(cfg *config.Config, store *repository.CacheRepository) *ResponseCache {
+	if !cfg.CacheEnabled {
+		return nil
+	}
+	responseCache := &ResponseCache{
+		memoryTTL: cfg.CacheTTL,
+		ttl:       cfg.CacheTTL,
+		suffix:    cfg.CacheSuffixMessages,
+	}
+	// The database is the shared copy; memory only saves round trips
+	if cfg.CachePersist {
+		responseCache.store = store
+		responseCache.memoryTTL = min(cfg.CacheTTL, persistedMemoryTTL)
+	}
+	responseCache.memory = cache.NewLRU[cachedReply](cfg.CacheMaxEntries, responseCache.memoryTTL)
+	return responseCache
+}
+
+// Key derives the cache key for a request to backend/model answered in
+// language. Leading system messages always count, so replies in different
+// languages or to different instructions never share a key.
+//
+// The cache is shared by every user, so only conversations of at most
+// CACHE_SUFFIX_MESSAGES turns are cached: a longer thread may carry private
+// context that the reply depends on. Key returns "" for those.
+func (c *ResponseCache) Key(backend, modelName, language string, messages []model.GPTMessage) string {
+	var system []model.GPTMessage
+	for len(messages) > 0 && messages[0].Role == "system" {
+		system = append(system, messages[0])
+		messages = messages[1:]
+	}
+	if c.suffix > 0 && len(messages) > c.suffix {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(backend + "\x00" + modelName + "\x00" + language + "\x00"))
+	for _, m := range append(system, messages...) {
+		h.Write([]byte(m.Role + "\x00" + normalizePrompt(m.Content) + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached reply for key and records the lookup in the
+// cache metrics
+func (c *ResponseCache) Get(key string) (string, bool) {
+	reply, ok := c.get(key)
+	metrics.CacheLookup(ok)
+	return reply, ok
+}
+
+func (c *ResponseCache) get(key string) (string, bool) {
+	if entry, ok := c.memory.Get(key); ok {
+		return entry.reply, true
+	}
+	if c.store == nil {
+		return "", false
+	}
+
+	stored, err := c.store.GetResponse(key)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("Failed to read response cache", "err", err)
+		}
+		return "", false
+	}
+	// Keep the entry no longer than the database does
+	expiresAt := time.Now().Add(c.memoryTTL)
+	if stored.ExpiresAt.Before(expiresAt) {
+		expiresAt = stored.ExpiresAt
+	}
+	c.memory.SetUntil(key, cachedReply{backend: stored.Backend, model: stored.Model, reply: stored.Reply}, expiresAt)
+	return stored.Reply, true
+}
+
+// Set caches reply under key
+func (c *ResponseCache) Set(key, backend, modelName, reply string) {
+	c.memory.Set(key, cachedReply{backend: backend, model: modelName, reply: reply})
+	if c.store == nil {
+		return
+	}
+
+	now := time.Now()
+	err := c.store.PutResponse(&model.CachedResponse{
+		Key:       key,
+		Backend:   backend,
+		Model:     modelName,
+		Reply:     reply,
+		CreatedAt: now,
+		ExpiresAt: now.Add(c.ttl),
+	})
+	if err != nil {
+		slog.Error("Failed to write response cache", "err", err)
+	}
+	c.purgeExpired(now)
+}
+
+// purgeExpired deletes expired persisted entries in the background, at most
+// once per cachePurgeInterval so the cost is spread over many writes
+func (c *ResponseCache) purgeExpired(now time.Time) {
+	c.mu.Lock()
+	if now.Sub(c.lastPurge) < cachePurgeInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastPurge = now
+	c.mu.Unlock()
+
+	goBackground(func() {
+		removed, err := c.store.DeleteExpiredResponses(now)
+		if err != nil {
+			slog.Error("Failed to purge response cache", "err", err)
+			return
+		}
+		if removed > 0 {
+			slog.Debug("Purged expired cached responses", "removed", removed)
+		}
+	})
+}
+
+// Invalidate removes every entry, or only those of one backend when backend
+// is not empty, and reports how many were removed. Persisted entries are
+// removed for every replica; other replicas may serve their in-memory copy
+// for up to persistedMemoryTTL.
+func (c *ResponseCache) Invalidate(backend string) (int64, error) {
+	backend = strings.ToLower(strings.TrimSpace(backend))
+	removed := int64(c.memory.DeleteFunc(func(_ string, entry cachedReply) bool {
+		return backend == "" || entry.backend == backend
+	}))
+	if c.store == nil {
+		return removed, nil
+	}
+
+	stored, err := c.store.DeleteResponses(backend)
+	if err != nil {
+		return removed, err
+	}
+	// Persisted entries are usually also in memory; report the larger count
+	if stored > removed {
+		removed = stored
+	}
+	return removed, nil
+}
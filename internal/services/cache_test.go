@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/i18n"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+func newTestResponseCache(t *testing.T, persist bool) (*ResponseCache, *repository.CacheRepository) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.CachePersist = persist
+	store := repository.NewCacheRepository(newTestDB(t))
+	return NewResponseCache(cfg, store), store
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	msg := func(role, content string) model.GPTMessage {
+		return model.GPTMessage{Role: role, Content: content}
+	}
+	responseCache, _ := newTestResponseCache(t, false)
+	responseCache.suffix = 3
+	base := []model.GPTMessage{msg("user", "q1"), msg("assistant", "a1"), msg("user", "q2")}
+
+	for _, tc := range []struct {
+		name      string
+		backend   string
+		model     string
+		language  string
+		messages  []model.GPTMessage
+		wantEqual bool
+	}{
+		{"same request", "rag", "gpt", "en", base, true},
+		{"different start", "rag", "gpt", "en", []model.GPTMessage{msg("user", "other"), msg("assistant", "a1"), msg("user", "q2")}, false},
+		{"case and spacing are ignored", "rag", "gpt", "en", []model.GPTMessage{msg("user", "q1"), msg("assistant", " A1 "), msg("user", "Q2")}, true},
+		{"different suffix", "rag", "gpt", "en", []model.GPTMessage{msg("user", "q1"), msg("assistant", "a1"), msg("user", "q3")}, false},
+		{"different role", "rag", "gpt", "en", []model.GPTMessage{msg("user", "q1"), msg("user", "a1"), msg("user", "q2")}, false},
+		{"shorter than the suffix", "rag", "gpt", "en", base[2:], false},
+		{"different backend", "openai", "gpt", "en", base, false},
+		{"different model", "rag", "gpt-mini", "en", base, false},
+		{"different language", "rag", "gpt", "th", base, false},
+		{"different system prompt", "rag", "gpt", "en", append([]model.GPTMessage{msg("system", "be brief")}, base...), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			equal := responseCache.Key(tc.backend, tc.model, tc.language, tc.messages) == responseCache.Key("rag", "gpt", "en", base)
+			if equal != tc.wantEqual {
+				t.Errorf("key matches the base request: %v, want %v", equal, tc.wantEqual)
+			}
+		})
+	}
+
+	// Longer conversations may depend on private context and are not cached
+	long := append([]model.GPTMessage{msg("user", "my name is Jane")}, base...)
+	if key := responseCache.Key("rag", "gpt", "en", long); key != "" {
+		t.Errorf("Key of a %d message conversation = %q, want none", len(long), key)
+	}
+
+	// System prompts count without taking up the suffix
+	thai := append([]model.GPTMessage{msg("system", i18n.SystemPrompt(i18n.Thai))}, base...)
+	english := append([]model.GPTMessage{msg("system", i18n.SystemPrompt(i18n.English))}, base...)
+	if responseCache.Key("rag", "gpt", "", thai) == responseCache.Key("rag", "gpt", "", english) {
+		t.Error("conversations with different system prompts share a key")
+	}
+
+	// Without a suffix limit conversations of any length are cached
+	responseCache.suffix = 0
+	if key := responseCache.Key("rag", "gpt", "en", long); key == "" || key == responseCache.Key("rag", "gpt", "en", base) {
+		t.Errorf("suffix 0: Key = %q, want one for the whole conversation", key)
+	}
+}
+
+func TestResponseCachePersistedFallback(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		persist bool
+		hit     bool
+	}{
+		{"persisted", true, true},
+		{"memory only", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.CachePersist = tc.persist
+			store := repository.NewCacheRepository(newTestDB(t))
+			NewResponseCache(cfg, store).Set("key", "rag", "gpt", "cached reply")
+
+			// A restart or another replica starts with an empty memory cache
+			restarted := NewResponseCache(cfg, store)
+			reply, ok := restarted.Get("key")
+			if ok != tc.hit || (tc.hit && reply != "cached reply") {
+				t.Errorf("Get = %q, %v; want hit %v", reply, ok, tc.hit)
+			}
+			if tc.hit && restarted.memory.Len() != 1 {
+				t.Error("persisted entry was not loaded into memory")
+			}
+		})
+	}
+
+	// Invalidation removes persisted entries too
+	responseCache, store := newTestResponseCache(t, true)
+	responseCache.Set("rag-key", "rag", "gpt", "a")
+	responseCache.Set("openai-key", "openai", "gpt", "b")
+	if removed, err := responseCache.Invalidate("RAG"); err != nil || removed != 1 {
+		t.Errorf("Invalidate(RAG) = %d, %v; want 1", removed, err)
+	}
+	if _, err := store.GetResponse("rag-key"); err == nil {
+		t.Error("invalidated entry is still persisted")
+	}
+	if _, err := store.GetResponse("openai-key"); err != nil {
+		t.Errorf("entry of another backend was removed: %v", err)
+	}
+}
+
+func TestResponseCachePersistedExpiry(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.Default()
+	cfg.CachePersist = true
+	store := repository.NewCacheRepository(db)
+	responseCache := NewResponseCache(cfg, store)
+
+	// Other replicas' invalidations reach this one within a minute
+	if responseCache.memoryTTL != persistedMemoryTTL {
+		t.Errorf("memory TTL = %s, want %s", responseCache.memoryTTL, persistedMemoryTTL)
+	}
+
+	// An entry read from the database expires with its row, not a fresh TTL
+	now := time.Now()
+	if err := store.PutResponse(&model.CachedResponse{
+		Key: "soon", Backend: "rag", Model: "gpt", Reply: "old",
+		CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(100 * time.Millisecond),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := responseCache.Get("soon"); !ok {
+		t.Fatal("Get missed a persisted entry")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := responseCache.Get("soon"); ok {
+		t.Error("entry outlived its persisted expiry in memory")
+	}
+
+	// Writes purge expired rows
+	if err := store.PutResponse(&model.CachedResponse{
+		Key: "expired", Backend: "rag", Model: "gpt", Reply: "old",
+		CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	responseCache.Set("fresh", "rag", "gpt", "new")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	if err := db.Model(&model.CachedResponse{}).Order("cache_key").Pluck("cache_key", &keys).Error; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "fresh" {
+		t.Errorf("persisted keys after the purge = %q, want only fresh", keys)
+	}
+}
+
+// countingBackend answers every request with the same reply and counts the
+// calls it gets
+type countingBackend struct {
+	calls int
+}
+
+func (b *countingBackend) Name() string { return BackendEcho }
+
+func (b *countingBackend) Complete(ctx context.Context, req *BackendRequest) (*BackendReply, error) {
+	b.calls++
+	return &BackendReply{Reply: "fresh reply"}, nil
+}
+
+func (b *countingBackend) Stream(ctx context.Context, req *BackendRequest, onDelta func(delta string) error) (*BackendReply, error) {
+	b.calls++
+	return &BackendReply{Reply: "fresh reply"}, onDelta("fresh reply")
+}
+
+func TestChatCacheHitSkipsTheBackend(t *testing.T) {
+	db := newTestDB(t)
+	responseCache, _ := newTestResponseCache(t, false)
+	backend := &countingBackend{}
+	service := func() *ChatService {
+		return &ChatService{
+			conversations: repository.NewConversationRepository(db),
+			backend:       backend,
+			model:         "gpt",
+			cache:         responseCache,
+			usage:         NewUsageService(repository.NewUsageRepository(db), nil),
+			ctx:           context.Background(),
+		}
+	}
+	messages := []model.GPTMessage{{Role: "user", Content: "What is eyeQcheck?"}}
+
+	first, err := service().ProcessChat(context.Background(), messages, "", "user-1")
+	if err != nil {
+		t.Fatalf("first ProcessChat: %v", err)
+	}
+	if first.Cached || backend.calls != 1 {
+		t.Fatalf("first request: cached=%v, backend calls=%d; want a backend call", first.Cached, backend.calls)
+	}
+
+	second, err := service().ProcessChat(context.Background(), messages, "", "user-2")
+	if err != nil {
+		t.Fatalf("second ProcessChat: %v", err)
+	}
+	if !second.Cached || second.Reply != "fresh reply" || backend.calls != 1 {
+		t.Errorf("second request: cached=%v reply=%q, backend calls=%d; want a cache hit without a backend call",
+			second.Cached, second.Reply, backend.calls)
+	}
+
+	// The cached reply is still stored in the thread
+	stored, err := repository.NewConversationRepository(db).ListMessages(second.ThreadID)
+	if err != nil || len(stored) != 2 || !stored[1].Cached {
+		t.Errorf("thread of the cached reply = %+v, %v; want the question and a cached reply", stored, err)
+	}
+}
+
+func TestChatLongThreadsAreNotCached(t *testing.T) {
+	db := newTestDB(t)
+	responseCache, _ := newTestResponseCache(t, false)
+	backend := &countingBackend{}
+	messages := []model.GPTMessage{
+		{Role: "user", Content: "My diagnosis is private"},
+		{Role: "assistant", Content: "Noted"},
+		{Role: "user", Content: "What should I do?"},
+		{Role: "assistant", Content: "Rest"},
+		{Role: "user", Content: "Anything else?"},
+	}
+	for _, userID := range []string{"user-1", "user-2"} {
+		s := &ChatService{
+			conversations: repository.NewConversationRepository(db),
+			backend:       backend,
+			cache:         responseCache,
+			usage:         NewUsageService(repository.NewUsageRepository(db), nil),
+			ctx:           context.Background(),
+		}
+		resp, err := s.ProcessChat(context.Background(), messages, "", userID)
+		if err != nil {
+			t.Fatalf("ProcessChat: %v", err)
+		}
+		if resp.Cached {
+			t.Errorf("%s got a cached reply to a long thread", userID)
+		}
+	}
+	if backend.calls != 2 {
+		t.Errorf("backend calls = %d, want 2", backend.calls)
+	}
+}
@@ -1,102 +1,351 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/i18n"
 	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
 	"github.com/google/uuid"
 )
 
-type ChatService struct{}
-
-func NewChatService() *ChatService {
-	return &ChatService{}
-}
-
-func (s *ChatService) ProcessChat(messages []model.GPTMessage, threadID string) (*model.ChatResponse, error) {
-    // Generate thread_id if not provided
-    if threadID == "" {
-        threadID = uuid.New().String()
-    }
-
-    // Append user message to log
-    if len(messages) > 0 {
-        if err := AppendMessageToLog(threadID, messages[len(messages)-1]); err != nil {
-            log.Printf("Failed to append user message to log: %v", err)
-        }
-    }
-
-    // Call RAG service
-    ragResponse, err := s.callRAGService(messages, threadID)
-    if err != nil {
-        return nil, err
-    }
-
-    // Append assistant reply to log
-    if ragResponse.Reply != "" {
-        assistantMsg := model.GPTMessage{
-            Role:    "assistant",
-            Content: ragResponse.Reply,
-        }
-        if err := AppendMessageToLog(threadID, assistantMsg); err != nil {
-            log.Printf("Failed to append assistant message to log: %v", err)
-        }
-    }
-
-    return &model.ChatResponse{
-        Reply:    ragResponse.Reply,
-        ThreadID: ragResponse.ThreadID,
-        Cached:   false,
-    }, nil
-}
-
-func (s *ChatService) callRAGService(messages []model.GPTMessage, threadID string) (*model.RAGResponse, error) {
-	cfg := config.Load()
-
-    RagURL := cfg.RagURL
-    log.Printf("Calling RAG service at: %s", RagURL)
-
-    // Prepare request payload
-    payload, err := json.Marshal(map[string]interface{}{
-        "messages":  messages,
-        "thread_id": threadID,
-    })
-    if err != nil {
-        return nil, fmt.Errorf("failed to marshal request: %w", err)
-    }
-
-    // Make HTTP request
-    resp, err := http.Post(RagURL, "application/json", bytes.NewBuffer(payload))
-    if err != nil {
-        return nil, fmt.Errorf("RAG service unavailable: %w", err)
-    }
-    defer resp.Body.Close()
-
-    body, err := io.ReadAll(resp.Body)
-    if err != nil {
-        return nil, fmt.Errorf("failed to read response: %w", err)
-    }
-
-    log.Printf("RAG raw response body: %s", string(body))
-
-    if resp.StatusCode != http.StatusOK {
-        return nil, fmt.Errorf("RAG service error: %s", string(body))
-    }
-
-    var ragRes model.RAGResponse
-    if err := json.Unmarshal(body, &ragRes); err != nil {
-        return nil, fmt.Errorf("invalid RAG response: %w", err)
-    }
-
-    if ragRes.Error != "" {
-        return nil, fmt.Errorf("RAG error: %s", ragRes.Error)
-    }
-
-    return &ragRes, nil
-}
\ No newline at end of file
+// ChatService answers one chat request. It is cheap to build and holds
+// per-request state, so handlers build a new one for every request.
+type ChatService struct {
+	conversations *repository.ConversationRepository
+	backends      *ChatBackends
+	backend       ChatBackend
+	model         string
+	cache         *ResponseCache
+	usage         *UsageService
+	history       historyLimits
+	planID        string
+	language      string
+	ctx           context.Context
+}
+
+// NewChatService returns a chat service using the backend and model
+// configured in cfg. cache may be nil to disable response caching.
+func NewChatService(cfg *config.Config, conversations *repository.ConversationRepository, backends *ChatBackends, cache *ResponseCache, usage *UsageService) *ChatService {
+	backend, err := backends.New(cfg.ChatBackend)
+	if err != nil {
+		slog.Warn("Falling back to the default chat backend", "backend", BackendRAG, "err", err)
+		backend, _ = backends.New(BackendRAG)
+	}
+
+	return &ChatService{
+		conversations: conversations,
+		backends:      backends,
+		backend:       backend,
+		model:         cfg.ChatModel,
+		cache:         cache,
+		usage:         usage,
+		history: historyLimits{
+			maxMessages: cfg.HistoryMaxMessages,
+			maxTokens:   cfg.HistoryMaxTokens,
+		},
+		ctx: context.Background(),
+	}
+}
+
+// UseBackend overrides the deployment's chat backend and model for this
+// service. Empty values keep the current setting.
+func (s *ChatService) UseBackend(name, model string) error {
+	if name != "" {
+		backend, err := s.backends.New(name)
+		if err != nil {
+			return err
+		}
+		s.backend = backend
+	}
+	if model != "" {
+		s.model = model
+	}
+	return nil
+}
+
+// UsePlan sets the plan the caller's usage is recorded under
+func (s *ChatService) UsePlan(planID string) {
+	s.planID = planID
+}
+
+// UseLanguage sets the language replies should be in. The assistant is
+// told so in a system message unless the conversation already starts with
+// one.
+func (s *ChatService) UseLanguage(lang string) {
+	s.language = lang
+}
+
+// bindContext runs the service's database queries with ctx so they are
+// traced and logged as part of the request. Cancellation is dropped: a
+// reply is still stored when the client goes away.
+func (s *ChatService) bindContext(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+	s.ctx = ctx
+	s.conversations = s.conversations.WithContext(ctx)
+	s.usage = s.usage.WithContext(ctx)
+}
+
+// circuitOpenReply is returned instead of an error while the backend's
+// circuit breaker is open
+const circuitOpenReply = "Our assistant is temporarily unavailable. Please try again in a minute."
+
+func (s *ChatService) ProcessChat(ctx context.Context, messages []model.GPTMessage, threadID, userID string) (*model.ChatResponse, error) {
+	s.bindContext(ctx)
+
+	// Generate thread_id if not provided
+	if threadID == "" {
+		threadID = uuid.New().String()
+	}
+
+	if err := checkThreadAccess(s.conversations, threadID, userID); err != nil {
+		return nil, err
+	}
+
+	// Store user message
+	if len(messages) > 0 {
+		s.saveMessage(threadID, userID, &model.Message{
+			Role:    messages[len(messages)-1].Role,
+			Content: messages[len(messages)-1].Content,
+		})
+	}
+
+	// Serve repeated questions from the response cache
+	req := s.backendRequest(messages, threadID)
+	cacheKey := s.cacheKey(req)
+	if cached, ok := s.cachedReply(cacheKey); ok {
+		s.saveMessage(threadID, userID, s.cachedMessage(cached))
+		s.recordCachedUsage(threadID, userID)
+		return &model.ChatResponse{
+			Reply:    cached,
+			ThreadID: threadID,
+			Cached:   true,
+			Usage:    &model.Usage{},
+		}, nil
+	}
+
+	// Call the chat backend
+	started := time.Now()
+	reply, err := s.backend.Complete(ctx, req)
+	if errors.Is(err, upstream.ErrCircuitOpen) {
+		return &model.ChatResponse{
+			Reply:    circuitOpenReply,
+			ThreadID: threadID,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Store assistant reply
+	usage := s.recordUsage(req, reply, threadID, userID)
+	if reply.Reply != "" {
+		s.saveMessage(threadID, userID, s.assistantMessage(reply, started))
+		s.storeCachedReply(cacheKey, reply.Reply)
+	}
+
+	return &model.ChatResponse{
+		Reply:    reply.Reply,
+		ThreadID: threadID,
+		Cached:   false,
+		Usage:    usage,
+	}, nil
+}
+
+// StreamChat forwards the conversation to the backend's streaming mode and
+// calls onDelta for every token chunk as it arrives. The complete assistant
+// reply is stored when the stream ends, fails or ctx is cancelled because the
+// client went away.
+func (s *ChatService) StreamChat(ctx context.Context, messages []model.GPTMessage, threadID, userID string, onDelta func(delta string) error) (*model.ChatStreamDone, error) {
+	s.bindContext(ctx)
+
+	if threadID == "" {
+		threadID = uuid.New().String()
+	}
+
+	if err := checkThreadAccess(s.conversations, threadID, userID); err != nil {
+		return nil, err
+	}
+
+	if len(messages) > 0 {
+		s.saveMessage(threadID, userID, &model.Message{
+			Role:    messages[len(messages)-1].Role,
+			Content: messages[len(messages)-1].Content,
+		})
+	}
+
+	req := s.backendRequest(messages, threadID)
+	cacheKey := s.cacheKey(req)
+	if cached, ok := s.cachedReply(cacheKey); ok {
+		s.saveMessage(threadID, userID, s.cachedMessage(cached))
+		s.recordCachedUsage(threadID, userID)
+		if err := onDelta(cached); err != nil {
+			return nil, err
+		}
+		return &model.ChatStreamDone{ThreadID: threadID, Usage: &model.Usage{}, Cached: true}, nil
+	}
+
+	started := time.Now()
+	var text strings.Builder
+	reply, err := s.backend.Stream(ctx, req, func(delta string) error {
+		text.WriteString(delta)
+		return onDelta(delta)
+	})
+
+	// Whatever was streamed is stored and accounted for, even if the stream
+	// was cut short
+	var usage *model.Usage
+	if text.Len() > 0 {
+		if reply == nil {
+			reply = &BackendReply{}
+		}
+		reply.Reply = text.String()
+		usage = s.recordUsage(req, reply, threadID, userID)
+		s.saveMessage(threadID, userID, s.assistantMessage(reply, started))
+	}
+
+	if errors.Is(err, upstream.ErrCircuitOpen) && text.Len() == 0 {
+		if err := onDelta(circuitOpenReply); err != nil {
+			return nil, err
+		}
+		return &model.ChatStreamDone{ThreadID: threadID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.Reply != "" {
+		s.storeCachedReply(cacheKey, reply.Reply)
+	}
+
+	return &model.ChatStreamDone{
+		ThreadID: threadID,
+		Usage:    usage,
+	}, nil
+}
+
+func (s *ChatService) backendRequest(messages []model.GPTMessage, threadID string) *BackendRequest {
+	messages = s.history.trim(messages)
+	if prompt := i18n.SystemPrompt(s.language); prompt != "" && (len(messages) == 0 || messages[0].Role != "system") {
+		messages = append([]model.GPTMessage{{Role: "system", Content: prompt}}, messages...)
+	}
+	return &BackendRequest{
+		Messages: messages,
+		ThreadID: threadID,
+		Model:    s.model,
+		Language: s.language,
+	}
+}
+
+// assistantMessage builds the stored message for a backend reply, including
+// its upstream metadata
+func (s *ChatService) assistantMessage(reply *BackendReply, started time.Time) *model.Message {
+	message := &model.Message{
+		Role:             "assistant",
+		Content:          reply.Reply,
+		Backend:          s.backend.Name(),
+		Model:            reply.Model,
+		UpstreamThreadID: reply.UpstreamThreadID,
+		LatencyMS:        time.Since(started).Milliseconds(),
+	}
+	if reply.Usage != nil {
+		message.PromptTokens = reply.Usage.PromptTokens
+		message.CompletionTokens = reply.Usage.CompletionTokens
+	}
+	return message
+}
+
+// recordUsage stores the token usage of a backend reply, estimating it when
+// the backend did not report any, and returns it. reply.Usage is filled in
+// with the estimate so the stored message carries it too.
+func (s *ChatService) recordUsage(req *BackendRequest, reply *BackendReply, threadID, userID string) *model.Usage {
+	estimated := reply.Usage == nil
+	if estimated {
+		reply.Usage = estimateUsage(req.Messages, reply.Reply)
+	}
+
+	s.usage.Record(&model.UsageRecord{
+		UserID:           userID,
+		ThreadID:         threadID,
+		PlanID:           s.planID,
+		Kind:             model.UsageKindChat,
+		Backend:          s.backend.Name(),
+		Model:            reply.Model,
+		PromptTokens:     reply.Usage.PromptTokens,
+		CompletionTokens: reply.Usage.CompletionTokens,
+		TotalTokens:      reply.Usage.TotalTokens,
+		Estimated:        estimated,
+	})
+	return reply.Usage
+}
+
+// recordCachedUsage records a reply served from the response cache, which
+// costs no tokens
+func (s *ChatService) recordCachedUsage(threadID, userID string) {
+	s.usage.Record(&model.UsageRecord{
+		UserID:   userID,
+		ThreadID: threadID,
+		PlanID:   s.planID,
+		Kind:     model.UsageKindChat,
+		Backend:  s.backend.Name(),
+		Model:    s.model,
+		Cached:   true,
+	})
+}
+
+// cacheKey returns the response cache key for req, or "" when caching is off
+// cacheKey returns the response cache key for req, or "" when the reply must
+// not be cached
+func (s *ChatService) cacheKey(req *BackendRequest) string {
+	if s.cache == nil {
+		return ""
+	}
+	return s.cache.Key(s.backend.Name(), s.model, req.Language, req.Messages)
+}
+
+func (s *ChatService) cachedReply(cacheKey string) (string, bool) {
+	if cacheKey == "" {
+		return "", false
+	}
+	return s.cache.Get(cacheKey)
+}
+
+func (s *ChatService) storeCachedReply(cacheKey, reply string) {
+	if cacheKey == "" {
+		return
+	}
+	s.cache.Set(cacheKey, s.backend.Name(), s.model, reply)
+}
+
+// cachedMessage builds the stored message for a reply served from the cache
+func (s *ChatService) cachedMessage(reply string) *model.Message {
+	return &model.Message{
+		Role:    "assistant",
+		Content: reply,
+		Backend: s.backend.Name(),
+		Model:   s.model,
+		Cached:  true,
+	}
+}
+
+// saveMessage writes a message to the thread's conversation, creating the
+// conversation for userID on first use. Failures are logged rather than
+// returned so a database hiccup never costs the user their reply.
+func (s *ChatService) saveMessage(threadID, userID string, message *model.Message) {
+	conversation := &model.Conversation{
+		ID:     threadID,
+		UserID: userID,
+	}
+	if message.Role == "user" {
+		conversation.CandidateName = extractCandidateName(message.Content)
+	}
+	if err := s.conversations.AppendMessage(conversation, message); err != nil {
+		slog.ErrorContext(s.ctx, "Failed to store message", "role", message.Role, "thread_id", threadID, "err", err)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrConversationNotFound is returned when a thread does not exist or is not
+// owned by the caller. Both cases look the same to clients so thread IDs of
+// other users cannot be probed.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+const (
+	defaultConversationPageSize = 20
+	maxConversationPageSize     = 100
+)
+
+type ConversationService struct {
+	conversations *repository.ConversationRepository
+}
+
+func NewConversationService(conversations *repository.ConversationRepository) *ConversationService {
+	return &ConversationService{
+		conversations: conversations,
+	}
+}
+
+// ListConversations returns a page of the user's conversations. Out of range
+// page values are clamped to sensible defaults.
+func (s *ConversationService) ListConversations(userID string, page, pageSize int) (*model.ConversationListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultConversationPageSize
+	}
+	if pageSize > maxConversationPageSize {
+		pageSize = maxConversationPageSize
+	}
+
+	conversations, total, err := s.conversations.ListConversationsByUser(userID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ConversationListResponse{
+		Conversations: conversations,
+		Page:          page,
+		PageSize:      pageSize,
+		Total:         total,
+	}, nil
+}
+
+// GetConversation returns one of the user's conversations with its messages
+func (s *ConversationService) GetConversation(userID, threadID string) (*model.ConversationDetailResponse, error) {
+	conversation, err := s.getOwnedConversation(userID, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.conversations.ListMessages(threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ConversationDetailResponse{
+		Conversation: *conversation,
+		Messages:     messages,
+	}, nil
+}
+
+// RenameConversation changes the title of one of the user's conversations
+func (s *ConversationService) RenameConversation(userID, threadID, title string) (*model.Conversation, error) {
+	conversation, err := s.getOwnedConversation(userID, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.conversations.UpdateConversationTitle(threadID, title); err != nil {
+		return nil, err
+	}
+	conversation.Title = title
+
+	return conversation, nil
+}
+
+// DeleteConversation deletes one of the user's conversations
+func (s *ConversationService) DeleteConversation(userID, threadID string) error {
+	if _, err := s.getOwnedConversation(userID, threadID); err != nil {
+		return err
+	}
+	return s.conversations.DeleteConversation(threadID)
+}
+
+func (s *ConversationService) getOwnedConversation(userID, threadID string) (*model.Conversation, error) {
+	conversation, err := s.conversations.GetConversationByID(threadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if conversation.UserID != userID {
+		return nil, ErrConversationNotFound
+	}
+	return conversation, nil
+}
+
+// checkThreadAccess verifies that userID may post to threadID. Unknown
+// threads are fine since the first message creates them; threads that were
+// deleted or belong to someone else are reported as ErrConversationNotFound.
+// Threads without an owner, such as imported ones, are nobody's to continue.
+func checkThreadAccess(conversations *repository.ConversationRepository, threadID, userID string) error {
+	if userID == "" {
+		return ErrConversationNotFound
+	}
+	conversation, err := conversations.GetConversationByIDUnscoped(threadID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if conversation.DeletedAt.Valid || conversation.UserID != userID {
+		return ErrConversationNotFound
+	}
+	return nil
+}
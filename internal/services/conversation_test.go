@@ -0,0 +1,60 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+func TestThreadOwnership(t *testing.T) {
+	conversations := repository.NewConversationRepository(newTestDB(t))
+	guest := GuestQuotaSubject("192.0.2.1")
+
+	for _, conversation := range []*model.Conversation{
+		{ID: "user-thread", UserID: "user-1"},
+		{ID: "guest-thread", UserID: guest},
+	} {
+		if err := conversations.AppendMessage(conversation, &model.Message{Role: "user", Content: "hello"}); err != nil {
+			t.Fatalf("AppendMessage(%s): %v", conversation.ID, err)
+		}
+	}
+	// Imported threads may have no owner
+	if _, err := conversations.ImportConversation(&model.Conversation{ID: "imported-thread"}, nil); err != nil {
+		t.Fatalf("ImportConversation: %v", err)
+	}
+
+	for _, tc := range []struct {
+		thread, user string
+		allowed      bool
+	}{
+		{"user-thread", "user-1", true},
+		{"user-thread", "user-2", false},
+		{"user-thread", guest, false},
+		{"guest-thread", guest, true},
+		{"guest-thread", GuestQuotaSubject("192.0.2.2"), false},
+		{"guest-thread", "", false},
+		{"imported-thread", "user-1", false},
+		{"imported-thread", "", false},
+		{"new-thread", "user-1", true},
+		{"new-thread", "", false},
+	} {
+		err := checkThreadAccess(conversations, tc.thread, tc.user)
+		if tc.allowed && err != nil {
+			t.Errorf("%s by %q: %v", tc.thread, tc.user, err)
+		}
+		if !tc.allowed && !errors.Is(err, ErrConversationNotFound) {
+			t.Errorf("%s by %q: err = %v, want ErrConversationNotFound", tc.thread, tc.user, err)
+		}
+
+		// Storage refuses the same writes
+		err = conversations.AppendMessage(&model.Conversation{ID: tc.thread, UserID: tc.user}, &model.Message{Role: "user", Content: "hi"})
+		if tc.allowed && err != nil {
+			t.Errorf("AppendMessage to %s by %q: %v", tc.thread, tc.user, err)
+		}
+		if !tc.allowed && !errors.Is(err, repository.ErrConversationOwner) {
+			t.Errorf("AppendMessage to %s by %q: err = %v, want ErrConversationOwner", tc.thread, tc.user, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns an empty in-memory database with every table. The
+// single connection keeps the whole test on the same memory database.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		// Background writes must not outlive the database
+		Flush(context.Background())
+		sqlDB.Close()
+	})
+
+	if err := db.AutoMigrate(
+		&model.User{}, &model.UserPreferences{},
+		&model.Conversation{}, &model.Message{},
+		&model.Plan{}, &model.PlanLimit{}, &model.UserPlan{}, &model.QuotaUsage{},
+		&model.Subscription{}, &model.UsageRecord{}, &model.CachedResponse{},
+	); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+)
+
+// Readiness check names
+const (
+	CheckDatabase = "database"
+	CheckRAG      = "rag"
+	CheckSTT      = "stt"
+	CheckLogsDir  = "logs_dir"
+)
+
+// healthCheck is one dependency probed by the HealthService
+type healthCheck struct {
+	name     string
+	required bool
+	// cacheTTL, when set, reuses a result for that long so frequent probes
+	// do not load the upstream services
+	cacheTTL time.Duration
+	check    func(ctx context.Context) error
+}
+
+// cachedCheck is the last result of a cached health check
+type cachedCheck struct {
+	result model.ReadinessCheck
+	at     time.Time
+}
+
+// HealthService runs the readiness checks behind /readyz
+type HealthService struct {
+	checks  []healthCheck
+	timeout time.Duration
+
+	mu     sync.Mutex
+	cached map[string]cachedCheck
+}
+
+// NewHealthService builds the readiness checks for cfg, probing the
+// database with pingDB. The database, the logs directory and the STT service
+// are always required; the RAG service only when it is the chat backend.
+func NewHealthService(cfg *config.Config, pingDB func(ctx context.Context) error) *HealthService {
+	probes := &http.Client{}
+	return &HealthService{
+		timeout: cfg.ReadinessTimeout,
+		cached:  make(map[string]cachedCheck),
+		checks: []healthCheck{
+			{name: CheckDatabase, required: true, check: pingDB},
+			{name: CheckLogsDir, required: true, check: func(context.Context) error {
+				return checkWritableDir(cfg.LogsDir)
+			}},
+			{name: CheckRAG, required: cfg.ChatBackend == BackendRAG, cacheTTL: cfg.ReadinessProbeCache,
+				check: upstreamProbe(probes, probeURL(cfg.RagHealthURL, cfg.RagURL))},
+			{name: CheckSTT, required: true, cacheTTL: cfg.ReadinessProbeCache,
+				check: upstreamProbe(probes, probeURL(cfg.SttHealthURL, cfg.SttURL))},
+		},
+	}
+}
+
+// Readiness runs every check concurrently and reports whether all required
+// checks passed
+func (s *HealthService) Readiness(ctx context.Context) *model.ReadinessResponse {
+	results := make([]model.ReadinessCheck, len(s.checks))
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	response := &model.ReadinessResponse{
+		Status: model.ReadinessReady,
+		Checks: make(map[string]model.ReadinessCheck, len(s.checks)),
+	}
+	for i, check := range s.checks {
+		response.Checks[check.name] = results[i]
+		if results[i].Required && results[i].Status != model.CheckStatusOK {
+			response.Status = model.ReadinessNotReady
+		}
+	}
+	return response
+}
+
+func (s *HealthService) run(ctx context.Context, check healthCheck) model.ReadinessCheck {
+	if check.cacheTTL > 0 {
+		s.mu.Lock()
+		entry, ok := s.cached[check.name]
+		s.mu.Unlock()
+		if ok && time.Since(entry.at) < check.cacheTTL {
+			entry.result.Cached = true
+			return entry.result
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.check(ctx)
+	result := model.ReadinessCheck{
+		Status:    model.CheckStatusOK,
+		Required:  check.required,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = model.CheckStatusFail
+		result.Error = err.Error()
+	}
+
+	if check.cacheTTL > 0 {
+		s.mu.Lock()
+		s.cached[check.name] = cachedCheck{result: result, at: time.Now()}
+		s.mu.Unlock()
+	}
+	return result
+}
+
+// probeURL returns healthURL, or the root of serviceURL when it is empty
+func probeURL(healthURL, serviceURL string) string {
+	if healthURL != "" {
+		return healthURL
+	}
+	u, err := url.Parse(serviceURL)
+	if err != nil || u.Host == "" {
+		return serviceURL
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// upstreamProbe returns a check that the service at probeURL answers. Any
+// response below 500 counts, since the service routes may not accept GET.
+// The probe bypasses the upstream client so it does not trip its circuit
+// breaker.
+func upstreamProbe(client *http.Client, probeURL string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// checkWritableDir creates and removes a file in dir
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New(dir + " is not a directory")
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
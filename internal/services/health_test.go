@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+)
+
+func TestReadinessLogsDir(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	cfg := config.Default()
+	cfg.RagURL = upstream.URL + "/chat"
+	cfg.SttURL = upstream.URL + "/transcribe"
+	cfg.ReadinessProbeCache = 0
+	cfg.LogsDir = filepath.Join(t.TempDir(), "logs")
+	health := NewHealthService(cfg, func(context.Context) error { return nil })
+
+	// Serve creates the directory at startup; until then the check fails
+	got := health.Readiness(context.Background())
+	if got.Status != model.ReadinessNotReady || got.Checks[CheckLogsDir].Status != model.CheckStatusFail {
+		t.Errorf("missing logs dir: %+v", got)
+	}
+
+	if err := os.MkdirAll(cfg.LogsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	got = health.Readiness(context.Background())
+	if got.Status != model.ReadinessReady {
+		t.Errorf("with the logs dir created: %+v", got)
+	}
+	entries, err := os.ReadDir(cfg.LogsDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("probe left files behind: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"unicode/utf8"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+)
+
+// perMessageTokenOverhead approximates the role and separator tokens that
+// chat formats add around every message
+const perMessageTokenOverhead = 4
+
+// historyLimits bounds the history sent to the backend. Zero disables a
+// limit.
+type historyLimits struct {
+	maxMessages int
+	maxTokens   int
+}
+
+// BuildHistory rebuilds the conversation for threadID from storage and
+// appends the new message, so clients only need to send the latest turn.
+func (s *ChatService) BuildHistory(threadID, userID string, message model.GPTMessage) ([]model.GPTMessage, error) {
+	if threadID == "" {
+		return []model.GPTMessage{message}, nil
+	}
+
+	if err := checkThreadAccess(s.conversations, threadID, userID); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.conversations.ListRecentMessages(threadID, s.history.maxMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]model.GPTMessage, 0, len(stored)+1)
+	for _, m := range stored {
+		history = append(history, model.GPTMessage{Role: m.Role, Content: m.Content})
+	}
+	return append(history, message), nil
+}
+
+// trim drops the oldest turns until messages fits within the message and
+// token budgets. Leading system messages and the latest message are always
+// kept.
+func (l historyLimits) trim(messages []model.GPTMessage) []model.GPTMessage {
+	var system []model.GPTMessage
+	for len(messages) > 0 && messages[0].Role == "system" {
+		system = append(system, messages[0])
+		messages = messages[1:]
+	}
+
+	tokens := 0
+	for _, m := range system {
+		tokens += estimateMessageTokens(m)
+	}
+
+	kept := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		cost := estimateMessageTokens(messages[i])
+		if kept > 0 {
+			if l.maxMessages > 0 && len(system)+kept >= l.maxMessages {
+				break
+			}
+			if l.maxTokens > 0 && tokens+cost > l.maxTokens {
+				break
+			}
+		}
+		tokens += cost
+		kept++
+	}
+
+	trimmed := make([]model.GPTMessage, 0, len(system)+kept)
+	trimmed = append(trimmed, system...)
+	return append(trimmed, messages[len(messages)-kept:]...)
+}
+
+// estimateTokens gives a rough token count for text without a tokenizer.
+// Four characters per token is close enough for budgeting across the
+// English and Thai text we handle.
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func estimateMessageTokens(message model.GPTMessage) int {
+	return estimateTokens(message.Content) + perMessageTokenOverhead
+}
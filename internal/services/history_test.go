@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+func TestHistoryTrim(t *testing.T) {
+	msg := func(role, content string) model.GPTMessage {
+		return model.GPTMessage{Role: role, Content: content}
+	}
+	// Each of these costs 2 content tokens plus the per-message overhead
+	system := msg("system", "be kind")
+	turns := []model.GPTMessage{
+		msg("user", "q1 q1 "), msg("assistant", "a1 a1 "),
+		msg("user", "q2 q2 "), msg("assistant", "a2 a2 "),
+		msg("user", "q3 q3 "),
+	}
+	const cost = 2 + perMessageTokenOverhead
+	long := msg("user", strings.Repeat("x", 400))
+
+	for _, tc := range []struct {
+		name     string
+		limits   historyLimits
+		messages []model.GPTMessage
+		want     []string
+	}{
+		{"no limits", historyLimits{}, turns, []string{"q1 q1 ", "a1 a1 ", "q2 q2 ", "a2 a2 ", "q3 q3 "}},
+		{"within both budgets", historyLimits{maxMessages: 5, maxTokens: 5 * cost}, turns,
+			[]string{"q1 q1 ", "a1 a1 ", "q2 q2 ", "a2 a2 ", "q3 q3 "}},
+		{"message budget", historyLimits{maxMessages: 3}, turns, []string{"q2 q2 ", "a2 a2 ", "q3 q3 "}},
+		{"token budget", historyLimits{maxTokens: 2*cost + 1}, turns, []string{"a2 a2 ", "q3 q3 "}},
+		{"tighter budget wins", historyLimits{maxMessages: 4, maxTokens: 2 * cost}, turns, []string{"a2 a2 ", "q3 q3 "}},
+		{"system messages are kept and counted", historyLimits{maxMessages: 3},
+			append([]model.GPTMessage{system}, turns...), []string{"be kind", "a2 a2 ", "q3 q3 "}},
+		{"latest message kept over budget", historyLimits{maxMessages: 1, maxTokens: 10},
+			append(turns[:4:4], long), []string{long.Content}},
+		{"empty", historyLimits{maxMessages: 3}, nil, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.limits.trim(tc.messages)
+			contents := make([]string, len(got))
+			for i, m := range got {
+				contents[i] = m.Content
+			}
+			if strings.Join(contents, "|") != strings.Join(tc.want, "|") {
+				t.Errorf("trim = %q, want %q", contents, tc.want)
+			}
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	for text, want := range map[string]int{
+		"":           0,
+		"a":          1,
+		"abcd":       1,
+		"abcde":      2,
+		"สวัสดีครับ": 3,
+	} {
+		if got := estimateTokens(text); got != want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestBuildHistory(t *testing.T) {
+	conversations := repository.NewConversationRepository(newTestDB(t))
+	const threadID = "thread-1"
+	for i := 1; i <= 6; i++ {
+		role := "user"
+		if i%2 == 0 {
+			role = "assistant"
+		}
+		err := conversations.AppendMessage(&model.Conversation{ID: threadID, UserID: "user-1"},
+			&model.Message{Role: role, Content: fmt.Sprintf("m%d m%d ", i, i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	latest := model.GPTMessage{Role: "user", Content: "m7 m7 "}
+	const cost = 2 + perMessageTokenOverhead
+
+	for _, tc := range []struct {
+		name   string
+		limits historyLimits
+		want   []string
+	}{
+		{"no limits", historyLimits{}, []string{"m1 m1 ", "m2 m2 ", "m3 m3 ", "m4 m4 ", "m5 m5 ", "m6 m6 ", "m7 m7 "}},
+		{"message budget", historyLimits{maxMessages: 3}, []string{"m5 m5 ", "m6 m6 ", "m7 m7 "}},
+		{"token budget", historyLimits{maxTokens: 4 * cost}, []string{"m4 m4 ", "m5 m5 ", "m6 m6 ", "m7 m7 "}},
+		{"both budgets", historyLimits{maxMessages: 5, maxTokens: 2 * cost}, []string{"m6 m6 ", "m7 m7 "}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &ChatService{conversations: conversations, history: tc.limits, ctx: context.Background()}
+			history, err := s.BuildHistory(threadID, "user-1", latest)
+			if err != nil {
+				t.Fatalf("BuildHistory: %v", err)
+			}
+			// The history is trimmed to the budgets before it is sent
+			sent := s.backendRequest(history, threadID).Messages
+			contents := make([]string, len(sent))
+			for i, m := range sent {
+				contents[i] = m.Content
+			}
+			if strings.Join(contents, "|") != strings.Join(tc.want, "|") {
+				t.Errorf("history = %q, want %q", contents, tc.want)
+			}
+		})
+	}
+
+	// Only the owner can continue the thread
+	s := &ChatService{conversations: conversations, ctx: context.Background()}
+	if _, err := s.BuildHistory(threadID, "user-2", latest); err == nil {
+		t.Error("BuildHistory of another user's thread succeeded")
+	}
+}
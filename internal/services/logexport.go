@@ -0,0 +1,83 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+// logExportPageSize is how many conversations ExportLogs loads at a time
+const logExportPageSize = 200
+
+// LogExportStats summarises a run of ExportLogs
+type LogExportStats struct {
+	Exported int
+	Failed   int
+}
+
+// ExportLogs writes every conversation to dir as <threadID>.json in the
+// InterviewLog format, so the files can be read back with ImportLogs. An
+// empty userID exports every user's conversations. Existing files are
+// overwritten.
+func ExportLogs(conversations *repository.ConversationRepository, dir, userID string) (*LogExportStats, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	stats := &LogExportStats{}
+	for offset := 0; ; offset += logExportPageSize {
+		page, err := conversations.ListConversations(userID, offset, logExportPageSize)
+		if err != nil {
+			return stats, err
+		}
+		for i := range page {
+			if err := exportLogFile(conversations, dir, &page[i]); err != nil {
+				slog.Error("Failed to export conversation", "thread_id", page[i].ID, "err", err)
+				stats.Failed++
+				continue
+			}
+			stats.Exported++
+		}
+		if len(page) < logExportPageSize {
+			return stats, nil
+		}
+	}
+}
+
+func exportLogFile(conversations *repository.ConversationRepository, dir string, conversation *model.Conversation) error {
+	messages, err := conversations.ListMessages(conversation.ID)
+	if err != nil {
+		return err
+	}
+
+	interviewLog := InterviewLog{
+		CandidateName: conversation.CandidateName,
+		Position:      conversation.Position,
+		InterviewDate: conversation.InterviewDate,
+		Status:        conversation.Status,
+		Messages:      make([]interface{}, 0, len(messages)),
+	}
+	for _, msg := range messages {
+		interviewLog.Messages = append(interviewLog.Messages, model.GPTMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	data, err := json.MarshalIndent(interviewLog, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, conversation.ID+".json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	// Keep the last activity as the file time; ImportLogs reads it back
+	return os.Chtimes(path, conversation.UpdatedAt, conversation.UpdatedAt)
+}
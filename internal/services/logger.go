@@ -3,8 +3,6 @@ package services
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -21,7 +19,6 @@ type InterviewLog struct {
 
 // extractCandidateName tries to extract a name after "ชื่อ" or "ชื่อคือ" from a message string
 func extractCandidateName(text string) string {
-	fmt.Printf("[DEBUG] extractCandidateName input: %q\n", text)
 	text = strings.TrimSpace(text)
 	// จับชื่อหลัง "ชื่อ" หรือ "ชื่อคือ" หรือ "ชื่อ :" เฉพาะตัวอักษรไทย/อังกฤษและช่องว่าง
 	re := regexp.MustCompile(`(?i)ชื่อ\s*(?:คือ)?\s*[:：]?\s*([ก-๙a-zA-Z]+(?:\s+[ก-๙a-zA-Z]+)*)`)
@@ -30,86 +27,17 @@ func extractCandidateName(text string) string {
 		name := matches[1]
 		// normalize: เหลือ space เดียวระหว่างคำ
 		name = strings.Join(strings.Fields(name), " ")
-		fmt.Printf("[DEBUG] extractCandidateName matched: %q\n", name)
 		return name
 	}
-	fmt.Println("[DEBUG] extractCandidateName: no match")
 	return ""
 }
 
-// AppendMessageToLog appends a message to the thread's log file (as JSON array or InterviewLog)
-func AppendMessageToLog(threadID string, message interface{}) error {
-	logDir := "logs"
-	if _, err := os.Stat(logDir); os.IsNotExist(err) {
-		err := os.Mkdir(logDir, 0755)
-		if err != nil {
-			return err
-		}
-	}
-	logPath := filepath.Join(logDir, threadID+".json")
-	var log InterviewLog
-	if _, err := os.Stat(logPath); err == nil {
-		data, err := os.ReadFile(logPath)
-		if err == nil {
-			// Try to unmarshal as InterviewLog
-			if err := json.Unmarshal(data, &log); err != nil || log.Messages == nil {
-				// Fallback: legacy array of messages
-				var messages []interface{}
-				if err := json.Unmarshal(data, &messages); err == nil {
-					log.Messages = messages
-				}
-			}
-		}
-	}
-	log.Messages = append(log.Messages, message)
-	// ตรวจสอบ candidate_name ถ้ายังไม่มี และ message นี้เป็น user message
-	if log.CandidateName == "" {
-		// debug print message type and content
-		fmt.Printf("[DEBUG] message type: %T, value: %+v\n", message, message)
-		// กรณี message เป็น map[string]interface{}
-		if msgMap, ok := message.(map[string]interface{}); ok {
-			if role, ok := msgMap["role"].(string); ok && role == "user" {
-				if content, ok := msgMap["content"].(string); ok {
-					name := extractCandidateName(content)
-					if name != "" {
-						log.CandidateName = name
-					}
-				}
-			}
-		} else {
-			// กรณี message เป็น struct ที่มี field Content, Role
-			if msgBytes, err := json.Marshal(message); err == nil {
-				var msgStruct struct {
-					Role    string `json:"role"`
-					Content string `json:"content"`
-				}
-				if err := json.Unmarshal(msgBytes, &msgStruct); err == nil {
-					if msgStruct.Role == "user" {
-						name := extractCandidateName(msgStruct.Content)
-						if name != "" {
-							log.CandidateName = name
-						}
-					}
-				}
-			}
-		}
-	}
-	data, err := json.MarshalIndent(log, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(logPath, data, 0644)
-}
-
-// GetLogByThreadID reads the log file for a thread and returns the InterviewLog structure
-func GetLogByThreadID(threadID string) (*InterviewLog, error) {
-	logPath := filepath.Join("logs", threadID+".json")
-	data, err := os.ReadFile(logPath)
-	if err != nil {
-		return nil, err
-	}
+// parseInterviewLog decodes a thread log in either the InterviewLog format or
+// the legacy bare array of messages
+func parseInterviewLog(data []byte) (*InterviewLog, error) {
 	var log InterviewLog
-	if err := json.Unmarshal(data, &log); err == nil && log.Messages != nil {
+	err := json.Unmarshal(data, &log)
+	if err == nil && log.Messages != nil {
 		return &log, nil
 	}
 	// Fallback: legacy array of messages
@@ -117,5 +45,8 @@ func GetLogByThreadID(threadID string) (*InterviewLog, error) {
 	if err := json.Unmarshal(data, &messages); err == nil {
 		return &InterviewLog{Messages: messages}, nil
 	}
+	if err == nil {
+		err = fmt.Errorf("log has no messages")
+	}
 	return nil, err
-}
\ No newline at end of file
+}
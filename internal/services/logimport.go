@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+// LogImportStats summarises a run of ImportLogs
+type LogImportStats struct {
+	Files    int
+	Imported int
+	Skipped  int
+	Failed   int
+}
+
+// ImportLogs loads every <threadID>.json file in dir into the conversations
+// tables. Both the InterviewLog format and the legacy array of messages are
+// understood. Threads that already exist in the database are skipped, so the
+// import can safely be re-run.
+func ImportLogs(conversations *repository.ConversationRepository, dir string) (*LogImportStats, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &LogImportStats{Files: len(paths)}
+	for _, path := range paths {
+		imported, err := importLogFile(conversations, path)
+		switch {
+		case err != nil:
+			slog.Error("Failed to import log file", "path", path, "err", err)
+			stats.Failed++
+		case imported:
+			stats.Imported++
+		default:
+			stats.Skipped++
+		}
+	}
+	return stats, nil
+}
+
+func importLogFile(conversations *repository.ConversationRepository, path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	interviewLog, err := parseInterviewLog(data)
+	if err != nil {
+		return false, err
+	}
+
+	// The files carry no timestamps, so the last write time stands in for
+	// both the conversation and its messages.
+	modTime := info.ModTime()
+	conversation := &model.Conversation{
+		ID:            strings.TrimSuffix(filepath.Base(path), ".json"),
+		CandidateName: interviewLog.CandidateName,
+		Position:      interviewLog.Position,
+		InterviewDate: interviewLog.InterviewDate,
+		Status:        interviewLog.Status,
+		CreatedAt:     modTime,
+		UpdatedAt:     modTime,
+	}
+
+	messages := make([]model.Message, 0, len(interviewLog.Messages))
+	for i, raw := range interviewLog.Messages {
+		msg, err := decodeLogMessage(raw)
+		if err != nil {
+			return false, fmt.Errorf("message %d: %w", i, err)
+		}
+		messages = append(messages, model.Message{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			CreatedAt: modTime,
+		})
+		if conversation.CandidateName == "" && msg.Role == "user" {
+			conversation.CandidateName = extractCandidateName(msg.Content)
+		}
+	}
+
+	return conversations.ImportConversation(conversation, messages)
+}
+
+// decodeLogMessage converts a loosely typed log entry into a GPTMessage
+func decodeLogMessage(raw interface{}) (*model.GPTMessage, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var msg model.GPTMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Role == "" {
+		return nil, fmt.Errorf("missing role")
+	}
+	return &msg, nil
+}
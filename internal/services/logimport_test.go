@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+const (
+	// Thread IDs of the files in testdata/logs
+	interviewLogThread = "aaaaaaaa-aaaa-4aaa-8aaa-aaaaaaaaaaaa"
+	legacyLogThread    = "bbbbbbbb-bbbb-4bbb-8bbb-bbbbbbbbbbbb"
+)
+
+func TestImportLogs(t *testing.T) {
+	conversations := repository.NewConversationRepository(newTestDB(t))
+
+	stats, err := ImportLogs(conversations, "testdata/logs")
+	if err != nil {
+		t.Fatalf("ImportLogs: %v", err)
+	}
+	// The file without roles fails; the README is not a log
+	if *stats != (LogImportStats{Files: 3, Imported: 2, Failed: 1}) {
+		t.Errorf("stats = %+v, want 3 files, 2 imported and 1 failed", *stats)
+	}
+
+	for _, tc := range []struct {
+		thread, candidate, position, status string
+		contents                            []string
+	}{
+		{interviewLogThread, "Somchai Jaidee", "Optometrist", "completed",
+			[]string{"สวัสดีครับ", "สวัสดีครับ มีอะไรให้ช่วยไหมครับ", "ตาพร่ามัวตอนกลางคืน"}},
+		// Legacy logs carry only messages; the name comes from the chat
+		{legacyLogThread, "สมหญิง ใจดี", "", "",
+			[]string{"ชื่อ สมหญิง ใจดี", "ยินดีที่ได้รู้จักครับ"}},
+	} {
+		conversation, err := conversations.GetConversationByIDUnscoped(tc.thread)
+		if err != nil {
+			t.Errorf("%s was not imported: %v", tc.thread, err)
+			continue
+		}
+		if conversation.CandidateName != tc.candidate || conversation.Position != tc.position || conversation.Status != tc.status {
+			t.Errorf("%s = %+v", tc.thread, conversation)
+		}
+		messages, err := conversations.ListMessages(tc.thread)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != len(tc.contents) {
+			t.Fatalf("%s has %d messages, want %d", tc.thread, len(messages), len(tc.contents))
+		}
+		for i, m := range messages {
+			if m.Content != tc.contents[i] {
+				t.Errorf("%s message %d = %q, want %q", tc.thread, i, m.Content, tc.contents[i])
+			}
+		}
+	}
+
+	// Importing again leaves the stored threads alone
+	stats, err = ImportLogs(conversations, "testdata/logs")
+	if err != nil {
+		t.Fatalf("second ImportLogs: %v", err)
+	}
+	if *stats != (LogImportStats{Files: 3, Skipped: 2, Failed: 1}) {
+		t.Errorf("second stats = %+v, want 2 skipped and 1 failed", *stats)
+	}
+	if messages, err := conversations.ListMessages(interviewLogThread); err != nil || len(messages) != 3 {
+		t.Errorf("after the re-import %s has %d messages (%v), want 3", interviewLogThread, len(messages), err)
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+)
+
+// Names of the available payment providers
+const (
+	PaymentProviderFake = "fake"
+	// PaymentProviderNone turns the upgrade flow off
+	PaymentProviderNone = "none"
+)
+
+// Payment webhook event types
+const (
+	PaymentEventCheckoutCompleted    = "checkout.completed"
+	PaymentEventCheckoutFailed       = "checkout.failed"
+	PaymentEventSubscriptionCanceled = "subscription.canceled"
+)
+
+// WebhookSignatureHeader carries the signature of a webhook payload as
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>">"
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// webhookTolerance bounds how old a signed webhook may be, so that captured
+// callbacks cannot be replayed later
+const webhookTolerance = 5 * time.Minute
+
+var (
+	// ErrUnknownPaymentProvider is returned when a provider name is not recognised
+	ErrUnknownPaymentProvider = errors.New("unknown payment provider")
+	// ErrPaymentsDisabled is returned by the upgrade flow when no payment
+	// provider is configured
+	ErrPaymentsDisabled = errors.New("payments are disabled")
+	// ErrInvalidWebhookSignature is returned for webhooks that are unsigned,
+	// wrongly signed or too old
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// PaymentProvider takes payments for subscriptions and reports their outcome
+// through signed webhook callbacks
+type PaymentProvider interface {
+	// Name returns the provider name, e.g. "fake"
+	Name() string
+	// CreateCheckoutSession starts a payment and returns where to send the
+	// user to complete it
+	CreateCheckoutSession(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error)
+	// CancelSubscription stops renewing a subscription
+	CancelSubscription(ctx context.Context, providerSubscriptionID string) error
+	// VerifyWebhook checks a webhook's signature and decodes its event
+	VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error)
+}
+
+// CheckoutRequest describes the subscription being paid for
+type CheckoutRequest struct {
+	// SubscriptionID is our subscription ID; providers echo it in webhooks
+	SubscriptionID string
+	UserID         string
+	PlanID         string
+	AmountCents    int64
+	Currency       string
+}
+
+// CheckoutSession is a started payment
+type CheckoutSession struct {
+	ID  string
+	URL string
+}
+
+// PaymentEvent is a decoded webhook callback
+type PaymentEvent struct {
+	ID                     string     `json:"id"`
+	Type                   string     `json:"type"`
+	CreatedAt              time.Time  `json:"created_at"`
+	SessionID              string     `json:"session_id,omitempty"`
+	SubscriptionID         string     `json:"subscription_id,omitempty"`
+	ProviderSubscriptionID string     `json:"provider_subscription_id,omitempty"`
+	PeriodEnd              *time.Time `json:"period_end,omitempty"`
+}
+
+// NewPaymentProvider returns the provider configured in cfg, or nil when
+// payments are disabled
+func NewPaymentProvider(cfg *config.Config) (PaymentProvider, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.PaymentProvider)) {
+	case PaymentProviderFake:
+		return NewFakePaymentProvider(cfg.PaymentWebhookSecret, cfg.PaymentWebhookURL), nil
+	case PaymentProviderNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownPaymentProvider, cfg.PaymentProvider)
+}
+
+// SignWebhook returns the WebhookSignatureHeader value for payload
+func SignWebhook(secret string, payload []byte, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + webhookMAC(secret, t, payload)
+}
+
+// VerifyWebhookSignature checks a WebhookSignatureHeader value against
+// payload
+func VerifyWebhookSignature(secret string, payload []byte, signature string, now time.Time) error {
+	var t, v1 string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+	if t == "" || v1 == "" {
+		return ErrInvalidWebhookSignature
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidWebhookSignature)
+	}
+
+	if !hmac.Equal([]byte(v1), []byte(webhookMAC(secret, t, payload))) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+func webhookMAC(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeCheckoutPath is where the fake provider's checkout pages are served
+const FakeCheckoutPath = "/api/public/upgrade/fake-checkout/"
+
+// fakeBillingPeriod is the length of a fake subscription period
+const fakeBillingPeriod = 30 * 24 * time.Hour
+
+// ErrCheckoutSessionNotFound is returned for unknown checkout sessions
+var ErrCheckoutSessionNotFound = errors.New("checkout session not found")
+
+// FakePaymentProvider is a local stand-in for a real payment provider. It
+// takes no money: completing a checkout page sends the same kind of signed
+// webhook callback a real provider would, so the whole upgrade flow can be
+// exercised in development and tests.
+type FakePaymentProvider struct {
+	secret     string
+	webhookURL string
+	client     *http.Client
+
+	mu       sync.Mutex
+	sessions map[string]*CheckoutRequest
+}
+
+// NewFakePaymentProvider creates a fake provider that signs webhooks with
+// secret and posts them to webhookURL
+func NewFakePaymentProvider(secret, webhookURL string) *FakePaymentProvider {
+	return &FakePaymentProvider{
+		secret:     secret,
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		sessions:   make(map[string]*CheckoutRequest),
+	}
+}
+
+// Name implements PaymentProvider
+func (p *FakePaymentProvider) Name() string {
+	return PaymentProviderFake
+}
+
+// CreateCheckoutSession implements PaymentProvider. The returned URL points
+// at the fake checkout page served by this API.
+func (p *FakePaymentProvider) CreateCheckoutSession(ctx context.Context, req *CheckoutRequest) (*CheckoutSession, error) {
+	sessionID := "cs_fake_" + uuid.New().String()
+
+	p.mu.Lock()
+	p.sessions[sessionID] = req
+	p.mu.Unlock()
+
+	return &CheckoutSession{
+		ID:  sessionID,
+		URL: FakeCheckoutPath + sessionID,
+	}, nil
+}
+
+// CompleteCheckout plays userID paying (or failing to pay) on the checkout
+// page and delivers the resulting webhook. Sessions started by other users
+// are reported as not found.
+func (p *FakePaymentProvider) CompleteCheckout(ctx context.Context, sessionID, userID string, succeed bool) error {
+	p.mu.Lock()
+	req, ok := p.sessions[sessionID]
+	if ok && req.UserID == userID {
+		delete(p.sessions, sessionID)
+	}
+	p.mu.Unlock()
+	if !ok || req.UserID != userID {
+		return ErrCheckoutSessionNotFound
+	}
+
+	event := &PaymentEvent{
+		ID:             "evt_fake_" + uuid.New().String(),
+		Type:           PaymentEventCheckoutFailed,
+		CreatedAt:      time.Now(),
+		SessionID:      sessionID,
+		SubscriptionID: req.SubscriptionID,
+	}
+	if succeed {
+		periodEnd := event.CreatedAt.Add(fakeBillingPeriod)
+		event.Type = PaymentEventCheckoutCompleted
+		event.ProviderSubscriptionID = "sub_fake_" + uuid.New().String()
+		event.PeriodEnd = &periodEnd
+	}
+	return p.deliver(ctx, event)
+}
+
+// CancelSubscription implements PaymentProvider. The cancellation webhook is
+// delivered in the background, as a real provider would.
+func (p *FakePaymentProvider) CancelSubscription(ctx context.Context, providerSubscriptionID string) error {
+	event := &PaymentEvent{
+		ID:                     "evt_fake_" + uuid.New().String(),
+		Type:                   PaymentEventSubscriptionCanceled,
+		CreatedAt:              time.Now(),
+		ProviderSubscriptionID: providerSubscriptionID,
+	}
+	goBackground(func() {
+		if err := p.deliver(context.Background(), event); err != nil {
+			slog.Error("Failed to deliver fake webhook", "type", event.Type, "err", err)
+		}
+	})
+	return nil
+}
+
+// VerifyWebhook implements PaymentProvider
+func (p *FakePaymentProvider) VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error) {
+	if err := VerifyWebhookSignature(p.secret, payload, header.Get(WebhookSignatureHeader), time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	return &event, nil
+}
+
+// deliver posts a signed event to the webhook URL
+func (p *FakePaymentProvider) deliver(ctx context.Context, event *PaymentEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(p.secret, payload, time.Now()))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook rejected (status %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	const secret = "webhook-secret"
+	payload := []byte(`{"id":"evt_1","type":"checkout.completed"}`)
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	if err := VerifyWebhookSignature(secret, payload, SignWebhook(secret, payload, now), now); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	// Within the tolerance either way
+	if err := VerifyWebhookSignature(secret, payload, SignWebhook(secret, payload, now.Add(-4*time.Minute)), now); err != nil {
+		t.Errorf("4 minute old signature rejected: %v", err)
+	}
+
+	for name, signature := range map[string]string{
+		"missing":                 "",
+		"no v1":                   "t=" + ts,
+		"no t":                    "v1=" + webhookMAC(secret, ts, payload),
+		"non-numeric t":           "t=yesterday,v1=" + webhookMAC(secret, "yesterday", payload),
+		"expired t":               SignWebhook(secret, payload, now.Add(-6*time.Minute)),
+		"future t":                SignWebhook(secret, payload, now.Add(6*time.Minute)),
+		"wrong v1":                "t=" + ts + ",v1=" + webhookMAC(secret, ts, []byte(`{"id":"evt_2"}`)),
+		"wrong secret":            SignWebhook("another-secret", payload, now),
+		"t changed after signing": "t=" + strconv.FormatInt(now.Unix()+1, 10) + ",v1=" + webhookMAC(secret, ts, payload),
+	} {
+		err := VerifyWebhookSignature(secret, payload, signature, now)
+		if !errors.Is(err, ErrInvalidWebhookSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidWebhookSignature", name, err)
+		}
+	}
+
+	// A valid signature does not cover a modified payload
+	signature := SignWebhook(secret, payload, now)
+	if err := VerifyWebhookSignature(secret, []byte(`{"id":"evt_1","type":"checkout.failed"}`), signature, now); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("tampered payload: err = %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/cache"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Plan IDs. The guest plan applies to callers who are not logged in.
+const (
+	PlanGuest    = "guest"
+	PlanFree     = "free"
+	PlanPremium  = "premium"
+	PlanClinic   = "clinic"
+	PlanInternal = "internal"
+)
+
+// Route groups that plans set limits for
+const (
+	RouteGroupChat = "chat"
+	RouteGroupSTT  = "stt"
+)
+
+// Quota metrics and windows
+const (
+	QuotaMessages   = "messages"
+	QuotaTokens     = "tokens"
+	QuotaSTTMinutes = "stt_minutes"
+
+	QuotaDay   = "day"
+	QuotaMonth = "month"
+)
+
+// quotaUsageSTTSeconds is the metric STT usage is stored under
+const quotaUsageSTTSeconds = "stt_seconds"
+
+// ErrPlanNotFound is returned when a plan ID does not exist
+var ErrPlanNotFound = errors.New("plan not found")
+
+// defaultPlans is the catalog created on first start. After that the plans
+// live in the database and can be tuned there without a deploy.
+var defaultPlans = []model.Plan{
+	{
+		ID:          PlanGuest,
+		Name:        "Guest",
+		Description: "Demo access for visitors who are not signed in",
+		Rank:        0,
+		Limits: []model.PlanLimit{
+			{RouteGroup: RouteGroupChat, RequestsPerMinute: 3, Burst: 2, DailyMessages: 20, DailyTokens: 20000},
+			{RouteGroup: RouteGroupSTT, RequestsPerMinute: 3, Burst: 2, DailyMessages: 10, DailySTTMinutes: 5},
+		},
+	},
+	{
+		ID:          PlanFree,
+		Name:        "Free",
+		Description: "Basic access for registered users",
+		Rank:        10,
+		Limits: []model.PlanLimit{
+			{RouteGroup: RouteGroupChat, RequestsPerMinute: 10, Burst: 5, DailyMessages: 50, MonthlyMessages: 500, MonthlyTokens: 500000},
+			{RouteGroup: RouteGroupSTT, RequestsPerMinute: 10, Burst: 5, DailySTTMinutes: 10, MonthlySTTMinutes: 60},
+		},
+	},
+	{
+		ID:          PlanPremium,
+		Name:        "Premium",
+		Description: "Higher limits for individual practitioners",
+		Rank:        20,
+		PriceCents:  29900,
+		Currency:    "THB",
+		Limits: []model.PlanLimit{
+			{RouteGroup: RouteGroupChat, RequestsPerMinute: 60, Burst: 20, DailyMessages: 1000},
+			{RouteGroup: RouteGroupSTT, RequestsPerMinute: 30, Burst: 10, DailySTTMinutes: 120, MonthlySTTMinutes: 1200},
+		},
+	},
+	{
+		ID:          PlanClinic,
+		Name:        "Clinic",
+		Description: "Shared capacity for clinics and their staff",
+		Rank:        30,
+		PriceCents:  199000,
+		Currency:    "THB",
+		Limits: []model.PlanLimit{
+			{RouteGroup: RouteGroupChat, RequestsPerMinute: 120, Burst: 40},
+			{RouteGroup: RouteGroupSTT, RequestsPerMinute: 60, Burst: 20, MonthlySTTMinutes: 6000},
+		},
+	},
+	{
+		ID:          PlanInternal,
+		Name:        "Internal",
+		Description: "Unlimited access for staff and service accounts",
+		Rank:        100,
+	},
+}
+
+// defaultPlanForRole returns the plan of users without an assigned plan
+func defaultPlanForRole(role string) string {
+	if role == RoleAdmin {
+		return PlanInternal
+	}
+	return PlanFree
+}
+
+// PlanService resolves the plan that applies to a caller and tracks quota
+// usage. Plans and assignments are cached briefly so the rate limiter does
+// not query the database on every request.
+type PlanService struct {
+	plans       *repository.PlanRepository
+	planCache   *cache.LRU[*model.Plan]
+	assignments *cache.LRU[string]
+}
+
+// planCacheTTL bounds how long other replicas keep serving a changed plan
+const planCacheTTL = 30 * time.Second
+
+func NewPlanService(plans *repository.PlanRepository) *PlanService {
+	return &PlanService{
+		plans:       plans,
+		planCache:   cache.NewLRU[*model.Plan](0, planCacheTTL),
+		assignments: cache.NewLRU[string](10000, planCacheTTL),
+	}
+}
+
+// SeedPlans creates the default plans that are missing from the database
+func (s *PlanService) SeedPlans() error {
+	for _, plan := range defaultPlans {
+		plan := plan
+		plan.Limits = append([]model.PlanLimit(nil), plan.Limits...)
+		created, err := s.plans.CreatePlanIfMissing(&plan)
+		if err != nil {
+			return fmt.Errorf("failed to seed plan %s: %w", plan.ID, err)
+		}
+		if created {
+			slog.Info("Created default plan", "plan_id", plan.ID)
+		}
+	}
+	return nil
+}
+
+// ListPlans returns every plan, least restricted last
+func (s *PlanService) ListPlans() ([]model.Plan, error) {
+	return s.plans.ListPlans()
+}
+
+// GetPlan returns a plan with its limits
+func (s *PlanService) GetPlan(planID string) (*model.Plan, error) {
+	if plan, ok := s.planCache.Get(planID); ok {
+		return plan, nil
+	}
+
+	plan, err := s.plans.GetPlanByID(planID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %q", ErrPlanNotFound, planID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.planCache.Set(planID, plan)
+	return plan, nil
+}
+
+// PlanForUser returns the plan assigned to a user, or the default plan for
+// their role if none is assigned
+func (s *PlanService) PlanForUser(userID, role string) (*model.Plan, error) {
+	cacheKey := userID + "|" + role
+	planID, ok := s.assignments.Get(cacheKey)
+	if !ok {
+		var err error
+		planID, err = s.plans.GetUserPlanID(userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			planID = defaultPlanForRole(role)
+		} else if err != nil {
+			return nil, err
+		}
+		s.assignments.Set(cacheKey, planID)
+	}
+	return s.GetPlan(planID)
+}
+
+// GuestPlan returns the plan for callers who are not logged in
+func (s *PlanService) GuestPlan() (*model.Plan, error) {
+	return s.GetPlan(PlanGuest)
+}
+
+// AssignPlan moves a user to another plan. The change applies to the
+// user's next request on this replica.
+func (s *PlanService) AssignPlan(userID, planID string) error {
+	if _, err := s.GetPlan(planID); err != nil {
+		return err
+	}
+	if err := s.plans.AssignPlan(userID, planID); err != nil {
+		return err
+	}
+	s.forgetAssignment(userID)
+	return nil
+}
+
+// ReleasePlan removes a user's assignment to planID so their role's default
+// applies again. An assignment to another plan is left alone, and false is
+// returned.
+func (s *PlanService) ReleasePlan(userID, planID string) (bool, error) {
+	released, err := s.plans.DeletePlanAssignmentIf(userID, planID)
+	if err != nil {
+		return false, err
+	}
+	s.forgetAssignment(userID)
+	return released, nil
+}
+
+func (s *PlanService) forgetAssignment(userID string) {
+	s.assignments.DeleteFunc(func(key, _ string) bool {
+		return strings.HasPrefix(key, userID+"|")
+	})
+}
+
+// PlanLimit returns a plan's limits for a route group, or nil if the route
+// group is unlimited on that plan
+func PlanLimit(plan *model.Plan, routeGroup string) *model.PlanLimit {
+	for i := range plan.Limits {
+		if plan.Limits[i].RouteGroup == routeGroup {
+			return &plan.Limits[i]
+		}
+	}
+	return nil
+}
+
+// Quotas returns the daily and monthly quotas a limit sets, with how much of
+// each subject has used
+func (s *PlanService) Quotas(subject, routeGroup string, limit *model.PlanLimit, now time.Time) ([]model.Quota, error) {
+	day, month := quotaPeriods(now)
+	windows := []struct {
+		metric, usageMetric, window, period string
+		limit, scale                        float64
+		reset                               time.Time
+	}{
+		{QuotaMessages, QuotaMessages, QuotaDay, day, float64(limit.DailyMessages), 1, nextDay(now)},
+		{QuotaMessages, QuotaMessages, QuotaMonth, month, float64(limit.MonthlyMessages), 1, nextMonth(now)},
+		{QuotaTokens, QuotaTokens, QuotaDay, day, float64(limit.DailyTokens), 1, nextDay(now)},
+		{QuotaTokens, QuotaTokens, QuotaMonth, month, float64(limit.MonthlyTokens), 1, nextMonth(now)},
+		{QuotaSTTMinutes, quotaUsageSTTSeconds, QuotaDay, day, limit.DailySTTMinutes, 60, nextDay(now)},
+		{QuotaSTTMinutes, quotaUsageSTTSeconds, QuotaMonth, month, limit.MonthlySTTMinutes, 60, nextMonth(now)},
+	}
+
+	var quotas []model.Quota
+	for _, w := range windows {
+		if w.limit <= 0 {
+			continue
+		}
+		used, err := s.plans.GetQuotaUsage(subject, routeGroup, w.usageMetric, w.period)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, model.Quota{
+			Metric: w.metric,
+			Window: w.window,
+			Limit:  w.limit,
+			Used:   used / w.scale,
+			Reset:  w.reset,
+		})
+	}
+	return quotas, nil
+}
+
+// ReserveMessage counts a request against the daily and monthly message
+// quotas limit sets, unless either of them is used up, and reports whether
+// it did. The quotas are checked and counted in one step, so concurrent
+// requests cannot together go over them.
+func (s *PlanService) ReserveMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) (bool, error) {
+	if limit.DailyMessages <= 0 && limit.MonthlyMessages <= 0 {
+		return true, nil
+	}
+	day, month := quotaPeriods(now)
+	return s.plans.ReserveQuotaUsage(subject, routeGroup, QuotaMessages, 1, map[string]float64{
+		day:   float64(limit.DailyMessages),
+		month: float64(limit.MonthlyMessages),
+	})
+}
+
+// ReleaseMessage gives back a message reserved with ReserveMessage for a
+// request that was not served
+func (s *PlanService) ReleaseMessage(subject, routeGroup string, limit *model.PlanLimit, now time.Time) error {
+	if limit.DailyMessages <= 0 && limit.MonthlyMessages <= 0 {
+		return nil
+	}
+	day, month := quotaPeriods(now)
+	return s.plans.AddQuotaUsage(subject, routeGroup, QuotaMessages, -1, day, month)
+}
+
+// RecordUsage counts the tokens a served request used and the seconds of
+// audio it transcribed against the quotas that limit sets. The request
+// itself was counted by ReserveMessage.
+func (s *PlanService) RecordUsage(subject, routeGroup string, limit *model.PlanLimit, tokens int, audioSeconds float64, now time.Time) error {
+	day, month := quotaPeriods(now)
+	if tokens > 0 && (limit.DailyTokens > 0 || limit.MonthlyTokens > 0) {
+		if err := s.plans.AddQuotaUsage(subject, routeGroup, QuotaTokens, float64(tokens), day, month); err != nil {
+			return err
+		}
+	}
+	if audioSeconds > 0 && (limit.DailySTTMinutes > 0 || limit.MonthlySTTMinutes > 0) {
+		if err := s.plans.AddQuotaUsage(subject, routeGroup, quotaUsageSTTSeconds, audioSeconds, day, month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserQuotaSubject is the subject a signed-in user's quota usage is counted
+// under
+func UserQuotaSubject(userID string) string {
+	return "user:" + userID
+}
+
+// GuestQuotaSubject is the subject an anonymous caller's quota usage is
+// counted under. Their demo threads belong to it too.
+func GuestQuotaSubject(clientIP string) string {
+	return "guest:" + clientIP
+}
+
+// quotaPeriods returns the UTC day and month that now falls in
+func quotaPeriods(now time.Time) (day, month string) {
+	now = now.UTC()
+	return now.Format("2006-01-02"), now.Format("2006-01")
+}
+
+func nextDay(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextMonth(now time.Time) time.Time {
+	y, m, _ := now.UTC().Date()
+	return time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+func TestReserveMessage(t *testing.T) {
+	plans := NewPlanService(repository.NewPlanRepository(newTestDB(t)))
+	limit := &model.PlanLimit{RouteGroup: RouteGroupChat, DailyMessages: 3, MonthlyMessages: 5}
+	subject := UserQuotaSubject("user-1")
+	day1 := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	reserve := func(now time.Time, n int) int {
+		t.Helper()
+		var reserved atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := plans.ReserveMessage(subject, RouteGroupChat, limit, now)
+				if err != nil {
+					t.Errorf("ReserveMessage: %v", err)
+				}
+				if ok {
+					reserved.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		return int(reserved.Load())
+	}
+
+	// Concurrent requests get no more than the daily quota
+	if n := reserve(day1, 10); n != 3 {
+		t.Errorf("reserved %d messages on day 1, want 3", n)
+	}
+	// A released message can be taken again
+	if err := plans.ReleaseMessage(subject, RouteGroupChat, limit, day1); err != nil {
+		t.Fatalf("ReleaseMessage: %v", err)
+	}
+	if n := reserve(day1, 2); n != 1 {
+		t.Errorf("reserved %d messages after a release, want 1", n)
+	}
+	// The next day only the rest of the monthly quota is left
+	if n := reserve(day1.Add(24*time.Hour), 10); n != 2 {
+		t.Errorf("reserved %d messages on day 2, want the 2 left this month", n)
+	}
+
+	quotas, err := plans.Quotas(subject, RouteGroupChat, limit, day1.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range quotas {
+		if want := map[string]float64{QuotaDay: 2, QuotaMonth: 5}[q.Window]; q.Used != want {
+			t.Errorf("%s %s used = %v, want %v", q.Window, q.Metric, q.Used, want)
+		}
+	}
+
+	// Unlimited route groups are not counted
+	if ok, err := plans.ReserveMessage(subject, RouteGroupSTT, &model.PlanLimit{RouteGroup: RouteGroupSTT}, day1); !ok || err != nil {
+		t.Errorf("ReserveMessage without a message quota = %v, %v", ok, err)
+	}
+}
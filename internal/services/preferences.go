@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/cache"
+	"github.com/EyeQuila/eyeQcheck/internal/i18n"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Theme preferences
+const (
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+	ThemeSystem = "system"
+)
+
+var (
+	// ErrUnsupportedLanguage is returned when setting a language that is not
+	// in i18n.Languages
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+	// ErrInvalidTheme is returned when setting a theme other than light, dark
+	// or system
+	ErrInvalidTheme = errors.New("invalid theme")
+)
+
+// PreferenceService reads and updates user preferences. Users' languages
+// are cached briefly because every request that writes an error or calls
+// the chat and STT services looks them up.
+type PreferenceService struct {
+	users     *repository.UserRepository
+	languages *cache.LRU[string]
+}
+
+// languageCacheTTL bounds how long other replicas keep using a changed
+// language
+const languageCacheTTL = 30 * time.Second
+
+func NewPreferenceService(users *repository.UserRepository) *PreferenceService {
+	return &PreferenceService{
+		users:     users,
+		languages: cache.NewLRU[string](10000, languageCacheTTL),
+	}
+}
+
+// GetPreferences returns a user's preferences. Registered users without
+// stored preferences get the defaults.
+func (s *PreferenceService) GetPreferences(userID string) (*model.UserPreferences, error) {
+	preferences, err := s.users.GetUserPreferences(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if _, err := s.users.GetUserByID(userID); errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		preferences = defaultUserPreferences()
+		preferences.UserID = userID
+		return preferences, nil
+	}
+	return preferences, err
+}
+
+// UpdatePreferences validates and applies a partial update of a user's
+// preferences
+func (s *PreferenceService) UpdatePreferences(userID string, req *model.UpdatePreferencesRequest) (*model.UserPreferences, error) {
+	if req.Language != nil && !i18n.IsSupported(*req.Language) {
+		return nil, ErrUnsupportedLanguage
+	}
+	if req.ThemePreference != nil && !validTheme(*req.ThemePreference) {
+		return nil, ErrInvalidTheme
+	}
+
+	preferences, err := s.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Language != nil {
+		preferences.Language = *req.Language
+	}
+	if req.NotificationsEmail != nil {
+		preferences.NotificationsEmail = *req.NotificationsEmail
+	}
+	if req.NotificationsPush != nil {
+		preferences.NotificationsPush = *req.NotificationsPush
+	}
+	if req.ThemePreference != nil {
+		preferences.ThemePreference = *req.ThemePreference
+	}
+
+	if err := s.users.SaveUserPreferences(preferences); err != nil {
+		return nil, err
+	}
+	s.languages.Delete(userID)
+	return preferences, nil
+}
+
+// Language returns the language a user has chosen, or "" for unknown users
+// and when the lookup fails
+func (s *PreferenceService) Language(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if lang, ok := s.languages.Get(userID); ok {
+		return lang
+	}
+
+	lang := ""
+	preferences, err := s.users.GetUserPreferences(userID)
+	switch {
+	case err == nil:
+		lang = preferences.Language
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		slog.Error("Failed to load language", "user_id", userID, "err", err)
+		return ""
+	}
+	s.languages.Set(userID, lang)
+	return lang
+}
+
+// LanguageFor returns the language to answer a request in: the user's
+// chosen language, else the first supported language in the Accept-Language
+// header, else ""
+func (s *PreferenceService) LanguageFor(userID, acceptLanguage string) string {
+	if lang := s.Language(userID); lang != "" {
+		return lang
+	}
+	return i18n.Negotiate(acceptLanguage)
+}
+
+func validTheme(theme string) bool {
+	switch theme {
+	case ThemeLight, ThemeDark, ThemeSystem:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/i18n"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+func newTestPreferences(t *testing.T) *PreferenceService {
+	t.Helper()
+	db := newTestDB(t)
+	if err := db.Create(&model.User{ID: "user-1", Email: "one@example.com", IsActive: true}).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return NewPreferenceService(repository.NewUserRepository(db))
+}
+
+func TestPreferencesDefaults(t *testing.T) {
+	preferences := newTestPreferences(t)
+
+	got, err := preferences.GetPreferences("user-1")
+	if err != nil {
+		t.Fatalf("GetPreferences: %v", err)
+	}
+	if got.UserID != "user-1" || got.Language != i18n.DefaultLanguage || got.ThemePreference != ThemeLight || !got.NotificationsEmail {
+		t.Errorf("defaults = %+v", got)
+	}
+	if _, err := preferences.GetPreferences("user-2"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetPreferences of an unknown user: err = %v, want ErrUserNotFound", err)
+	}
+
+	// Language is only what the user chose; the caller falls back to the
+	// request's Accept-Language
+	if lang := preferences.Language("user-1"); lang != "" {
+		t.Errorf("Language without stored preferences = %q, want none", lang)
+	}
+	if lang := preferences.LanguageFor("user-1", "en-US,th;q=0.8"); lang != i18n.English {
+		t.Errorf("LanguageFor = %q, want %q from Accept-Language", lang, i18n.English)
+	}
+}
+
+func TestPreferencesUpdate(t *testing.T) {
+	preferences := newTestPreferences(t)
+	ptr := func(s string) *string { return &s }
+	off := false
+
+	// Warm the language cache, which the update must not leave stale
+	preferences.Language("user-1")
+
+	got, err := preferences.UpdatePreferences("user-1", &model.UpdatePreferencesRequest{
+		Language:          ptr(i18n.English),
+		NotificationsPush: &off,
+	})
+	if err != nil {
+		t.Fatalf("UpdatePreferences: %v", err)
+	}
+	if got.Language != i18n.English || got.NotificationsPush || !got.NotificationsEmail || got.ThemePreference != ThemeLight {
+		t.Errorf("after update = %+v; want English without push, other fields unchanged", got)
+	}
+	stored, err := preferences.GetPreferences("user-1")
+	if err != nil || stored.Language != i18n.English || stored.NotificationsPush {
+		t.Errorf("stored = %+v, %v; want the update persisted", stored, err)
+	}
+	if lang := preferences.LanguageFor("user-1", "th"); lang != i18n.English {
+		t.Errorf("LanguageFor after update = %q, want the chosen %q over Accept-Language", lang, i18n.English)
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  *model.UpdatePreferencesRequest
+		want error
+	}{
+		{"unsupported language", &model.UpdatePreferencesRequest{Language: ptr("fr")}, ErrUnsupportedLanguage},
+		{"language tag", &model.UpdatePreferencesRequest{Language: ptr("en-US")}, ErrUnsupportedLanguage},
+		{"empty language", &model.UpdatePreferencesRequest{Language: ptr("")}, ErrUnsupportedLanguage},
+		{"invalid theme", &model.UpdatePreferencesRequest{ThemePreference: ptr("blue")}, ErrInvalidTheme},
+	} {
+		if _, err := preferences.UpdatePreferences("user-1", tc.req); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	// Rejected updates change nothing
+	if lang := preferences.Language("user-1"); lang != i18n.English {
+		t.Errorf("Language after rejected updates = %q, want %q", lang, i18n.English)
+	}
+
+	if _, err := preferences.UpdatePreferences("user-2", &model.UpdatePreferencesRequest{Language: ptr(i18n.Thai)}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdatePreferences of an unknown user: err = %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+// demoUser is a user created by SeedDemoData
+type demoUser struct {
+	ID     string
+	Email  string
+	Name   string
+	Role   string
+	PlanID string
+}
+
+// demoUsers cover each kind of caller: an admin, a paying user and a free
+// user. Their IDs are stable so tokens minted for them keep working after a
+// re-seed.
+var demoUsers = []demoUser{
+	{ID: "demo-admin", Email: "admin@demo.eyeqcheck.local", Name: "Demo Admin", Role: RoleAdmin},
+	{ID: "demo-premium", Email: "premium@demo.eyeqcheck.local", Name: "Demo Premium", Role: RoleUser, PlanID: PlanPremium},
+	{ID: "demo-free", Email: "free@demo.eyeqcheck.local", Name: "Demo Free", Role: RoleUser},
+}
+
+// demoConversation is a fixture conversation created by SeedDemoData
+type demoConversation struct {
+	ID       string
+	UserID   string
+	Title    string
+	Messages []model.GPTMessage
+}
+
+var demoConversations = []demoConversation{
+	{
+		ID:     "6f1c2d8e-4b7a-4c3e-9a51-0d2e7f3b9c01",
+		UserID: "demo-free",
+		Title:  "ตาแห้งตอนเช้า",
+		Messages: []model.GPTMessage{
+			{Role: "user", Content: "สวัสดีครับ ชื่อสมชาย ตื่นมาตอนเช้าแล้วรู้สึกตาแห้งและแสบตาครับ"},
+			{Role: "assistant", Content: "สวัสดีครับคุณสมชาย อาการตาแห้งตอนเช้าพบได้บ่อย เป็นมานานเท่าไรแล้ว และใช้คอนแทคเลนส์หรือไม่ครับ"},
+			{Role: "user", Content: "ประมาณสองสัปดาห์ครับ ไม่ได้ใส่คอนแทคเลนส์"},
+			{Role: "assistant", Content: "ลองใช้น้ำตาเทียมวันละ 3-4 ครั้งและพักสายตาจากหน้าจอทุก 20 นาที หากอาการไม่ดีขึ้นใน 1 สัปดาห์ควรพบจักษุแพทย์ครับ"},
+		},
+	},
+	{
+		ID:     "9a3e5b71-2c84-4f0d-8e6a-5b1d3c7e2f02",
+		UserID: "demo-premium",
+		Title:  "Blurry vision when reading",
+		Messages: []model.GPTMessage{
+			{Role: "user", Content: "Hi, my name is Jane. Text has become blurry when I read up close."},
+			{Role: "assistant", Content: "Thanks, Jane. How old are you, and is distance vision still clear?"},
+			{Role: "user", Content: "I'm 46 and distance is fine."},
+			{Role: "assistant", Content: "That pattern is typical of presbyopia. A refraction exam can confirm it and determine a reading prescription."},
+		},
+	},
+	{
+		ID:     "c2d4f6a8-1e3b-4d5f-a7c9-e1b3d5f7a903",
+		UserID: "demo-premium",
+		Title:  "Red eye follow-up",
+		Messages: []model.GPTMessage{
+			{Role: "user", Content: "My left eye has been red since yesterday but it doesn't hurt."},
+			{Role: "assistant", Content: "Is there any discharge, light sensitivity or change in vision?"},
+		},
+	},
+}
+
+// SeedStats summarises a run of SeedDemoData
+type SeedStats struct {
+	Users         int
+	Conversations int
+}
+
+// SeedDemoData creates the default plans, the demo users and their fixture
+// conversations. Demo users are updated in place and existing conversations
+// are kept, so it can be re-run.
+func SeedDemoData(users *UserService, plans *PlanService, conversations *repository.ConversationRepository) (*SeedStats, error) {
+	if err := plans.SeedPlans(); err != nil {
+		return nil, err
+	}
+
+	stats := &SeedStats{}
+	for _, demo := range demoUsers {
+		_, created, err := users.RegisterOrUpdateUser(demo.ID, demo.Email, demo.Name, "", "", demo.Role)
+		if err != nil {
+			return stats, fmt.Errorf("failed to seed user %s: %w", demo.ID, err)
+		}
+		if created {
+			stats.Users++
+		}
+		if demo.PlanID != "" {
+			if err := plans.AssignPlan(demo.ID, demo.PlanID); err != nil {
+				return stats, fmt.Errorf("failed to assign plan %s to %s: %w", demo.PlanID, demo.ID, err)
+			}
+		}
+	}
+
+	start := time.Now().Add(-24 * time.Hour)
+	for _, demo := range demoConversations {
+		conversation := &model.Conversation{
+			ID:        demo.ID,
+			UserID:    demo.UserID,
+			Title:     demo.Title,
+			CreatedAt: start,
+			UpdatedAt: start.Add(time.Duration(len(demo.Messages)) * time.Minute),
+		}
+		messages := make([]model.Message, 0, len(demo.Messages))
+		for i, msg := range demo.Messages {
+			messages = append(messages, model.Message{
+				Role:      msg.Role,
+				Content:   msg.Content,
+				CreatedAt: start.Add(time.Duration(i+1) * time.Minute),
+			})
+			if conversation.CandidateName == "" && msg.Role == "user" {
+				conversation.CandidateName = extractCandidateName(msg.Content)
+			}
+		}
+
+		imported, err := conversations.ImportConversation(conversation, messages)
+		if err != nil {
+			return stats, fmt.Errorf("failed to seed conversation %s: %w", demo.ID, err)
+		}
+		if imported {
+			stats.Conversations++
+		}
+	}
+
+	slog.Info("Seeded demo data", "users", stats.Users, "conversations", stats.Conversations)
+	return stats, nil
+}
+
+// DemoUserIDs lists the IDs of the users created by SeedDemoData
+func DemoUserIDs() []string {
+	ids := make([]string, 0, len(demoUsers))
+	for _, demo := range demoUsers {
+		ids = append(ids, demo.ID)
+	}
+	return ids
+}
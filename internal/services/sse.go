@@ -0,0 +1,41 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// readSSEData calls onData with the payload of every "data:" line of an SSE
+// stream until onData asks to stop, the stream sends the [DONE] sentinel or
+// the body ends
+func readSSEData(body io.Reader, onData func(data string) (stop bool, err error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			return nil
+		}
+
+		stop, err := onData(data)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+	return nil
+}
@@ -2,32 +2,71 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 
-	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/tracing"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type STTService struct{}
+// STTService transcribes one request's audio. Like ChatService it holds
+// per-request state, so handlers build a new one for every request.
+type STTService struct {
+	url      string
+	client   *upstream.Client
+	usage    *UsageService
+	userID   string
+	planID   string
+	language string
+}
+
+// NewSTTService returns an STT service posting audio to url through client
+func NewSTTService(url string, client *upstream.Client, usage *UsageService) *STTService {
+	return &STTService{
+		url:    url,
+		client: client,
+		usage:  usage,
+	}
+}
+
+// UseLanguage sets the language hint sent with the audio, e.g. "th". Empty
+// lets the STT service detect the language.
+func (s *STTService) UseLanguage(lang string) {
+	s.language = lang
+}
 
-func NewSTTService() *STTService {
-	return &STTService{}
+// ForUser sets the user and plan that transcriptions are accounted to
+func (s *STTService) ForUser(userID, planID string) {
+	s.userID = userID
+	s.planID = planID
 }
 
 type STTResponse struct {
 	Text  string `json:"text"`
 	Error string `json:"error,omitempty"`
+	// Duration is the length of the audio in seconds. It is estimated from
+	// the audio data when the STT service does not report it.
+	Duration float64 `json:"duration,omitempty"`
 }
 
-func (s *STTService) ConvertSpeechToText(audioData []byte, filename string) (string, error) {
-	cfg := config.Load()
-	sttURL := cfg.SttURL
+func (s *STTService) ConvertSpeechToText(ctx context.Context, audioData []byte, filename string) (_ *STTResponse, err error) {
+	ctx, span := tracing.Start(ctx, "ConvertSpeechToText", trace.WithAttributes(
+		attribute.Int("stt.audio_bytes", len(audioData)),
+		attribute.String("stt.language", s.language),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	sttURL := s.url
 
-	log.Printf("Calling STT service at: %s", sttURL)
+	slog.DebugContext(ctx, "Calling STT service", "url", sttURL)
 
 	// Create multipart form data
 	var requestBody bytes.Buffer
@@ -36,50 +75,64 @@ func (s *STTService) ConvertSpeechToText(audioData []byte, filename string) (str
 	// Add audio file to form
 	part, err := writer.CreateFormFile("audio", filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to create form file: %w", err)
+		return nil, fmt.Errorf("failed to create form file: %w", err)
 	}
 
 	if _, err := part.Write(audioData); err != nil {
-		return "", fmt.Errorf("failed to write audio data: %w", err)
+		return nil, fmt.Errorf("failed to write audio data: %w", err)
 	}
 
-	writer.Close()
-
-	// Make HTTP request to Python STT service
-	req, err := http.NewRequest("POST", sttURL, &requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if s.language != "" {
+		if err := writer.WriteField("language", s.language); err != nil {
+			return nil, fmt.Errorf("failed to write language hint: %w", err)
+		}
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("STT service unavailable: %w", err)
-	}
-	defer resp.Body.Close()
+	writer.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// Make HTTP request to Python STT service
+	formData := requestBody.Bytes()
+	resp, err := s.client.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sttURL, bytes.NewReader(formData))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
-
-	log.Printf("STT raw response: %s", string(body))
+	body := resp.Body
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("STT service error (status %d): %s", resp.StatusCode, string(body))
+		slog.WarnContext(ctx, "STT service error", "status", resp.StatusCode, "body", bodySnippet(body))
+		return nil, fmt.Errorf("STT service error (status %d)", resp.StatusCode)
 	}
+	slog.DebugContext(ctx, "STT response", "status", resp.StatusCode, "bytes", len(body))
 
 	// Parse response
 	var sttResponse STTResponse
 	if err := json.Unmarshal(body, &sttResponse); err != nil {
-		return "", fmt.Errorf("invalid STT response: %w", err)
+		return nil, fmt.Errorf("invalid STT response: %w", err)
 	}
 
 	if sttResponse.Error != "" {
-		return "", fmt.Errorf("STT error: %s", sttResponse.Error)
+		slog.WarnContext(ctx, "STT service reported an error", "body", bodySnippet([]byte(sttResponse.Error)))
+		return nil, errors.New("STT service reported an error")
 	}
 
-	return sttResponse.Text, nil
+	if sttResponse.Duration <= 0 {
+		sttResponse.Duration = estimateAudioSeconds(audioData)
+	}
+	span.SetAttributes(attribute.Float64("stt.audio_seconds", sttResponse.Duration))
+
+	s.usage.WithContext(context.WithoutCancel(ctx)).Record(&model.UsageRecord{
+		UserID:       s.userID,
+		PlanID:       s.planID,
+		Kind:         model.UsageKindSTT,
+		AudioSeconds: sttResponse.Duration,
+	})
+
+	return &sttResponse, nil
 }
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPlanNotPurchasable is returned when checking out a plan without a price
+	ErrPlanNotPurchasable = errors.New("plan cannot be purchased")
+	// ErrAlreadySubscribed is returned when checking out the plan the user
+	// already has an active subscription for
+	ErrAlreadySubscribed = errors.New("already subscribed to this plan")
+	// ErrNoActiveSubscription is returned when cancelling without an active
+	// subscription
+	ErrNoActiveSubscription = errors.New("no active subscription")
+)
+
+// SubscriptionService runs the upgrade flow: it starts checkouts with the
+// payment provider and applies the outcome its webhooks report to the
+// user's plan
+type SubscriptionService struct {
+	subscriptions *repository.SubscriptionRepository
+	plans         *PlanService
+	provider      PaymentProvider
+}
+
+// NewSubscriptionService returns a subscription service taking payments
+// through provider. The provider is shared so that providers keeping state
+// in memory, like the fake one, see every checkout. A nil provider turns
+// checkouts and webhooks off.
+func NewSubscriptionService(subscriptions *repository.SubscriptionRepository, plans *PlanService, provider PaymentProvider) *SubscriptionService {
+	return &SubscriptionService{
+		subscriptions: subscriptions,
+		plans:         plans,
+		provider:      provider,
+	}
+}
+
+// Catalog returns the plans that can be bought, cheapest first
+func (s *SubscriptionService) Catalog() ([]model.Plan, error) {
+	plans, err := s.plans.ListPlans()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := make([]model.Plan, 0, len(plans))
+	for _, plan := range plans {
+		if plan.PriceCents > 0 {
+			catalog = append(catalog, plan)
+		}
+	}
+	return catalog, nil
+}
+
+// StartCheckout creates a pending subscription for planID and a checkout
+// session to pay for it
+func (s *SubscriptionService) StartCheckout(ctx context.Context, userID, planID string) (*model.CheckoutSessionResponse, error) {
+	if s.provider == nil {
+		return nil, ErrPaymentsDisabled
+	}
+	plan, err := s.plans.GetPlan(planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.PriceCents <= 0 {
+		return nil, fmt.Errorf("%w: %q", ErrPlanNotPurchasable, planID)
+	}
+
+	active, err := s.subscriptions.GetActiveSubscription(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if active != nil && active.PlanID == planID {
+		return nil, ErrAlreadySubscribed
+	}
+
+	subscription := &model.Subscription{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		PlanID:   planID,
+		Status:   model.SubscriptionPending,
+		Provider: s.provider.Name(),
+	}
+	session, err := s.provider.CreateCheckoutSession(ctx, &CheckoutRequest{
+		SubscriptionID: subscription.ID,
+		UserID:         userID,
+		PlanID:         planID,
+		AmountCents:    plan.PriceCents,
+		Currency:       plan.Currency,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout session: %w", err)
+	}
+
+	subscription.CheckoutSessionID = session.ID
+	if err := s.subscriptions.CreateSubscription(subscription); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Checkout started", "user_id", userID, "plan_id", planID, "subscription_id", subscription.ID)
+	return &model.CheckoutSessionResponse{
+		SubscriptionID: subscription.ID,
+		SessionID:      session.ID,
+		CheckoutURL:    session.URL,
+	}, nil
+}
+
+// Status returns the user's current plan and most recent subscription
+func (s *SubscriptionService) Status(userID, role string) (*model.SubscriptionStatusResponse, error) {
+	plan, err := s.plans.PlanForUser(userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, err := s.subscriptions.GetLatestSubscription(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return &model.SubscriptionStatusResponse{
+		PlanID:       plan.ID,
+		Subscription: subscription,
+	}, nil
+}
+
+// Cancel cancels the user's active subscription with the provider and moves
+// the user back to their role's default plan
+func (s *SubscriptionService) Cancel(ctx context.Context, userID string) (*model.Subscription, error) {
+	subscription, err := s.subscriptions.GetActiveSubscription(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoActiveSubscription
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.provider != nil {
+		if err := s.provider.CancelSubscription(ctx, subscription.ProviderSubscriptionID); err != nil {
+			return nil, fmt.Errorf("failed to cancel subscription with provider: %w", err)
+		}
+	}
+
+	// The provider's webhook will report the same cancellation; applying it
+	// here as well makes the downgrade visible immediately
+	if err := s.cancelSubscription(subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// HandleWebhook verifies a provider callback and applies its event.
+// Events are idempotent, so redelivered callbacks are harmless.
+func (s *SubscriptionService) HandleWebhook(ctx context.Context, payload []byte, header http.Header) error {
+	if s.provider == nil {
+		return ErrPaymentsDisabled
+	}
+	event, err := s.provider.VerifyWebhook(payload, header)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Payment webhook", "event_id", event.ID, "type", event.Type)
+	switch event.Type {
+	case PaymentEventCheckoutCompleted:
+		return s.activate(ctx, event)
+	case PaymentEventCheckoutFailed:
+		return s.markFailed(event)
+	case PaymentEventSubscriptionCanceled:
+		subscription, err := s.findByProviderSubscription(event.ProviderSubscriptionID)
+		if err != nil || subscription == nil {
+			return err
+		}
+		return s.cancelSubscription(subscription)
+	}
+
+	slog.Info("Ignoring payment webhook", "type", event.Type)
+	return nil
+}
+
+// activate marks a paid subscription active, moves the user to its plan and
+// cancels the subscriptions it replaces
+func (s *SubscriptionService) activate(ctx context.Context, event *PaymentEvent) error {
+	subscription, err := s.subscriptions.GetSubscriptionBySessionID(event.SessionID)
+	if err != nil {
+		return fmt.Errorf("subscription for session %s: %w", event.SessionID, err)
+	}
+	if subscription.Status != model.SubscriptionPending {
+		return nil
+	}
+
+	subscription.Status = model.SubscriptionActive
+	subscription.ProviderSubscriptionID = event.ProviderSubscriptionID
+	subscription.CurrentPeriodEnd = event.PeriodEnd
+	if err := s.subscriptions.UpdateSubscription(subscription); err != nil {
+		return err
+	}
+
+	if err := s.plans.AssignPlan(subscription.UserID, subscription.PlanID); err != nil {
+		return err
+	}
+	slog.Info("Subscription active", "subscription_id", subscription.ID, "user_id", subscription.UserID, "plan_id", subscription.PlanID)
+
+	// Switching plans replaces the previous subscription, which must stop
+	// renewing with the provider as well
+	previous, err := s.subscriptions.ListOtherActiveSubscriptions(subscription.UserID, subscription.ID)
+	if err != nil {
+		slog.Error("Failed to list previous subscriptions", "user_id", subscription.UserID, "err", err)
+		return nil
+	}
+	for i := range previous {
+		old := &previous[i]
+		if old.ProviderSubscriptionID != "" {
+			if err := s.provider.CancelSubscription(ctx, old.ProviderSubscriptionID); err != nil {
+				// Left active so that it can be canceled again by hand
+				slog.Error("Failed to cancel previous subscription with provider", "subscription_id", old.ID, "user_id", old.UserID, "err", err)
+				continue
+			}
+		}
+		if err := s.cancelSubscription(old); err != nil {
+			slog.Error("Failed to cancel previous subscription", "subscription_id", old.ID, "user_id", old.UserID, "err", err)
+		}
+	}
+	return nil
+}
+
+func (s *SubscriptionService) markFailed(event *PaymentEvent) error {
+	subscription, err := s.subscriptions.GetSubscriptionBySessionID(event.SessionID)
+	if err != nil {
+		return fmt.Errorf("subscription for session %s: %w", event.SessionID, err)
+	}
+	if subscription.Status != model.SubscriptionPending {
+		return nil
+	}
+
+	subscription.Status = model.SubscriptionFailed
+	return s.subscriptions.UpdateSubscription(subscription)
+}
+
+// cancelSubscription marks a subscription canceled and, if it was the one
+// granting the user's plan, drops the user back to their default plan. A
+// plan assigned since, by a newer subscription or an admin, is kept.
+func (s *SubscriptionService) cancelSubscription(subscription *model.Subscription) error {
+	if subscription.Status != model.SubscriptionActive {
+		return nil
+	}
+
+	now := time.Now()
+	subscription.Status = model.SubscriptionCanceled
+	subscription.CanceledAt = &now
+	if err := s.subscriptions.UpdateSubscription(subscription); err != nil {
+		return err
+	}
+
+	released, err := s.plans.ReleasePlan(subscription.UserID, subscription.PlanID)
+	if err != nil {
+		return err
+	}
+	if released {
+		slog.Info("Subscription canceled, user is back on their default plan", "subscription_id", subscription.ID, "user_id", subscription.UserID)
+	} else {
+		slog.Info("Subscription canceled, user keeps their current plan", "subscription_id", subscription.ID, "user_id", subscription.UserID)
+	}
+	return nil
+}
+
+func (s *SubscriptionService) findByProviderSubscription(providerSubscriptionID string) (*model.Subscription, error) {
+	if providerSubscriptionID == "" {
+		slog.Warn("Ignoring webhook without a provider subscription ID")
+		return nil, nil
+	}
+
+	subscription, err := s.subscriptions.GetSubscriptionByProviderID(providerSubscriptionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.Warn("Ignoring webhook for unknown provider subscription", "provider_subscription_id", providerSubscriptionID)
+		return nil, nil
+	}
+	return subscription, err
+}
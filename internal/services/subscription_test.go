@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+// newTestSubscriptions returns a subscription service whose fake provider
+// delivers its webhooks back to the service
+func newTestSubscriptions(t *testing.T) (*SubscriptionService, *FakePaymentProvider, *PlanService, *repository.SubscriptionRepository) {
+	t.Helper()
+	db := newTestDB(t)
+	plans := NewPlanService(repository.NewPlanRepository(db))
+	if err := plans.SeedPlans(); err != nil {
+		t.Fatalf("SeedPlans: %v", err)
+	}
+	subscriptions := repository.NewSubscriptionRepository(db)
+
+	var service *SubscriptionService
+	webhooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		if err := service.HandleWebhook(r.Context(), payload, r.Header); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(webhooks.Close)
+
+	provider := NewFakePaymentProvider("webhook-secret", webhooks.URL)
+	service = NewSubscriptionService(subscriptions, plans, provider)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		Flush(ctx)
+	})
+	return service, provider, plans, subscriptions
+}
+
+func userPlanID(t *testing.T, plans *PlanService, userID string) string {
+	t.Helper()
+	plan, err := plans.PlanForUser(userID, RoleUser)
+	if err != nil {
+		t.Fatalf("PlanForUser: %v", err)
+	}
+	return plan.ID
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	service, provider, plans, subscriptions := newTestSubscriptions(t)
+	ctx := context.Background()
+
+	session, err := service.StartCheckout(ctx, "user-1", PlanPremium)
+	if err != nil {
+		t.Fatalf("StartCheckout: %v", err)
+	}
+	sub, err := subscriptions.GetSubscriptionByID(session.SubscriptionID)
+	if err != nil || sub.Status != model.SubscriptionPending {
+		t.Fatalf("after checkout: %+v, %v; want pending", sub, err)
+	}
+	if got := userPlanID(t, plans, "user-1"); got != PlanFree {
+		t.Errorf("plan before payment = %s, want %s", got, PlanFree)
+	}
+
+	// Only the user who started the checkout can complete it
+	if err := provider.CompleteCheckout(ctx, session.SessionID, "user-2", true); !errors.Is(err, ErrCheckoutSessionNotFound) {
+		t.Errorf("another user's checkout: err = %v", err)
+	}
+
+	if err := provider.CompleteCheckout(ctx, session.SessionID, "user-1", true); err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+	sub, _ = subscriptions.GetSubscriptionByID(session.SubscriptionID)
+	if sub.Status != model.SubscriptionActive || sub.ProviderSubscriptionID == "" || sub.CurrentPeriodEnd == nil {
+		t.Fatalf("after payment: %+v; want active with a period", sub)
+	}
+	if got := userPlanID(t, plans, "user-1"); got != PlanPremium {
+		t.Errorf("plan after payment = %s, want %s", got, PlanPremium)
+	}
+	if _, err := service.StartCheckout(ctx, "user-1", PlanPremium); !errors.Is(err, ErrAlreadySubscribed) {
+		t.Errorf("second checkout: err = %v, want ErrAlreadySubscribed", err)
+	}
+
+	canceled, err := service.Cancel(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if canceled.Status != model.SubscriptionCanceled || canceled.CanceledAt == nil {
+		t.Errorf("after cancel: %+v; want canceled", canceled)
+	}
+	if got := userPlanID(t, plans, "user-1"); got != PlanFree {
+		t.Errorf("plan after cancel = %s, want %s", got, PlanFree)
+	}
+	if _, err := service.Cancel(ctx, "user-1"); !errors.Is(err, ErrNoActiveSubscription) {
+		t.Errorf("second cancel: err = %v, want ErrNoActiveSubscription", err)
+	}
+}
+
+func TestSubscriptionFailedPayment(t *testing.T) {
+	service, provider, plans, subscriptions := newTestSubscriptions(t)
+	ctx := context.Background()
+
+	session, err := service.StartCheckout(ctx, "user-1", PlanPremium)
+	if err != nil {
+		t.Fatalf("StartCheckout: %v", err)
+	}
+	if err := provider.CompleteCheckout(ctx, session.SessionID, "user-1", false); err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+
+	sub, _ := subscriptions.GetSubscriptionByID(session.SubscriptionID)
+	if sub.Status != model.SubscriptionFailed {
+		t.Errorf("status = %s, want %s", sub.Status, model.SubscriptionFailed)
+	}
+	if got := userPlanID(t, plans, "user-1"); got != PlanFree {
+		t.Errorf("plan = %s, want %s", got, PlanFree)
+	}
+	// The session is used up
+	if err := provider.CompleteCheckout(ctx, session.SessionID, "user-1", true); !errors.Is(err, ErrCheckoutSessionNotFound) {
+		t.Errorf("reused session: err = %v", err)
+	}
+}
+
+func TestSubscriptionWebhookRejectsBadSignature(t *testing.T) {
+	service, _, _, _ := newTestSubscriptions(t)
+
+	header := http.Header{}
+	header.Set(WebhookSignatureHeader, SignWebhook("another-secret", []byte(`{}`), time.Now()))
+	if err := service.HandleWebhook(context.Background(), []byte(`{}`), header); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("err = %v, want ErrInvalidWebhookSignature", err)
+	}
+}
+
+func TestSubscriptionsDisabled(t *testing.T) {
+	service := NewSubscriptionService(repository.NewSubscriptionRepository(newTestDB(t)), nil, nil)
+
+	if _, err := service.StartCheckout(context.Background(), "user-1", PlanPremium); !errors.Is(err, ErrPaymentsDisabled) {
+		t.Errorf("StartCheckout: err = %v, want ErrPaymentsDisabled", err)
+	}
+	if err := service.HandleWebhook(context.Background(), []byte(`{}`), http.Header{}); !errors.Is(err, ErrPaymentsDisabled) {
+		t.Errorf("HandleWebhook: err = %v, want ErrPaymentsDisabled", err)
+	}
+}
+
+// cancelRecorder records the subscriptions canceled with the provider
+type cancelRecorder struct {
+	*FakePaymentProvider
+	canceled []string
+}
+
+func (p *cancelRecorder) CancelSubscription(ctx context.Context, providerSubscriptionID string) error {
+	p.canceled = append(p.canceled, providerSubscriptionID)
+	return p.FakePaymentProvider.CancelSubscription(ctx, providerSubscriptionID)
+}
+
+func TestSubscriptionSwitchPlans(t *testing.T) {
+	service, provider, plans, subscriptions := newTestSubscriptions(t)
+	recorder := &cancelRecorder{FakePaymentProvider: provider}
+	service.provider = recorder
+	ctx := context.Background()
+
+	subscribe := func(planID string) *model.Subscription {
+		t.Helper()
+		session, err := service.StartCheckout(ctx, "user-1", planID)
+		if err != nil {
+			t.Fatalf("StartCheckout(%s): %v", planID, err)
+		}
+		if err := provider.CompleteCheckout(ctx, session.SessionID, "user-1", true); err != nil {
+			t.Fatalf("CompleteCheckout(%s): %v", planID, err)
+		}
+		sub, err := subscriptions.GetSubscriptionByID(session.SubscriptionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+
+	premium := subscribe(PlanPremium)
+	clinic := subscribe(PlanClinic)
+
+	// The replaced subscription stops renewing with the provider too
+	if len(recorder.canceled) != 1 || recorder.canceled[0] != premium.ProviderSubscriptionID {
+		t.Errorf("canceled with the provider: %q, want only %s", recorder.canceled, premium.ProviderSubscriptionID)
+	}
+	flushCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := Flush(flushCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	premium, _ = subscriptions.GetSubscriptionByID(premium.ID)
+	clinic, _ = subscriptions.GetSubscriptionByID(clinic.ID)
+	if premium.Status != model.SubscriptionCanceled || clinic.Status != model.SubscriptionActive {
+		t.Errorf("statuses = %s and %s, want the premium one canceled and the clinic one active", premium.Status, clinic.Status)
+	}
+	// The provider's cancellation webhook for the old subscription does not
+	// take away the new plan
+	if got := userPlanID(t, plans, "user-1"); got != PlanClinic {
+		t.Errorf("plan after switching = %s, want %s", got, PlanClinic)
+	}
+}
+
+func TestSubscriptionCancelKeepsAnotherPlan(t *testing.T) {
+	service, provider, plans, _ := newTestSubscriptions(t)
+	ctx := context.Background()
+
+	session, err := service.StartCheckout(ctx, "user-1", PlanPremium)
+	if err != nil {
+		t.Fatalf("StartCheckout: %v", err)
+	}
+	if err := provider.CompleteCheckout(ctx, session.SessionID, "user-1", true); err != nil {
+		t.Fatalf("CompleteCheckout: %v", err)
+	}
+
+	// An admin moves the user to another plan before the subscription ends
+	if err := plans.AssignPlan("user-1", PlanInternal); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Cancel(ctx, "user-1"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if got := userPlanID(t, plans, "user-1"); got != PlanInternal {
+		t.Errorf("plan after cancel = %s, want the assigned %s", got, PlanInternal)
+	}
+}
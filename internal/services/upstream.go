@@ -0,0 +1,62 @@
+package services
+
+import (
+	"unicode/utf8"
+
+	"github.com/EyeQuila/eyeQcheck/internal/config"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
+)
+
+// maxBodySnippet bounds how much of an upstream error body is logged
+const maxBodySnippet = 256
+
+// UpstreamClients are the clients for the services we call. They are built
+// once and shared by all requests so that their circuit breakers see every
+// call.
+type UpstreamClients struct {
+	RAG    *upstream.Client
+	STT    *upstream.Client
+	OpenAI *upstream.Client
+}
+
+// bodySnippet returns the start of an upstream response body for logging.
+// Upstream bodies can echo the user's messages, so callers log it under the
+// "body" key, which the log redactor masks as content, and never put it in
+// errors.
+func bodySnippet(body []byte) string {
+	if len(body) <= maxBodySnippet {
+		return string(body)
+	}
+	cut := maxBodySnippet
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return string(body[:cut]) + "..."
+}
+
+// NewUpstreamClients builds the upstream clients configured in cfg
+func NewUpstreamClients(cfg *config.Config) *UpstreamClients {
+	return &UpstreamClients{
+		RAG: upstream.New(upstream.Options{
+			Name:             "RAG",
+			Timeout:          cfg.RagTimeout,
+			MaxRetries:       cfg.UpstreamMaxRetries,
+			FailureThreshold: cfg.UpstreamBreakerThreshold,
+			OpenDuration:     cfg.UpstreamBreakerCooldown,
+		}),
+		STT: upstream.New(upstream.Options{
+			Name:             "STT",
+			Timeout:          cfg.SttTimeout,
+			MaxRetries:       cfg.UpstreamMaxRetries,
+			FailureThreshold: cfg.UpstreamBreakerThreshold,
+			OpenDuration:     cfg.UpstreamBreakerCooldown,
+		}),
+		OpenAI: upstream.New(upstream.Options{
+			Name:             "OpenAI",
+			Timeout:          cfg.OpenAITimeout,
+			MaxRetries:       cfg.UpstreamMaxRetries,
+			FailureThreshold: cfg.UpstreamBreakerThreshold,
+			OpenDuration:     cfg.UpstreamBreakerCooldown,
+		}),
+	}
+}
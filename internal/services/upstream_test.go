@@ -0,0 +1,97 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EyeQuila/eyeQcheck/internal/logging"
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/upstream"
+)
+
+func TestBodySnippet(t *testing.T) {
+	short := "bad request"
+	if got := bodySnippet([]byte(short)); got != short {
+		t.Errorf("bodySnippet(%q) = %q", short, got)
+	}
+
+	// Long bodies are cut on a character boundary
+	long := strings.Repeat("ก", maxBodySnippet)
+	got := bodySnippet([]byte(long))
+	if len(got) > maxBodySnippet+len("...") || !strings.HasSuffix(got, "...") {
+		t.Errorf("bodySnippet of %d bytes = %d bytes: %q", len(long), len(got), got)
+	}
+	if !strings.HasPrefix(long, strings.TrimSuffix(got, "...")) || !strings.HasSuffix(strings.TrimSuffix(got, "..."), "ก") {
+		t.Errorf("bodySnippet cut a character: %q", got)
+	}
+}
+
+func TestUpstreamErrorBodiesStayOutOfErrors(t *testing.T) {
+	const echoed = "transcript for jane@example.com failed"
+	redactor, err := logging.ParseRedactor("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+
+	for _, tc := range []struct {
+		name    string
+		status  int
+		body    string
+		call    func(url string) error
+		wantLog string
+	}{
+		{"stt error status", http.StatusBadRequest, echoed, callSTT, "status=400"},
+		{"stt reported error", http.StatusOK, `{"error": "` + echoed + `"}`, callSTT, "STT service reported an error"},
+		{"rag error status", http.StatusInternalServerError, echoed, callRAG, "status=500"},
+		{"rag reported error", http.StatusOK, `{"error": "` + echoed + `"}`, callRAG, "RAG service reported an error"},
+		{"rag stream reported error", http.StatusOK, "data: {\"error\": \"" + echoed + "\"}\n\n", callRAGStream, "RAG stream reported an error"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				io.WriteString(w, tc.body)
+			}))
+			defer server.Close()
+
+			var logs bytes.Buffer
+			slog.SetDefault(slog.New(logging.NewHandler(slog.NewTextHandler(&logs, nil), redactor)))
+
+			err := tc.call(server.URL)
+			if err == nil {
+				t.Fatal("call succeeded against a failing service")
+			}
+			if strings.Contains(err.Error(), "jane") {
+				t.Errorf("error carries the upstream body: %v", err)
+			}
+			if !strings.Contains(logs.String(), tc.wantLog) || strings.Contains(logs.String(), "jane") {
+				t.Errorf("want %q logged and the body redacted:\n%s", tc.wantLog, logs.String())
+			}
+		})
+	}
+}
+
+func callSTT(url string) error {
+	stt := NewSTTService(url, upstream.New(upstream.Options{Name: "STT"}), nil)
+	_, err := stt.ConvertSpeechToText(context.Background(), []byte("RIFF"), "a.wav")
+	return err
+}
+
+func callRAG(url string) error {
+	rag := &ragBackend{url: url, client: upstream.New(upstream.Options{Name: "RAG"})}
+	_, err := rag.Complete(context.Background(), &BackendRequest{Messages: []model.GPTMessage{{Role: "user", Content: "hi"}}})
+	return err
+}
+
+func callRAGStream(url string) error {
+	rag := &ragBackend{streamURL: url, client: upstream.New(upstream.Options{Name: "RAG"})}
+	_, err := rag.Stream(context.Background(), &BackendRequest{Messages: []model.GPTMessage{{Role: "user", Content: "hi"}}},
+		func(string) error { return nil })
+	return err
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+// Dimensions admins can group usage by
+const (
+	UsageGroupUser    = "user"
+	UsageGroupThread  = "thread"
+	UsageGroupPlan    = "plan"
+	UsageGroupKind    = "kind"
+	UsageGroupBackend = "backend"
+	UsageGroupModel   = "model"
+	UsageGroupDay     = "day"
+)
+
+// maxUsageGroups bounds how many groups a usage report lists
+const maxUsageGroups = 100
+
+// ErrInvalidUsageGroup is returned for an unknown group_by dimension
+var ErrInvalidUsageGroup = errors.New("invalid usage group")
+
+// UsageService records what chat replies and transcriptions consume and
+// reports it per user, thread and plan
+type UsageService struct {
+	usage *repository.UsageRepository
+	plans *PlanService
+	ctx   context.Context
+}
+
+func NewUsageService(usage *repository.UsageRepository, plans *PlanService) *UsageService {
+	return &UsageService{
+		usage: usage,
+		plans: plans,
+		ctx:   context.Background(),
+	}
+}
+
+// WithContext returns a copy of the service that records with ctx, so the
+// writes are traced and logged as part of the request in ctx
+func (s *UsageService) WithContext(ctx context.Context) *UsageService {
+	return &UsageService{usage: s.usage.WithContext(ctx), plans: s.plans, ctx: ctx}
+}
+
+// Record stores a usage record. Failures are logged rather than returned so
+// accounting problems never cost the user their reply.
+func (s *UsageService) Record(record *model.UsageRecord) {
+	if record.UserID == "" {
+		return
+	}
+	if err := s.usage.CreateUsageRecord(record); err != nil {
+		slog.ErrorContext(s.ctx, "Failed to record usage", "kind", record.Kind, "user_id", record.UserID, "err", err)
+	}
+}
+
+// Summary returns a user's usage between from and to, broken down by thread
+// and plan, along with the quotas of their current plan
+func (s *UsageService) Summary(userID, role string, from, to time.Time) (*model.UsageSummaryResponse, error) {
+	totals, err := s.usage.SumUsage(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	threads, err := s.usage.GroupUsage(userID, UsageGroupThread, from, to, maxUsageGroups)
+	if err != nil {
+		return nil, err
+	}
+	plans, err := s.usage.GroupUsage(userID, UsageGroupPlan, from, to, maxUsageGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.plans.PlanForUser(userID, role)
+	if err != nil {
+		return nil, err
+	}
+	quotas := make(map[string][]model.Quota)
+	now := time.Now()
+	for i := range plan.Limits {
+		limit := &plan.Limits[i]
+		groupQuotas, err := s.plans.Quotas(UserQuotaSubject(userID), limit.RouteGroup, limit, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(groupQuotas) > 0 {
+			quotas[limit.RouteGroup] = groupQuotas
+		}
+	}
+
+	return &model.UsageSummaryResponse{
+		From:    from,
+		To:      to,
+		PlanID:  plan.ID,
+		Totals:  *totals,
+		Threads: threads,
+		Plans:   plans,
+		Quotas:  quotas,
+	}, nil
+}
+
+// Aggregate returns all users' usage between from and to grouped by groupBy
+func (s *UsageService) Aggregate(groupBy string, from, to time.Time) (*model.UsageAggregateResponse, error) {
+	switch groupBy {
+	case UsageGroupUser, UsageGroupThread, UsageGroupPlan, UsageGroupKind, UsageGroupBackend, UsageGroupModel, UsageGroupDay:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidUsageGroup, groupBy)
+	}
+
+	totals, err := s.usage.SumUsage("", from, to)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.usage.GroupUsage("", groupBy, from, to, maxUsageGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.UsageAggregateResponse{
+		From:    from,
+		To:      to,
+		GroupBy: groupBy,
+		Totals:  *totals,
+		Groups:  groups,
+	}, nil
+}
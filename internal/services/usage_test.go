@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+)
+
+// newTestUsage returns a usage service holding records of two users on
+// 2025-06-01 and 2025-06-02, and one before and one after those days
+func newTestUsage(t *testing.T) *UsageService {
+	t.Helper()
+	db := newTestDB(t)
+	plans := NewPlanService(repository.NewPlanRepository(db))
+	if err := plans.SeedPlans(); err != nil {
+		t.Fatalf("SeedPlans: %v", err)
+	}
+	usage := NewUsageService(repository.NewUsageRepository(db), plans)
+
+	day1 := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	for _, record := range []*model.UsageRecord{
+		{UserID: "user-1", ThreadID: "thread-1", PlanID: PlanFree, Kind: model.UsageKindChat, Backend: BackendRAG, Model: "gpt-4o",
+			PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, CreatedAt: day1},
+		{UserID: "user-1", ThreadID: "thread-1", PlanID: PlanFree, Kind: model.UsageKindChat, Backend: BackendRAG, Model: "gpt-4o-mini",
+			PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30, CreatedAt: day2},
+		{UserID: "user-1", PlanID: PlanFree, Kind: model.UsageKindSTT, AudioSeconds: 12.5, CreatedAt: day2},
+		{UserID: "user-2", ThreadID: "thread-2", PlanID: PlanPremium, Kind: model.UsageKindChat, Backend: BackendOpenAI, Model: "gpt-4o",
+			PromptTokens: 300, CompletionTokens: 100, TotalTokens: 400, CreatedAt: day1.Add(time.Hour)},
+		// Outside the reported range
+		{UserID: "user-1", ThreadID: "thread-0", PlanID: PlanFree, Kind: model.UsageKindChat, Model: "gpt-4o",
+			TotalTokens: 1000, CreatedAt: day1.Add(-48 * time.Hour)},
+		{UserID: "user-2", ThreadID: "thread-3", PlanID: PlanPremium, Kind: model.UsageKindChat, Model: "gpt-4o",
+			TotalTokens: 1000, CreatedAt: day2.Add(48 * time.Hour)},
+		// Usage of callers who are not logged in is not recorded
+		{ThreadID: "thread-4", Kind: model.UsageKindChat, TotalTokens: 1000, CreatedAt: day1},
+	} {
+		usage.Record(record)
+	}
+	return usage
+}
+
+// usageFrom and usageTo cover the two days of newTestUsage
+var usageFrom, usageTo = time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC)
+
+func TestUsageAggregate(t *testing.T) {
+	usage := newTestUsage(t)
+
+	for _, tc := range []struct {
+		groupBy string
+		want    []model.UsageGroup // highest token use first
+	}{
+		{UsageGroupUser, []model.UsageGroup{
+			{Key: "user-2", UsageTotals: model.UsageTotals{Requests: 1, PromptTokens: 300, CompletionTokens: 100, TotalTokens: 400}},
+			{Key: "user-1", UsageTotals: model.UsageTotals{Requests: 3, PromptTokens: 120, CompletionTokens: 60, TotalTokens: 180, AudioSeconds: 12.5}},
+		}},
+		{UsageGroupDay, []model.UsageGroup{
+			{Key: "2025-06-01", UsageTotals: model.UsageTotals{Requests: 2, PromptTokens: 400, CompletionTokens: 150, TotalTokens: 550}},
+			{Key: "2025-06-02", UsageTotals: model.UsageTotals{Requests: 2, PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30, AudioSeconds: 12.5}},
+		}},
+		{UsageGroupModel, []model.UsageGroup{
+			{Key: "gpt-4o", UsageTotals: model.UsageTotals{Requests: 2, PromptTokens: 400, CompletionTokens: 150, TotalTokens: 550}},
+			{Key: "gpt-4o-mini", UsageTotals: model.UsageTotals{Requests: 1, PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30}},
+			// Transcriptions have no model
+			{Key: "", UsageTotals: model.UsageTotals{Requests: 1, AudioSeconds: 12.5}},
+		}},
+	} {
+		report, err := usage.Aggregate(tc.groupBy, usageFrom, usageTo)
+		if err != nil {
+			t.Fatalf("Aggregate(%s): %v", tc.groupBy, err)
+		}
+		want := model.UsageTotals{Requests: 4, PromptTokens: 420, CompletionTokens: 160, TotalTokens: 580, AudioSeconds: 12.5}
+		if report.Totals != want {
+			t.Errorf("%s: totals = %+v, want %+v", tc.groupBy, report.Totals, want)
+		}
+		if len(report.Groups) != len(tc.want) {
+			t.Errorf("%s: groups = %+v, want %+v", tc.groupBy, report.Groups, tc.want)
+			continue
+		}
+		for i, group := range report.Groups {
+			if group != tc.want[i] {
+				t.Errorf("%s: group %d = %+v, want %+v", tc.groupBy, i, group, tc.want[i])
+			}
+		}
+	}
+
+	if _, err := usage.Aggregate("color", usageFrom, usageTo); !errors.Is(err, ErrInvalidUsageGroup) {
+		t.Errorf("Aggregate(color): err = %v, want ErrInvalidUsageGroup", err)
+	}
+}
+
+func TestUsageSummary(t *testing.T) {
+	usage := newTestUsage(t)
+
+	summary, err := usage.Summary("user-1", RoleUser, usageFrom, usageTo)
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	want := model.UsageTotals{Requests: 3, PromptTokens: 120, CompletionTokens: 60, TotalTokens: 180, AudioSeconds: 12.5}
+	if summary.PlanID != PlanFree || summary.Totals != want {
+		t.Errorf("summary = %s %+v, want %s %+v", summary.PlanID, summary.Totals, PlanFree, want)
+	}
+	// Only the user's own threads are listed, without transcriptions
+	if len(summary.Threads) != 1 || summary.Threads[0].Key != "thread-1" || summary.Threads[0].Requests != 2 {
+		t.Errorf("threads = %+v, want thread-1 with 2 requests", summary.Threads)
+	}
+	if len(summary.Plans) != 1 || summary.Plans[0].Key != PlanFree || summary.Plans[0].Requests != 3 {
+		t.Errorf("plans = %+v, want %s with 3 requests", summary.Plans, PlanFree)
+	}
+}
@@ -1,28 +1,73 @@
 package services
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/EyeQuila/eyeQcheck/internal/cache"
+	"github.com/EyeQuila/eyeQcheck/internal/i18n"
 	"github.com/EyeQuila/eyeQcheck/internal/model"
+	"github.com/EyeQuila/eyeQcheck/internal/repository"
+	"gorm.io/gorm"
 )
 
-type UserService struct{}
+var (
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailTaken is returned when an email address already belongs to
+	// another user
+	ErrEmailTaken = errors.New("email already belongs to another user")
+	// ErrInvalidRole is returned when setting a role other than RoleUser or
+	// RoleAdmin
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// defaultUserRole is the role of users registered without one
+const defaultUserRole = RoleUser
+
+// accountCacheTTL bounds how long a disabled user or changed role keeps
+// being served from the cache
+const accountCacheTTL = 30 * time.Second
+
+type UserService struct {
+	users    *repository.UserRepository
+	accounts *cache.LRU[*model.User]
+}
+
+func NewUserService(users *repository.UserRepository) *UserService {
+	return &UserService{
+		users:    users,
+		accounts: cache.NewLRU[*model.User](10000, accountCacheTTL),
+	}
+}
 
-func NewUserService() *UserService {
-	return &UserService{}
+// ValidRole reports whether role is a known user role
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
 }
 
-// RegisterOrUpdateUser registers a new user or updates existing user from OAuth system
+// RegisterOrUpdateUser registers a new user or updates existing user from OAuth system.
+// Users are matched by ID first and by email second; an email that belongs
+// to a user with another ID is rejected with ErrEmailTaken.
 func (s *UserService) RegisterOrUpdateUser(userID, email, displayName, googleID, avatarURL, role string) (*model.User, bool, error) {
-	// TODO: Implement database operations
-	// For now, return mock data
-	
-	log.Printf("Processing user registration: %s (%s)", displayName, email)
-	
-	// Check if user exists (mock implementation)
-	isNewUser := true // This should come from database query
-	
+	slog.Debug("Processing user registration", "display_name", displayName, "email", email)
+
+	if role == "" {
+		role = defaultUserRole
+	}
+	if !ValidRole(role) {
+		return nil, false, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	now := time.Now()
 	user := &model.User{
 		ID:          userID,
 		Email:       email,
@@ -31,80 +76,152 @@ func (s *UserService) RegisterOrUpdateUser(userID, email, displayName, googleID,
 		AvatarURL:   avatarURL,
 		Role:        role,
 		IsActive:    true,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		LastLoginAt: &now,
 	}
-	
-	if isNewUser {
-		// Create new user in database
-		log.Printf("Creating new user: %s", userID)
-		// TODO: INSERT INTO users...
-		
-		// Create default user preferences
-		err := s.createDefaultUserPreferences(userID)
-		if err != nil {
-			log.Printf("Failed to create user preferences: %v", err)
-			// Continue anyway, preferences are not critical
+
+	isNewUser, err := s.users.UpsertUser(user, defaultUserPreferences(), func(stored *model.User) error {
+		if stored.ID != userID {
+			return fmt.Errorf("%w: %s", ErrEmailTaken, email)
 		}
+		stored.Email = email
+		stored.DisplayName = displayName
+		stored.LastLoginAt = &now
+		if googleID != "" {
+			stored.GoogleID = googleID
+		}
+		if avatarURL != "" {
+			stored.AvatarURL = avatarURL
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if isNewUser {
+		slog.Info("Created user", "user_id", userID)
 	} else {
-		// Update existing user
-		log.Printf("Updating existing user: %s", userID)
-		// TODO: UPDATE users SET... WHERE id = userID
-		user.LastLoginAt = &time.Time{}
-		*user.LastLoginAt = time.Now()
+		slog.Debug("Updated user", "user_id", userID)
 	}
-	
 	return user, isNewUser, nil
 }
 
-// createDefaultUserPreferences creates default preferences for new users
-func (s *UserService) createDefaultUserPreferences(userID string) error {
-	_ = &model.UserPreferences{
-		UserID:             userID,
-		Language:           "th", // Default to Thai
+// defaultUserPreferences returns the preferences new users start with
+func defaultUserPreferences() *model.UserPreferences {
+	return &model.UserPreferences{
+		Language:           i18n.DefaultLanguage,
 		NotificationsEmail: true,
 		NotificationsPush:  true,
-		ThemePreference:    "light",
-		CreatedAt:          time.Now(),
-		UpdatedAt:          time.Now(),
-	}
-	
-	log.Printf("Creating default preferences for user: %s", userID)
-	// TODO: INSERT INTO user_preferences...
-	
-	return nil
+		ThemePreference:    ThemeLight,
+	}
 }
 
 // GetUserByID retrieves user by ID
 func (s *UserService) GetUserByID(userID string) (*model.User, error) {
-	// TODO: Implement database query
-	// SELECT * FROM users WHERE id = userID
-	return nil, nil
+	user, err := s.users.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
 }
 
 // GetUserByEmail retrieves user by email
 func (s *UserService) GetUserByEmail(email string) (*model.User, error) {
-	// TODO: Implement database query
-	// SELECT * FROM users WHERE email = email
-	return nil, nil
+	user, err := s.users.GetUserByEmail(email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
 }
 
 // UpdateUserLastLogin updates user's last login timestamp
 func (s *UserService) UpdateUserLastLogin(userID string) error {
-	log.Printf("Updating last login for user: %s", userID)
-	// TODO: UPDATE users SET last_login_at = NOW() WHERE id = userID
-	return nil
+	slog.Debug("Updating last login", "user_id", userID)
+	err := s.users.TouchLastLogin(userID, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	return err
 }
 
 // GetUserProfile retrieves the profile of the authenticated user
 func (s *UserService) GetUserProfile(userID string) (*model.User, error) {
-	log.Printf("Fetching profile for user: %s", userID)
+	slog.Debug("Fetching user profile", "user_id", userID)
 	return s.GetUserByID(userID)
 }
 
-// UpdateUserProfile updates the profile of the authenticated user
+// UpdateUserProfile updates the profile of the authenticated user. Users
+// cannot change their own role, so user.Role is ignored.
 func (s *UserService) UpdateUserProfile(user *model.User) error {
-	log.Printf("Updating profile for user: %s", user.ID)
-	return s.UpdateUserLastLogin(user.ID) // This should also update other fields like email, display name, etc.
+	slog.Debug("Updating user profile", "user_id", user.ID)
+
+	if other, err := s.users.GetUserByEmail(user.Email); err == nil && other.ID != user.ID {
+		return fmt.Errorf("%w: %s", ErrEmailTaken, user.Email)
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	err := s.users.UpdateUserFields(user.ID, map[string]interface{}{
+		"email":        user.Email,
+		"display_name": user.DisplayName,
+		"google_id":    user.GoogleID,
+		"avatar_url":   user.AvatarURL,
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// Account returns the registered user with userID, or nil when the user
+// never registered. Lookups are cached briefly because the auth middleware
+// makes one per request.
+func (s *UserService) Account(userID string) (*model.User, error) {
+	if user, ok := s.accounts.Get(userID); ok {
+		return user, nil
+	}
+
+	user, err := s.users.GetUserByID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.accounts.Set(userID, user)
+	return user, nil
 }
 
+// FindUser looks a user up by ID, or by email when ref contains an @
+func (s *UserService) FindUser(ref string) (*model.User, error) {
+	if strings.Contains(ref, "@") {
+		return s.GetUserByEmail(ref)
+	}
+	return s.GetUserByID(ref)
+}
+
+// SetRole changes a user's role
+func (s *UserService) SetRole(userID, role string) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	return s.updateAccount(userID, map[string]interface{}{"role": role})
+}
+
+// SetActive enables or disables a user. Disabled users are refused by the
+// auth middleware.
+func (s *UserService) SetActive(userID string, active bool) error {
+	return s.updateAccount(userID, map[string]interface{}{"is_active": active})
+}
+
+func (s *UserService) updateAccount(userID string, updates map[string]interface{}) error {
+	err := s.users.UpdateUserFields(userID, updates)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.accounts.Delete(userID)
+	return nil
+}
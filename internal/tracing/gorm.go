@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormSpanKey is where the span of a statement is kept between the before
+// and after callbacks
+const gormSpanKey = "tracing:span"
+
+// gormSpan is a statement's span and the operation that started it
+type gormSpan struct {
+	span      trace.Span
+	operation string
+}
+
+// GormPlugin creates a span for every GORM statement run with a context
+// that carries a span, e.g. db.WithContext(c.Request.Context()). Statements
+// without one are not traced, so background queries do not each start a
+// trace of their own.
+type GormPlugin struct{}
+
+// Name implements gorm.Plugin
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implements gorm.Plugin
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", beforeStatement("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", afterStatement),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", beforeStatement("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", afterStatement),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", beforeStatement("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", afterStatement),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", beforeStatement("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", afterStatement),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", beforeStatement("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", afterStatement),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", beforeStatement("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", afterStatement),
+	)
+}
+
+func beforeStatement(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			return
+		}
+		_, span := Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+		span.SetAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation))
+		db.InstanceSet(gormSpanKey, gormSpan{span: span, operation: operation})
+	}
+}
+
+func afterStatement(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	s := value.(gormSpan)
+
+	if table := db.Statement.Table; table != "" {
+		s.span.SetName("gorm." + s.operation + " " + table)
+		s.span.SetAttributes(semconv.DBCollectionName(table))
+	}
+	s.span.SetAttributes(
+		semconv.DBQueryText(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Not finding a row is an answer, not a failure
+		err = nil
+	}
+	End(s.span, err)
+}
@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+// newTracedDB returns an in-memory database with the plugin installed and a
+// recorder of the spans it ends
+func newTracedDB(t *testing.T) (*gorm.DB, *tracetest.SpanRecorder) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	saved := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(saved) })
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&widget{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(GormPlugin{}); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	return db, recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestGormPluginSpans(t *testing.T) {
+	db, recorder := newTracedDB(t)
+
+	ctx, parent := Start(context.Background(), "request")
+	if err := db.WithContext(ctx).Create(&widget{Name: "lens"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var found []widget
+	if err := db.WithContext(ctx).Where("name = ?", "lens").Find(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want create, query and the request", len(spans))
+	}
+	for i, tc := range []struct {
+		name, operation, sql string
+		rows                 int64
+	}{
+		{"gorm.create widgets", "create", "INSERT INTO `widgets`", 1},
+		{"gorm.query widgets", "query", "SELECT * FROM `widgets` WHERE name = ?", 1},
+	} {
+		span := spans[i]
+		if span.Name() != tc.name {
+			t.Errorf("span %d = %q, want %q", i, span.Name(), tc.name)
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() || span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+			t.Errorf("%s is not a child of the request span", span.Name())
+		}
+		attrs := attributes(span)
+		if got := attrs["db.system"].AsString(); got != "postgresql" {
+			t.Errorf("%s: db.system = %q", span.Name(), got)
+		}
+		if got := attrs["db.operation.name"].AsString(); got != tc.operation {
+			t.Errorf("%s: db.operation.name = %q, want %q", span.Name(), got, tc.operation)
+		}
+		if got := attrs["db.collection.name"].AsString(); got != "widgets" {
+			t.Errorf("%s: db.collection.name = %q, want widgets", span.Name(), got)
+		}
+		if got := attrs["db.query.text"].AsString(); !strings.HasPrefix(got, tc.sql) {
+			t.Errorf("%s: db.query.text = %q, want it to start with %q", span.Name(), got, tc.sql)
+		}
+		if got := attrs["db.rows_affected"].AsInt64(); got != tc.rows {
+			t.Errorf("%s: db.rows_affected = %d, want %d", span.Name(), got, tc.rows)
+		}
+		if span.Status().Code == codes.Error {
+			t.Errorf("%s: status = %v", span.Name(), span.Status())
+		}
+	}
+}
+
+func TestGormPluginErrors(t *testing.T) {
+	db, recorder := newTracedDB(t)
+	ctx, parent := Start(context.Background(), "request")
+	defer parent.End()
+
+	// Not finding a row is not an error
+	var w widget
+	if err := db.WithContext(ctx).First(&w, 42).Error; err == nil {
+		t.Fatal("First found a missing row")
+	}
+	if err := db.WithContext(ctx).Exec("SELECT * FROM missing").Error; err == nil {
+		t.Fatal("query of a missing table succeeded")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	if status := spans[0].Status(); status.Code == codes.Error {
+		t.Errorf("record not found: status = %v, want no error", status)
+	}
+	if status := spans[1].Status(); status.Code != codes.Error || len(spans[1].Events()) == 0 {
+		t.Errorf("failed statement: status = %v with %d events, want the error recorded", status, len(spans[1].Events()))
+	}
+}
+
+func TestGormPluginSkipsUntracedStatements(t *testing.T) {
+	db, recorder := newTracedDB(t)
+
+	// Background statements do not each start a trace
+	if err := db.WithContext(context.Background()).Create(&widget{Name: "lens"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recorder.Ended()) + len(recorder.Started()); n != 0 {
+		t.Errorf("recorded %d spans for a statement without a parent span", n)
+	}
+}
@@ -0,0 +1,365 @@
+// Package upstream provides the HTTP client used to call the Python RAG and
+// STT services. Every call is bounded by a timeout, retried with jittered
+// backoff when that is safe, and guarded by a circuit breaker so a dead
+// service fails fast instead of tying up gin workers.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/EyeQuila/eyeQcheck/internal/metrics"
+	"github.com/EyeQuila/eyeQcheck/internal/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrCircuitOpen is returned without calling the service while its circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("upstream circuit breaker is open")
+
+// ErrStreamIdle is returned by reads of a streamed body after the service
+// sent nothing for Options.Timeout
+var ErrStreamIdle = errors.New("upstream stream stalled")
+
+// Options configures a Client
+type Options struct {
+	// Name identifies the service in errors and logs, e.g. "RAG"
+	Name string
+	// Timeout bounds a single attempt, including reading the response body.
+	// For streamed calls it bounds the wait for response headers and then
+	// each wait for more of the body.
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts after the first one
+	MaxRetries int
+	// BaseBackoff is the backoff before the first retry; it doubles per retry
+	BaseBackoff time.Duration
+	// MaxBackoff caps the backoff between retries
+	MaxBackoff time.Duration
+	// FailureThreshold is the number of consecutive failures that opens the circuit
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open before a trial call
+	OpenDuration time.Duration
+}
+
+// Response is a fully read upstream response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// RequestFunc builds a fresh request for each attempt, so that request bodies
+// can be replayed on retry
+type RequestFunc func(ctx context.Context) (*http.Request, error)
+
+// Client calls a single upstream service
+type Client struct {
+	opts    Options
+	http    *http.Client
+	stream  *http.Client
+	breaker *breaker
+}
+
+// New creates a Client for one upstream service
+func New(opts Options) *Client {
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 200 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 2 * time.Second
+	}
+
+	streamTransport := http.DefaultTransport.(*http.Transport).Clone()
+	streamTransport.ResponseHeaderTimeout = opts.Timeout
+
+	return &Client{
+		opts:    opts,
+		http:    &http.Client{},
+		stream:  &http.Client{Transport: streamTransport},
+		breaker: newBreaker(opts.FailureThreshold, opts.OpenDuration),
+	}
+}
+
+// Name returns the service name the client was created with
+func (c *Client) Name() string {
+	return c.opts.Name
+}
+
+// CircuitOpen reports whether the client is currently failing fast
+func (c *Client) CircuitOpen() bool {
+	return c.breaker.isOpen()
+}
+
+// Do performs the request and reads the whole response body. Each attempt is
+// bounded by Options.Timeout and by ctx.
+func (c *Client) Do(ctx context.Context, build RequestFunc) (*Response, error) {
+	var result *Response
+	err := c.withRetries(ctx, build, func(ctx context.Context, req *http.Request) (int, error) {
+		attemptCtx, cancel := c.attemptContext(ctx)
+		defer cancel()
+
+		resp, err := c.http.Do(req.WithContext(attemptCtx))
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read response: %w", err)
+		}
+		result = &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+		return resp.StatusCode, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Stream performs the request and returns the response with its body still
+// open. The wait for headers is bounded by Options.Timeout, and so is every
+// gap between reads of the body: a stream that stalls for longer is cut off
+// and its reads fail with ErrStreamIdle. The caller must close the body.
+func (c *Client) Stream(ctx context.Context, build RequestFunc) (*http.Response, error) {
+	var result *http.Response
+	err := c.withRetries(ctx, build, func(ctx context.Context, req *http.Request) (int, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		resp, err := c.stream.Do(req.WithContext(ctx))
+		if err != nil {
+			cancel()
+			return 0, err
+		}
+		if isRetryableStatus(req, resp.StatusCode) {
+			resp.Body.Close()
+			cancel()
+			return resp.StatusCode, nil
+		}
+		resp.Body = newIdleTimeoutBody(resp.Body, c.opts.Timeout, cancel)
+		result = resp
+		return resp.StatusCode, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// idleTimeoutBody cancels a streamed response once no read has returned
+// data for timeout
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	idle    atomic.Bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() {
+			b.idle.Store(true)
+			cancel()
+		})
+	}
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if b.idle.Load() {
+		return n, fmt.Errorf("%w: nothing received for %s", ErrStreamIdle, b.timeout)
+	}
+	if n > 0 && b.timer != nil {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.cancel()
+	return b.body.Close()
+}
+
+// withRetries runs attempt until it succeeds, fails permanently or runs out
+// of retries, recording the outcome with the circuit breaker and in the
+// upstream metrics. A retryable status on the final attempt is returned as
+// an error.
+func (c *Client) withRetries(ctx context.Context, build RequestFunc, attempt func(context.Context, *http.Request) (int, error)) error {
+	start := time.Now()
+	status, err := c.retry(ctx, build, attempt)
+
+	outcome := callOutcome(status, err)
+	metrics.UpstreamCalls.WithLabelValues(c.opts.Name, outcome).Inc()
+	metrics.UpstreamDuration.WithLabelValues(c.opts.Name, outcome).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// retry implements withRetries and also returns the final attempt's status
+func (c *Client) retry(ctx context.Context, build RequestFunc, attempt func(context.Context, *http.Request) (int, error)) (int, error) {
+	var lastErr error
+	for i := 0; i <= c.opts.MaxRetries; i++ {
+		if i > 0 {
+			if err := sleep(ctx, c.backoff(i)); err != nil {
+				return 0, err
+			}
+		}
+
+		if !c.breaker.allow() {
+			return 0, fmt.Errorf("%s: %w", c.opts.Name, ErrCircuitOpen)
+		}
+
+		req, err := build(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		status, err := c.tracedAttempt(ctx, req, i, attempt)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// The caller gave up; that says nothing about the service
+			c.breaker.release()
+			return 0, ctx.Err()
+		case err != nil:
+			c.breaker.failure()
+			metrics.UpstreamAttemptErrors.WithLabelValues(c.opts.Name, "transport").Inc()
+			lastErr = fmt.Errorf("%s service unavailable: %w", c.opts.Name, err)
+			if !isRetryableError(req, err) {
+				return 0, lastErr
+			}
+		case status == http.StatusTooManyRequests:
+			// The service is up but busy; that is no reason to open the circuit
+			c.breaker.release()
+			metrics.UpstreamAttemptErrors.WithLabelValues(c.opts.Name, "status").Inc()
+			lastErr = fmt.Errorf("%s service busy (status %d)", c.opts.Name, status)
+		case status >= http.StatusInternalServerError:
+			c.breaker.failure()
+			metrics.UpstreamAttemptErrors.WithLabelValues(c.opts.Name, "status").Inc()
+			lastErr = fmt.Errorf("%s service error (status %d)", c.opts.Name, status)
+			if !isRetryableStatus(req, status) {
+				return status, nil
+			}
+		default:
+			c.breaker.success()
+			return status, nil
+		}
+	}
+	return 0, lastErr
+}
+
+// tracedAttempt runs one attempt in a client span and passes the span's
+// trace context on to the service in the traceparent header
+func (c *Client) tracedAttempt(ctx context.Context, req *http.Request, retry int, attempt func(context.Context, *http.Request) (int, error)) (int, error) {
+	ctx, span := tracing.Start(ctx, c.opts.Name+" "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+			semconv.HTTPRequestResendCount(retry),
+		),
+	)
+	req = req.WithContext(ctx)
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	status, err := attempt(ctx, req)
+	if status != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	}
+	spanErr := err
+	if spanErr == nil && status >= http.StatusInternalServerError {
+		spanErr = fmt.Errorf("status %d", status)
+	}
+	tracing.End(span, spanErr)
+	return status, err
+}
+
+// callOutcome classifies a finished call for the upstream metrics
+func callOutcome(status int, err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return metrics.OutcomeCircuitOpen
+	case errors.Is(err, context.Canceled):
+		return metrics.OutcomeCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return metrics.OutcomeTimeout
+	case err != nil, status >= http.StatusInternalServerError:
+		return metrics.OutcomeError
+	}
+	return metrics.OutcomeSuccess
+}
+
+func (c *Client) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.opts.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.opts.Timeout)
+}
+
+// backoff returns a full-jitter exponential backoff for the given retry
+func (c *Client) backoff(retry int) time.Duration {
+	d := c.opts.BaseBackoff << (retry - 1)
+	if d <= 0 || d > c.opts.MaxBackoff {
+		d = c.opts.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// isRetryableStatus reports whether the status means sending req again is
+// safe. 503 and 429 say the service turned the request away. A gateway's 502
+// or 504 may come after the service already acted on the request, so they
+// are only retried for idempotent methods: a chat completion would be
+// answered, and billed, twice.
+func isRetryableStatus(req *http.Request, status int) bool {
+	switch status {
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	}
+	return false
+}
+
+// isRetryableError reports whether a transport error is safe to retry.
+// Failures to connect never reached the service. Other errors, such as a
+// timeout while waiting for the reply, are only retried for idempotent methods.
+func isRetryableError(req *http.Request, err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return isIdempotent(req)
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,315 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer answers with the next of statuses, repeating the last one,
+// and counts the requests it gets
+type statusServer struct {
+	*httptest.Server
+	hits atomic.Int32
+
+	mu       sync.Mutex
+	statuses []int
+}
+
+func newStatusServer(t *testing.T, statuses ...int) *statusServer {
+	t.Helper()
+	s := &statusServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(s.hits.Add(1)) - 1
+		s.mu.Lock()
+		status := s.statuses[min(i, len(s.statuses)-1)]
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// answer makes every later request get status
+func (s *statusServer) answer(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = []int{status}
+}
+
+func get(url string) RequestFunc {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	}
+}
+
+func post(url string) RequestFunc {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	}
+}
+
+// clock is a settable time source
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestDoRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		statuses   []int
+		build      func(url string) RequestFunc
+		wantStatus int
+		wantErr    bool
+		wantHits   int32
+	}{
+		{"success", []int{200}, get, 200, false, 1},
+		{"unavailable then success", []int{503, 429, 200}, post, 200, false, 3},
+		{"unavailable throughout", []int{503}, post, 0, true, 3},
+		{"busy throughout", []int{429}, post, 0, true, 3},
+		{"bad gateway then success", []int{502, 504, 200}, get, 200, false, 3},
+		// A gateway error may follow a completion the service already
+		// billed, so a POST is not resent
+		{"bad gateway on post", []int{502, 200}, post, 502, false, 1},
+		{"gateway timeout on post", []int{504, 200}, post, 504, false, 1},
+		// The service may have acted on the request, so it is not resent
+		{"internal error", []int{500, 200}, post, 500, false, 1},
+		{"client error", []int{404, 200}, get, 404, false, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newStatusServer(t, tc.statuses...)
+			client := New(Options{Name: "test", Timeout: time.Second, MaxRetries: 2, BaseBackoff: time.Millisecond})
+
+			resp, err := client.Do(context.Background(), tc.build(server.URL))
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Do succeeded with status %d", resp.StatusCode)
+				}
+			} else if err != nil {
+				t.Errorf("Do: %v", err)
+			} else if resp.StatusCode != tc.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if n := server.hits.Load(); n != tc.wantHits {
+				t.Errorf("sent %d requests, want %d", n, tc.wantHits)
+			}
+		})
+	}
+}
+
+func TestDoRetriesTimeoutsOfIdempotentRequestsOnly(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+	client := New(Options{Name: "test", Timeout: 20 * time.Millisecond, MaxRetries: 2, BaseBackoff: time.Millisecond})
+
+	if _, err := client.Do(context.Background(), post(server.URL)); err == nil {
+		t.Fatal("POST succeeded against a hanging service")
+	}
+	if n := hits.Swap(0); n != 1 {
+		t.Errorf("POST sent %d times, want 1", n)
+	}
+	if _, err := client.Do(context.Background(), get(server.URL)); err == nil {
+		t.Fatal("GET succeeded against a hanging service")
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("GET sent %d times, want 3", n)
+	}
+}
+
+func TestDoRetriesFailedConnections(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	var builds int
+	client := New(Options{Name: "test", Timeout: time.Second, MaxRetries: 2, BaseBackoff: time.Millisecond})
+	_, err := client.Do(context.Background(), func(ctx context.Context) (*http.Request, error) {
+		builds++
+		return http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	})
+	if err == nil {
+		t.Fatal("Do succeeded against a closed server")
+	}
+	// Nothing reached the service, so even a POST is tried again
+	if builds != 3 {
+		t.Errorf("tried %d times, want 3", builds)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	client := New(Options{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	for retry, ceiling := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		40: time.Second,
+	} {
+		for i := 0; i < 100; i++ {
+			if d := client.backoff(retry); d < 0 || d > ceiling {
+				t.Fatalf("backoff(%d) = %s, want within [0, %s]", retry, d, ceiling)
+			}
+		}
+	}
+}
+
+func TestDoGivesUpWhenCallerDoes(t *testing.T) {
+	server := newStatusServer(t, 503)
+	client := New(Options{Name: "test", Timeout: time.Second, MaxRetries: 5, BaseBackoff: time.Hour, MaxBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Do(ctx, get(server.URL)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's error from the backoff", err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	server := newStatusServer(t, 500)
+	client := New(Options{Name: "test", Timeout: time.Second, FailureThreshold: 2, OpenDuration: 30 * time.Second})
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	client.breaker.now = c.Now
+	ctx := context.Background()
+
+	// Consecutive failures open the circuit
+	for i := 0; i < 2; i++ {
+		if _, err := client.Do(ctx, get(server.URL)); err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+	}
+	if !client.CircuitOpen() {
+		t.Fatal("circuit closed after reaching the failure threshold")
+	}
+	if _, err := client.Do(ctx, get(server.URL)); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := server.hits.Load(); n != 2 {
+		t.Errorf("sent %d requests, want none while the circuit is open", n)
+	}
+
+	// After the cooldown one trial call goes through; its failure re-opens
+	// the circuit for another cooldown
+	c.Advance(30 * time.Second)
+	if client.CircuitOpen() {
+		t.Error("circuit still open after the cooldown")
+	}
+	if _, err := client.Do(ctx, get(server.URL)); err != nil {
+		t.Fatalf("trial call: %v", err)
+	}
+	if _, err := client.Do(ctx, get(server.URL)); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("after a failed trial: err = %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful trial closes it
+	server.answer(http.StatusOK)
+	c.Advance(30 * time.Second)
+	for i := 0; i < 3; i++ {
+		if _, err := client.Do(ctx, get(server.URL)); err != nil {
+			t.Fatalf("call %d after a successful trial: %v", i, err)
+		}
+	}
+	if client.CircuitOpen() {
+		t.Error("circuit open after a successful trial")
+	}
+}
+
+func TestBreakerAllowsOneTrial(t *testing.T) {
+	b := newBreaker(1, time.Minute)
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	b.now = c.Now
+
+	b.failure()
+	if b.allow() {
+		t.Fatal("open breaker allowed a call")
+	}
+	c.Advance(time.Minute)
+	if !b.allow() {
+		t.Fatal("breaker refused the trial call after the cooldown")
+	}
+	if b.allow() {
+		t.Error("breaker allowed a second call during the trial")
+	}
+
+	// A cancelled trial frees the slot without judging the service
+	b.release()
+	if !b.allow() {
+		t.Error("breaker refused a trial after the last one was released")
+	}
+	b.success()
+	if !b.allow() || !b.allow() {
+		t.Error("closed breaker refused calls")
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Chunks arrive well within the timeout of each other, though the
+		// whole stream outlasts it
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("chunk\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		if r.URL.Query().Has("stall") {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+	client := New(Options{Name: "test", Timeout: 60 * time.Millisecond})
+
+	resp, err := client.Stream(context.Background(), get(server.URL))
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || len(body) != 5*len("chunk\n") {
+		t.Errorf("steady stream: read %q, %v", body, err)
+	}
+
+	resp, err = client.Stream(context.Background(), get(server.URL+"?stall"))
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer resp.Body.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(resp.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStreamIdle) {
+			t.Errorf("stalled stream: err = %v, want ErrStreamIdle", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read of a stalled stream did not time out")
+	}
+}